@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
@@ -8,52 +10,73 @@ import (
 	"github.com/btcsuite/btcd/txscript"
 )
 
-func GetTapScriptAddress(pk *btcec.PublicKey, revealedScript []byte, net *chaincfg.Params) (btcutil.Address, error) {
-	pubkey33 := pk.SerializeCompressed()
-	if pubkey33[0] == 0x02 {
-		pubkey33[0] = byte(txscript.BaseLeafVersion)
-	} else {
-		pubkey33[0] = byte(txscript.BaseLeafVersion) + 1
-	}
+// TapTree is the script tree of a commit output: the reveal leaf first and
+// optionally more, such as a recovery leaf, under InternalKey. The output can
+// also be spent by the key path, with the internal key tweaked by the root.
+type TapTree struct {
+	InternalKey *btcec.PublicKey
+	Leaves      [][]byte
+	tree        *txscript.IndexedTapScriptTree
+}
 
-	controlBlock, err := txscript.ParseControlBlock(
-		pubkey33,
-	)
-	if err != nil {
-		return nil, err
+// NewTapTree assembles leaves into a tree as BIP 341 suggests, pairing them
+// level by level in the order given.
+func NewTapTree(internalKey *btcec.PublicKey, leaves ...[]byte) (*TapTree, error) {
+	if len(leaves) == 0 {
+		return nil, errors.New("a script tree needs a leaf")
 	}
-	rootHash := controlBlock.RootHash(revealedScript)
+	tapLeaves := make([]txscript.TapLeaf, len(leaves))
+	for i, leaf := range leaves {
+		tapLeaves[i] = txscript.NewBaseTapLeaf(leaf)
+	}
+	return &TapTree{InternalKey: internalKey, Leaves: leaves, tree: txscript.AssembleTaprootScriptTree(tapLeaves...)}, nil
+}
 
-	// Next, we'll construct the final commitment (creating the external or
-	// taproot output key) as a function of this commitment and the
-	// included internal key: taprootKey = internalKey + (tPoint*G).
-	taprootKey := txscript.ComputeTaprootOutputKey(
-		controlBlock.InternalKey, rootHash,
-	)
+// RootHash is the merkle root the internal key is tweaked with.
+func (t *TapTree) RootHash() []byte {
+	root := t.tree.RootNode.TapHash()
+	return root[:]
+}
 
-	// If we convert the taproot key to a witness program (we just need to
-	// serialize the public key), then it should exactly match the witness
-	// program passed in.
-	tapKeyBytes := schnorr.SerializePubKey(taprootKey)
+// OutputKey is the key of the taproot output.
+func (t *TapTree) OutputKey() *btcec.PublicKey {
+	return txscript.ComputeTaprootOutputKey(t.InternalKey, t.RootHash())
+}
 
-	addr, err := btcutil.NewAddressTaproot(
-		tapKeyBytes,
-		net,
-	)
-	return addr, nil
+func (t *TapTree) Address(net *chaincfg.Params) (btcutil.Address, error) {
+	return btcutil.NewAddressTaproot(schnorr.SerializePubKey(t.OutputKey()), net)
 }
-func GetTaprootPubkey(pubkey *btcec.PublicKey, revealedScript []byte) (*btcec.PublicKey, error) {
-	controlBlock := txscript.ControlBlock{}
-	controlBlock.InternalKey = pubkey
-	rootHash := controlBlock.RootHash(revealedScript)
 
-	// Next, we'll construct the final commitment (creating the external or
-	// taproot output key) as a function of this commitment and the
-	// included internal key: taprootKey = internalKey + (tPoint*G).
-	taprootKey := txscript.ComputeTaprootOutputKey(
-		controlBlock.InternalKey, rootHash,
-	)
-	return taprootKey, nil
+func (t *TapTree) PkScript() ([]byte, error) {
+	return txscript.PayToTaprootScript(t.OutputKey())
+}
+
+// ControlBlock is the last witness item spending the output through leaf.
+func (t *TapTree) ControlBlock(leaf int) ([]byte, error) {
+	controlBlock := t.tree.LeafMerkleProofs[leaf].ToControlBlock(t.InternalKey)
+	return controlBlock.ToBytes()
+}
+
+// ControlBlockSize is the size of ControlBlock, known without the key.
+func (t *TapTree) ControlBlockSize(leaf int) int {
+	return txscript.ControlBlockBaseSize + len(t.tree.LeafMerkleProofs[leaf].InclusionProof)
+}
+
+// GetTapScriptAddress is the address of the tree of revealedScript alone.
+func GetTapScriptAddress(pk *btcec.PublicKey, revealedScript []byte, net *chaincfg.Params) (btcutil.Address, error) {
+	tree, err := NewTapTree(pk, revealedScript)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Address(net)
+}
+
+func GetTaprootPubkey(pubkey *btcec.PublicKey, revealedScript []byte) (*btcec.PublicKey, error) {
+	tree, err := NewTapTree(pubkey, revealedScript)
+	if err != nil {
+		return nil, err
+	}
+	return tree.OutputKey(), nil
 }
 
 // GetP2TRAddress returns a taproot address for a given public key.
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTapTreeSingleLeaf(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	script := (&Inscription{ContentType: "text/plain", Body: []byte("a")}).Script(key.PubKey())
+	leafHash := txscript.NewBaseTapLeaf(script).TapHash()
+	outputKey := txscript.ComputeTaprootOutputKey(key.PubKey(), leafHash[:])
+
+	address, err := GetTapScriptAddress(key.PubKey(), script, &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	assert.Equal(t, schnorr.SerializePubKey(outputKey), address.ScriptAddress())
+	taprootKey, err := GetTaprootPubkey(key.PubKey(), script)
+	require.NoError(t, err)
+	assert.True(t, outputKey.IsEqual(taprootKey))
+
+	tree, err := NewTapTree(key.PubKey(), script)
+	require.NoError(t, err)
+	controlBlock, err := tree.ControlBlock(0)
+	require.NoError(t, err)
+	assert.Len(t, controlBlock, txscript.ControlBlockBaseSize)
+	assert.Equal(t, len(controlBlock), tree.ControlBlockSize(0))
+
+	_, err = NewTapTree(key.PubKey())
+	assert.Error(t, err)
+}
+
+func TestRecoveryDelay(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	for _, delay := range []uint32{1, 16, 17, 127, 128, 144, 0x8000, wire.SequenceLockTimeMask} {
+		script, err := CreateRecoveryScript(key.PubKey(), delay)
+		require.NoError(t, err)
+		parsed, err := recoveryDelay(script)
+		assert.NoError(t, err)
+		assert.Equal(t, delay, parsed)
+	}
+	for _, delay := range []uint32{0, wire.SequenceLockTimeMask + 1} {
+		_, err := CreateRecoveryScript(key.PubKey(), delay)
+		assert.Error(t, err)
+	}
+	_, err = recoveryDelay((&Inscription{}).Script(key.PubKey()))
+	assert.Error(t, err)
+}
+
+// TestTapTreeRecoveryLeaf spends a commit output with a recovery leaf through
+// the reveal leaf, the recovery leaf and the key path.
+func TestTapTreeRecoveryLeaf(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 100000, PkScript: pkScript}}
+	recovery, err := CreateRecoveryScript(key.PubKey(), 144)
+	require.NoError(t, err)
+	ins := &Inscription{ContentType: "text/plain", Body: []byte("recoverable")}
+
+	txs, err := buildInscriptionRevealTxs(key.PubKey(), utxo, ins, 5, defaultRevealOutValue, net, nil, recovery)
+	require.NoError(t, err)
+	tree, err := txs.tree()
+	require.NoError(t, err)
+	assert.Len(t, tree.Leaves, 2)
+	commitPkScript, err := tree.PkScript()
+	require.NoError(t, err)
+	assert.Equal(t, commitPkScript, txs.commitTx.TxOut[0].PkScript)
+	single, err := GetTapScriptAddress(key.PubKey(), txs.script, net)
+	require.NoError(t, err)
+	assert.NotEqual(t, single.ScriptAddress(), commitPkScript[2:])
+
+	// the reveal carries the longer control block and still pays its fee rate
+	_, reveal, err := txs.sign(key, singleKey{key}, utxo)
+	require.NoError(t, err)
+	revealTx := &wire.MsgTx{}
+	require.NoError(t, revealTx.Deserialize(bytes.NewReader(reveal)))
+	assert.Len(t, revealTx.TxIn[0].Witness[2], txscript.ControlBlockBaseSize+32)
+	assert.Zero(t, txs.fee.Overpaid())
+	outputs := []*strandedOutput{{outpoint: revealTx.TxIn[0].PreviousOutPoint, prevOut: txs.commitTx.TxOut[0], tree: tree}}
+	assertRecoveryValid(t, outputs, revealTx, 5)
+
+	for _, path := range []spendPath{spendScript, spendRecovery, spendKey} {
+		found, err := findStrandedOutputs(txs.commitTx, []*TapTree{tree}, net)
+		require.NoError(t, err)
+		tx, err := buildRecoveryTx(found, nil, pkScript, 3, path)
+		require.NoError(t, err)
+		require.NoError(t, signRecoveryTx(tx, found, key, path), path)
+		assertRecoveryValid(t, found, tx, 3)
+		if path == spendRecovery {
+			assert.EqualValues(t, 2, tx.Version)
+			assert.EqualValues(t, 144, tx.TxIn[0].Sequence)
+			assert.Equal(t, recovery, []byte(tx.TxIn[0].Witness[1]))
+		}
+	}
+
+	// too early for the recovery leaf
+	found, err := findStrandedOutputs(txs.commitTx, []*TapTree{tree}, net)
+	require.NoError(t, err)
+	tx, err := buildRecoveryTx(found, nil, pkScript, 3, spendRecovery)
+	require.NoError(t, err)
+	tx.TxIn[0].Sequence = 143
+	require.NoError(t, signRecoveryTx(tx, found, key, spendRecovery))
+	prevOuts := strandedPrevOuts(found)
+	engine, err := txscript.NewEngine(found[0].prevOut.PkScript, tx, 0, txscript.StandardVerifyFlags, nil,
+		txscript.NewTxSigHashes(tx, prevOuts), found[0].prevOut.Value, prevOuts)
+	require.NoError(t, err)
+	assert.Error(t, engine.Execute())
+}
+
+func TestBatchStateRecoveryLeaf(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 100000, PkScript: pkScript}}
+	recovery, err := CreateRecoveryScript(key.PubKey(), 6)
+	require.NoError(t, err)
+	items := []*BatchItem{{Inscription: &Inscription{Body: []byte("a")}, Destination: address}}
+
+	batch, err := buildInscriptionBatch(key.PubKey(), utxo, items, nil, recovery, BatchSeparateOutputs, 546, 2, net)
+	require.NoError(t, err)
+	state, err := newBatchState(batch, &batchManifest{Inscriptions: make([]batchManifestItem, 1)}, items, nil, 2, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(recovery), state.Reveals[0].Recovery)
+	assert.NotEmpty(t, state.Reveals[0].RecoveryControlBlock)
+
+	trees, err := state.trees(key.PubKey())
+	require.NoError(t, err)
+	outputs, err := findStrandedOutputs(batch.commitTx, trees, net)
+	require.NoError(t, err)
+	assert.Len(t, outputs, 1)
+}
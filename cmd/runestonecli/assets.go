@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/pkg/errors"
+	"lukechampine.com/uint128"
+)
+
+// OutputAssets is what an output holds besides its sats.
+type OutputAssets struct {
+	Inscriptions []string
+	Runes        []string
+}
+
+// AssetChecker finds the runes and inscriptions of an output, so that coin
+// selection does not spend them as plain sats.
+type AssetChecker interface {
+	OutputAssets(outpoint wire.OutPoint) (*OutputAssets, error)
+}
+
+// OutputAssets returns the inscriptions and runes of /output/<outpoint>.
+func (o OrdConnector) OutputAssets(outpoint wire.OutPoint) (*OutputAssets, error) {
+	res, err := o.request("/output/" + outpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Inscriptions []string        `json:"inscriptions"`
+		Runes        json.RawMessage `json:"runes"`
+	}
+	if err := json.Unmarshal(res, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to decode ord output")
+	}
+	balances, err := parseOrdRunes(resp.Runes)
+	if err != nil {
+		return nil, fmt.Errorf("ord output %s: %w", outpoint, err)
+	}
+	assets := &OutputAssets{Inscriptions: resp.Inscriptions}
+	for _, balance := range balances {
+		assets.Runes = append(assets.Runes, balance.SpacedRune.String())
+	}
+	return assets, nil
+}
+
+// RuneBalance is an amount of a rune held by an output, with the divisibility
+// and symbol of its etching.
+type RuneBalance struct {
+	SpacedRune   runestone.SpacedRune
+	Amount       uint128.Uint128
+	Divisibility uint8
+	Symbol       *rune
+}
+
+// Pile returns the amount formatted as ord does.
+func (b RuneBalance) Pile() runestone.Pile {
+	return runestone.Pile{Amount: b.Amount, Divisibility: b.Divisibility, Symbol: b.Symbol}
+}
+
+// RuneBalancer finds the rune balances of an output.
+type RuneBalancer interface {
+	OutputRunes(outpoint wire.OutPoint) ([]RuneBalance, error)
+}
+
+// OutputRunes returns the runes of /output/<outpoint>.
+func (o OrdConnector) OutputRunes(outpoint wire.OutPoint) ([]RuneBalance, error) {
+	res, err := o.request("/output/" + outpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Runes json.RawMessage `json:"runes"`
+	}
+	if err := json.Unmarshal(res, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to decode ord output")
+	}
+	balances, err := parseOrdRunes(resp.Runes)
+	if err != nil {
+		return nil, fmt.Errorf("ord output %s: %w", outpoint, err)
+	}
+	return balances, nil
+}
+
+// ordPile is a rune balance as ord lists it.
+type ordPile struct {
+	Amount       json.Number `json:"amount"`
+	Divisibility uint8       `json:"divisibility"`
+	Symbol       *string     `json:"symbol"`
+}
+
+// parseOrdRunes reads the runes of an ord output, sorted by name. ord lists
+// them as a map by spaced rune, older versions as [spaced rune, pile] pairs.
+func parseOrdRunes(raw json.RawMessage) ([]RuneBalance, error) {
+	var byName map[string]json.RawMessage
+	var pairs [][]json.RawMessage
+	piles := map[string]json.RawMessage{}
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+		return nil, nil
+	case json.Unmarshal(raw, &byName) == nil:
+		piles = byName
+	case json.Unmarshal(raw, &pairs) == nil:
+		for _, pair := range pairs {
+			var name string
+			if len(pair) != 2 || json.Unmarshal(pair[0], &name) != nil {
+				return nil, errors.New("unknown runes format")
+			}
+			piles[name] = pair[1]
+		}
+	default:
+		return nil, errors.New("unknown runes format")
+	}
+	balances := make([]RuneBalance, 0, len(piles))
+	for name, data := range piles {
+		spacedRune, err := runestone.SpacedRuneFromString(name)
+		if err != nil {
+			return nil, err
+		}
+		var pile ordPile
+		if err := json.Unmarshal(data, &pile); err != nil {
+			return nil, fmt.Errorf("rune %s: %w", name, err)
+		}
+		amount, err := parseUint128(&pile.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("rune %s: %w", name, err)
+		}
+		balance := RuneBalance{SpacedRune: *spacedRune, Amount: amount, Divisibility: pile.Divisibility}
+		if pile.Symbol != nil {
+			if r := []rune(*pile.Symbol); len(r) > 0 {
+				balance.Symbol = &r[0]
+			}
+		}
+		balances = append(balances, balance)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].SpacedRune.String() < balances[j].SpacedRune.String()
+	})
+	return balances, nil
+}
+
+// InscriptionLocator finds the output an inscription is on now, so that it
+// can be spent as the parent of new inscriptions.
+type InscriptionLocator interface {
+	InscriptionOutput(id InscriptionId) (wire.OutPoint, error)
+}
+
+// InscriptionOutput returns the output of the satpoint of /inscription/<id>.
+func (o OrdConnector) InscriptionOutput(id InscriptionId) (wire.OutPoint, error) {
+	res, err := o.request("/inscription/" + id.String())
+	if err != nil {
+		return wire.OutPoint{}, err
+	}
+	var resp struct {
+		Satpoint string `json:"satpoint"`
+	}
+	if err := json.Unmarshal(res, &resp); err != nil {
+		return wire.OutPoint{}, errors.Wrap(err, "failed to decode ord inscription")
+	}
+	// <txid>:<vout>:<offset>
+	i := strings.LastIndex(resp.Satpoint, ":")
+	if i < 0 {
+		return wire.OutPoint{}, fmt.Errorf("ord inscription %s: invalid satpoint %q", id, resp.Satpoint)
+	}
+	outpoint, err := wire.NewOutPointFromString(resp.Satpoint[:i])
+	if err != nil {
+		return wire.OutPoint{}, fmt.Errorf("ord inscription %s: %w", id, err)
+	}
+	return *outpoint, nil
+}
+
+// OutputAssets returns the runes the index holds for outpoint. The index
+// starts at the block of the rune it was first asked for, so it only knows
+// runes etched since, and no inscriptions.
+func (s *indexRuneSource) OutputAssets(outpoint wire.OutPoint) (*OutputAssets, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return nil, errors.New("rune index has not been started")
+	}
+	if _, err := s.sync(0); err != nil {
+		return nil, err
+	}
+	assets := &OutputAssets{}
+	for _, balance := range s.index.Balances(outpoint) {
+		assets.Runes = append(assets.Runes, balance.ID.String())
+	}
+	return assets, nil
+}
+
+// OutputRunes returns the runes the index holds for outpoint, with the same
+// limits as OutputAssets.
+func (s *indexRuneSource) OutputRunes(outpoint wire.OutPoint) ([]RuneBalance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return nil, errors.New("rune index has not been started")
+	}
+	if _, err := s.sync(0); err != nil {
+		return nil, err
+	}
+	var balances []RuneBalance
+	for _, balance := range s.index.Balances(outpoint) {
+		entry, ok := s.index.RuneEntry(balance.ID)
+		if !ok {
+			return nil, fmt.Errorf("rune %s is not in the index", balance.ID)
+		}
+		balances = append(balances, RuneBalance{
+			SpacedRune:   entry.SpacedRune,
+			Amount:       balance.Amount,
+			Divisibility: entry.Divisibility,
+			Symbol:       entry.Symbol,
+		})
+	}
+	return balances, nil
+}
+
+// assetFilter drops utxos holding inscriptions, and runes unless they may be
+// carried, before coin selection. Answers are cached per outpoint.
+type assetFilter struct {
+	checker    AssetChecker
+	carryRunes bool
+
+	mu    sync.Mutex
+	cache map[wire.OutPoint]*OutputAssets
+	own   map[wire.OutPoint]struct{} // change of our unconfirmed transactions
+}
+
+func newAssetFilter(checker AssetChecker, carryRunes bool) *assetFilter {
+	return &assetFilter{checker: checker, carryRunes: carryRunes, cache: map[wire.OutPoint]*OutputAssets{}, own: map[wire.OutPoint]struct{}{}}
+}
+
+// keep marks outpoint as the change of a transaction we sent, which may be
+// spent before it confirms.
+func (f *assetFilter) keep(outpoint wire.OutPoint) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.own[outpoint] = struct{}{}
+}
+
+// spendable returns the utxos that can be spent as fee inputs. An unconfirmed
+// utxo is not known to the checker and may hold an incoming inscription or
+// rune transfer, so only the ones marked by keep are kept.
+func (f *assetFilter) spendable(utxos []*Utxo) ([]*Utxo, error) {
+	if f == nil {
+		return utxos, nil
+	}
+	var kept []*Utxo
+	for _, utxo := range utxos {
+		if utxo.Confirmations == 0 {
+			f.mu.Lock()
+			_, own := f.own[utxo.OutPoint()]
+			f.mu.Unlock()
+			if own {
+				kept = append(kept, utxo)
+			}
+			continue
+		}
+		assets, err := f.assets(utxo.OutPoint())
+		if err != nil {
+			return nil, err
+		}
+		if len(assets.Inscriptions) > 0 || (len(assets.Runes) > 0 && !f.carryRunes) {
+			continue
+		}
+		kept = append(kept, utxo)
+	}
+	return kept, nil
+}
+
+func (f *assetFilter) assets(outpoint wire.OutPoint) (*OutputAssets, error) {
+	f.mu.Lock()
+	assets, ok := f.cache[outpoint]
+	f.mu.Unlock()
+	if ok {
+		return assets, nil
+	}
+	assets, err := f.checker.OutputAssets(outpoint)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.cache[outpoint] = assets
+	f.mu.Unlock()
+	return assets, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// balanceReport is what balance tells about an address, or about the
+// outpoints given without one.
+type balanceReport struct {
+	Address string          `json:"address,omitempty"`
+	Btc     *btcBalance     `json:"btc,omitempty"` // only for an address
+	Outputs []outputBalance `json:"outputs"`
+	Totals  []runeAmount    `json:"totals"` // per rune, over every output
+}
+
+type btcBalance struct {
+	Confirmed   uint64 `json:"confirmed"`
+	Unconfirmed int64  `json:"unconfirmed"` // received in unconfirmed outputs
+}
+
+type outputBalance struct {
+	Outpoint      string       `json:"outpoint"`
+	Value         int64        `json:"value"`
+	Confirmations int64        `json:"confirmations"`
+	Runes         []runeAmount `json:"runes,omitempty"`
+}
+
+type runeAmount struct {
+	Rune    string `json:"rune"`
+	Amount  string `json:"amount"`  // in the smallest unit
+	Display string `json:"display"` // with divisibility and symbol
+}
+
+func newRuneAmount(b RuneBalance) runeAmount {
+	return runeAmount{Rune: b.SpacedRune.String(), Amount: b.Amount.String(), Display: b.Pile().String()}
+}
+
+func runBalance(args []string) {
+	fs := flag.NewFlagSet("balance", flag.ExitOnError)
+	asJson := fs.Bool("json", false, "print the balances as JSON")
+	from := fs.Uint64("from", 0, "with RuneSource index, the height the index starts at, before the first rune to count; an index kept in IndexDir goes on from where it stopped")
+	fs.Parse(args)
+
+	source, err := config.GetUtxoSource()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	runeSource, err := config.GetRuneSource()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	var balancer RuneBalancer
+	if runeSource == nil {
+		p.Printf("No RuneSource configured, rune balances are not shown\n")
+	} else if balancer, _ = runeSource.(RuneBalancer); balancer == nil {
+		p.Printf("RuneSource %s cannot list rune balances\n", config.RuneSource)
+	}
+	if index, ok := runeSource.(*indexRuneSource); ok {
+		if *from == 0 && config.IndexDir == "" {
+			p.Printf("Usage: balance [--json] [--from <height>] [address|outpoint...]\n")
+			os.Exit(2)
+		}
+		if err := index.startAt(*from); err != nil {
+			p.Println(err.Error())
+			return
+		}
+	}
+
+	var addresses []string
+	var outpoints []wire.OutPoint
+	for _, arg := range fs.Args() {
+		if outpoint, err := wire.NewOutPointFromString(arg); err == nil && strings.Contains(arg, ":") {
+			outpoints = append(outpoints, *outpoint)
+		} else {
+			addresses = append(addresses, arg)
+		}
+	}
+	if fs.NArg() == 0 {
+		if addresses, err = config.GetMintAddresses(); err != nil {
+			p.Println(err.Error())
+			return
+		}
+	}
+	if len(addresses) > 0 && config.usesNodeWallet() && !loadWallet() {
+		return
+	}
+
+	var reports []*balanceReport
+	for _, address := range addresses {
+		lister, ok := source.(AddressLister)
+		if !ok {
+			p.Printf("UtxoSource %s cannot list the outputs of an address\n", config.UtxoSource)
+			return
+		}
+		report, err := AddressBalance(lister, balancer, address)
+		if err != nil {
+			p.Println(err.Error())
+			return
+		}
+		reports = append(reports, report)
+	}
+	if len(outpoints) > 0 {
+		report, err := OutpointBalance(source, balancer, outpoints)
+		if err != nil {
+			p.Println(err.Error())
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	if *asJson {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			p.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	for _, report := range reports {
+		printBalance(report)
+	}
+}
+
+// AddressBalance lists the outputs of address with their runes, the rune
+// totals and the BTC balance. Without a balancer no runes are listed.
+func AddressBalance(lister AddressLister, balancer RuneBalancer, address string) (*balanceReport, error) {
+	utxos, err := lister.ListOutputs(address)
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := lister.GetBalance(address)
+	if err != nil {
+		return nil, err
+	}
+	report := &balanceReport{Address: address, Btc: &btcBalance{Confirmed: confirmed}}
+	for _, utxo := range utxos {
+		if utxo.Confirmations == 0 {
+			report.Btc.Unconfirmed += utxo.Value
+		}
+	}
+	if err := report.addOutputs(utxos, balancer); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// OutpointBalance is AddressBalance for outputs given by outpoint, their
+// values found with the UtxoSource.
+func OutpointBalance(source UtxoSource, balancer RuneBalancer, outpoints []wire.OutPoint) (*balanceReport, error) {
+	var utxos []*Utxo
+	for _, outpoint := range outpoints {
+		tx, err := source.GetRawTx(outpoint.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", outpoint, err)
+		}
+		if int(outpoint.Index) >= len(tx.TxOut) {
+			return nil, fmt.Errorf("output %s does not exist", outpoint)
+		}
+		out := tx.TxOut[outpoint.Index]
+		utxos = append(utxos, &Utxo{TxHash: HexToHash(outpoint.Hash.String()), Index: outpoint.Index, Value: out.Value, PkScript: out.PkScript})
+	}
+	report := &balanceReport{}
+	if err := report.addOutputs(utxos, balancer); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// addOutputs adds utxos in outpoint order and sums their runes into the
+// totals.
+func (r *balanceReport) addOutputs(utxos []*Utxo, balancer RuneBalancer) error {
+	sorted := append([]*Utxo{}, utxos...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].OutPoint().String() < sorted[j].OutPoint().String()
+	})
+	r.Outputs = []outputBalance{}
+	totals := map[string]RuneBalance{}
+	for _, utxo := range sorted {
+		output := outputBalance{Outpoint: utxo.OutPoint().String(), Value: utxo.Value, Confirmations: utxo.Confirmations}
+		if balancer != nil {
+			balances, err := balancer.OutputRunes(utxo.OutPoint())
+			if err != nil {
+				return err
+			}
+			for _, balance := range balances {
+				output.Runes = append(output.Runes, newRuneAmount(balance))
+				name := balance.SpacedRune.String()
+				if total, ok := totals[name]; ok {
+					balance.Amount = total.Amount.Add(balance.Amount)
+				}
+				totals[name] = balance
+			}
+		}
+		r.Outputs = append(r.Outputs, output)
+	}
+	names := make([]string, 0, len(totals))
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.Totals = []runeAmount{}
+	for _, name := range names {
+		r.Totals = append(r.Totals, newRuneAmount(totals[name]))
+	}
+	return nil
+}
+
+func printBalance(r *balanceReport) {
+	if r.Address != "" {
+		p.Printf("Address %s\n", r.Address)
+	}
+	if r.Btc != nil {
+		p.Printf("BTC: %d sat confirmed, %d sat unconfirmed\n", r.Btc.Confirmed, r.Btc.Unconfirmed)
+	}
+	p.Printf("Outputs:\n")
+	for _, out := range r.Outputs {
+		fmt.Printf("  %s %d\n", out.Outpoint, out.Value)
+		for _, amount := range out.Runes {
+			fmt.Printf("    %s %s\n", amount.Rune, amount.Display)
+		}
+	}
+	if len(r.Totals) > 0 {
+		p.Printf("Runes:\n")
+		for _, amount := range r.Totals {
+			fmt.Printf("  %s %s\n", amount.Rune, amount.Display)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAddressLister holds the outputs of a single address.
+type testAddressLister struct {
+	utxos     []*Utxo
+	confirmed uint64
+}
+
+func (l testAddressLister) ListOutputs(address string) ([]*Utxo, error) {
+	return l.utxos, nil
+}
+
+func (l testAddressLister) GetBalance(address string) (uint64, error) {
+	return l.confirmed, nil
+}
+
+// ordStandIn writes the /output responses of an ord stand-in, keyed by
+// outpoint.
+func ordStandIn(t *testing.T, outputs map[wire.OutPoint]string) *OrdConnector {
+	responses := map[string]string{}
+	for outpoint, body := range outputs {
+		responses["/output/"+outpoint.String()] = body
+	}
+	return ordResponses(t, responses)
+}
+
+// ordResponses writes the responses of an ord stand-in, keyed by request path.
+func ordResponses(t *testing.T, responses map[string]string) *OrdConnector {
+	dir := t.TempDir()
+	for path, body := range responses {
+		name := filepath.Join(dir, filepath.FromSlash(path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0700))
+		require.NoError(t, os.WriteFile(name, []byte(body), 0600))
+	}
+	return &OrdConnector{baseUrl: "file://" + dir}
+}
+
+func TestOrdOutputRunes(t *testing.T) {
+	current := wire.OutPoint{Hash: [32]byte{1}, Index: 0}
+	older := wire.OutPoint{Hash: [32]byte{2}, Index: 1}
+	ord := ordStandIn(t, map[wire.OutPoint]string{
+		current: `{"inscriptions":[],"runes":{"UNCOMMON•GOODS":{"amount":6845,"divisibility":0,"symbol":"⧉"},"Z•Z•Z•Z•Z•FEHU•Z•Z•Z•Z•Z":{"amount":123456,"divisibility":2,"symbol":null}}}`,
+		older:   `{"inscriptions":["6fb976ab49dcec017f1e201e84395983204ae1a7c2abf7ced0a85d692e442799i0"],"runes":[["UNCOMMON•GOODS",{"amount":1,"divisibility":0,"symbol":"⧉"}]]}`,
+	})
+
+	balances, err := ord.OutputRunes(current)
+	require.NoError(t, err)
+	require.Len(t, balances, 2)
+	assert.Equal(t, "UNCOMMON•GOODS", balances[0].SpacedRune.String())
+	assert.Equal(t, "6845 ⧉", balances[0].Pile().String())
+	assert.Equal(t, "1234.56 ¤", balances[1].Pile().String())
+
+	balances, err = ord.OutputRunes(older)
+	require.NoError(t, err)
+	require.Len(t, balances, 1)
+	assert.EqualValues(t, 1, balances[0].Amount.Lo)
+
+	// the assets of an output come from the same response
+	assets, err := ord.OutputAssets(older)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UNCOMMON•GOODS"}, assets.Runes)
+	assert.Len(t, assets.Inscriptions, 1)
+}
+
+func TestAddressBalance(t *testing.T) {
+	runes := &Utxo{TxHash: Hash{1}, Index: 0, Value: 546, Confirmations: 3}
+	moreRunes := &Utxo{TxHash: Hash{2}, Index: 1, Value: 546}
+	plain := &Utxo{TxHash: Hash{3}, Index: 2, Value: 100000, Confirmations: 1}
+	ord := ordStandIn(t, map[wire.OutPoint]string{
+		runes.OutPoint():     `{"runes":{"UNCOMMON•GOODS":{"amount":5,"divisibility":0,"symbol":"⧉"},"DOG•GO•TO•THE•MOON":{"amount":150000,"divisibility":5,"symbol":"🐕"}}}`,
+		moreRunes.OutPoint(): `{"runes":{"DOG•GO•TO•THE•MOON":{"amount":50000,"divisibility":5,"symbol":"🐕"}}}`,
+		plain.OutPoint():     `{"runes":{}}`,
+	})
+	lister := testAddressLister{utxos: []*Utxo{plain, moreRunes, runes}, confirmed: 100546}
+
+	report, err := AddressBalance(lister, ord, "bcrt1qaddress")
+	require.NoError(t, err)
+	assert.Equal(t, &btcBalance{Confirmed: 100546, Unconfirmed: 546}, report.Btc)
+	require.Len(t, report.Outputs, 3)
+	assert.Equal(t, runes.OutPoint().String(), report.Outputs[0].Outpoint)
+	assert.Equal(t, []runeAmount{
+		{Rune: "DOG•GO•TO•THE•MOON", Amount: "150000", Display: "1.5 🐕"},
+		{Rune: "UNCOMMON•GOODS", Amount: "5", Display: "5 ⧉"},
+	}, report.Outputs[0].Runes)
+	assert.Empty(t, report.Outputs[2].Runes)
+	assert.Equal(t, []runeAmount{
+		{Rune: "DOG•GO•TO•THE•MOON", Amount: "200000", Display: "2 🐕"},
+		{Rune: "UNCOMMON•GOODS", Amount: "5", Display: "5 ⧉"},
+	}, report.Totals)
+
+	// without a RuneSource only the sats are listed
+	report, err = AddressBalance(lister, nil, "bcrt1qaddress")
+	require.NoError(t, err)
+	assert.Len(t, report.Outputs, 3)
+	assert.Empty(t, report.Totals)
+}
+
+// rawTxSource serves the transactions of txs.
+type rawTxSource struct {
+	*testUtxoSource
+	txs map[chainhash.Hash]*wire.MsgTx
+}
+
+func (s rawTxSource) GetRawTx(hash chainhash.Hash) (*wire.MsgTx, error) {
+	if tx, ok := s.txs[hash]; ok {
+		return tx, nil
+	}
+	return s.testUtxoSource.GetRawTx(hash)
+}
+
+func TestOutpointBalance(t *testing.T) {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{9}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(100000, []byte{0x51}))
+	tx.AddTxOut(wire.NewTxOut(546, []byte{0x52}))
+	source := rawTxSource{&testUtxoSource{}, map[chainhash.Hash]*wire.MsgTx{tx.TxHash(): tx}}
+	runes := wire.OutPoint{Hash: tx.TxHash(), Index: 1}
+	ord := ordStandIn(t, map[wire.OutPoint]string{
+		runes: `{"runes":{"UNCOMMON•GOODS":{"amount":5,"divisibility":0,"symbol":"⧉"}}}`,
+	})
+
+	report, err := OutpointBalance(source, ord, []wire.OutPoint{runes})
+	require.NoError(t, err)
+	require.Len(t, report.Outputs, 1)
+	assert.Equal(t, runes.String(), report.Outputs[0].Outpoint)
+	assert.Equal(t, int64(546), report.Outputs[0].Value)
+	assert.Equal(t, []runeAmount{{Rune: "UNCOMMON•GOODS", Amount: "5", Display: "5\u00a0⧉"}}, report.Totals)
+
+	_, err = OutpointBalance(source, ord, []wire.OutPoint{{Hash: tx.TxHash(), Index: 2}})
+	assert.ErrorContains(t, err, "does not exist")
+	_, err = OutpointBalance(source, ord, []wire.OutPoint{{Hash: chainhash.Hash{1}}})
+	assert.ErrorContains(t, err, "not found")
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BatchMode is how the inscriptions of a batch are revealed.
+type BatchMode string
+
+const (
+	// BatchSeparateOutputs reveals every inscription in one transaction, each
+	// on an output of its own, as ord does by default.
+	BatchSeparateOutputs BatchMode = "separate-outputs"
+	// BatchSameSat reveals every inscription in one transaction, all on the
+	// first sat of its only output.
+	BatchSameSat BatchMode = "same-sat"
+	// BatchRevealPerItem reveals every inscription in a transaction of its
+	// own, each spending an output of the one commit.
+	BatchRevealPerItem BatchMode = "reveal-per-item"
+)
+
+// BatchItem is an inscription of a batch and the address it goes to.
+type BatchItem struct {
+	Inscription *Inscription
+	Destination btcutil.Address
+}
+
+// BatchParent is an inscription that the reveal spends, so that the
+// inscriptions of the batch are its children, and returns to Destination.
+type BatchParent struct {
+	Id          InscriptionId
+	Utxo        *Utxo // the output it is on
+	Destination []byte
+}
+
+// inscriptionBatch is a commit transaction and the reveals spending it, the
+// i-th reveal its i-th output.
+type inscriptionBatch struct {
+	mode     BatchMode
+	commitTx *wire.MsgTx
+	reveals  []*revealTxs
+}
+
+// buildInscriptionBatch inscribes items with one commit. Every reveal is
+// funded by the commit with postage for each of its outputs and its fee at
+// feeRate, so the fees of the whole batch are paid by the commit inputs.
+//
+// With parents, the reveal spends them before the commit output and returns
+// each in an output of the same value ahead of the inscriptions, as ord does,
+// so that their sats keep their place.
+//
+// recovery, if not nil, is a second leaf of every commit output.
+func buildInscriptionBatch(pubKey *btcec.PublicKey, utxo []*Utxo, items []*BatchItem, parents []*BatchParent, recovery []byte, mode BatchMode, postage, feeRate int64, net *chaincfg.Params) (*inscriptionBatch, error) {
+	if len(items) == 0 {
+		return nil, errors.New("the batch has no inscriptions")
+	}
+	batch := &inscriptionBatch{mode: mode}
+	switch mode {
+	case BatchSeparateOutputs, BatchSameSat:
+		script := appendPush(nil, schnorr.SerializePubKey(pubKey))
+		script = append(script, txscript.OP_CHECKSIG)
+		revealTx := wire.NewMsgTx(wire.TxVersion)
+		var parentUtxos []*Utxo
+		var parentIds []InscriptionId
+		parentValue := int64(0)
+		for _, parent := range parents {
+			outpoint := parent.Utxo.OutPoint()
+			in := wire.NewTxIn(&outpoint, nil, nil)
+			in.Sequence = defaultSequenceNum
+			revealTx.AddTxIn(in)
+			revealTx.AddTxOut(wire.NewTxOut(parent.Utxo.Value, parent.Destination))
+			parentUtxos = append(parentUtxos, parent.Utxo)
+			parentIds = append(parentIds, parent.Id)
+			parentValue += parent.Utxo.Value
+		}
+		commitIn := wire.NewTxIn(&wire.OutPoint{}, nil, nil)
+		commitIn.Sequence = defaultSequenceNum
+		revealTx.AddTxIn(commitIn)
+		for i, item := range items {
+			ins := *item.Inscription
+			ins.Parents = append(append([]InscriptionId{}, ins.Parents...), parentIds...)
+			switch {
+			case mode == BatchSameSat && item.Destination.EncodeAddress() != items[0].Destination.EncodeAddress():
+				return nil, errors.New("the inscriptions of a same-sat batch go to one destination")
+			case mode == BatchSameSat && i == 0:
+				if err := addBatchOutput(revealTx, item.Destination, postage); err != nil {
+					return nil, err
+				}
+			case mode == BatchSeparateOutputs:
+				// the first inscription is on the first sat of the commit
+				// input anyway
+				if i > 0 {
+					pointer := uint64(parentValue) + uint64(i)*uint64(postage)
+					ins.Pointer = &pointer
+				}
+				if err := addBatchOutput(revealTx, item.Destination, postage); err != nil {
+					return nil, err
+				}
+			}
+			script = append(script, ins.Envelope()...)
+		}
+		batch.reveals = append(batch.reveals, &revealTxs{revealTx: revealTx, pubKey: pubKey, script: script, input: len(parents), parents: parentUtxos, feeRate: feeRate, recovery: recovery})
+	case BatchRevealPerItem:
+		if len(parents) > 0 {
+			return nil, errors.New("a parent can only be spent by one reveal, inscribe children in one reveal")
+		}
+		for i, item := range items {
+			revealTx := newBatchRevealTx(uint32(i))
+			if err := addBatchOutput(revealTx, item.Destination, postage); err != nil {
+				return nil, err
+			}
+			batch.reveals = append(batch.reveals, &revealTxs{revealTx: revealTx, pubKey: pubKey, script: item.Inscription.Script(pubKey), feeRate: feeRate, recovery: recovery})
+		}
+	default:
+		return nil, fmt.Errorf("unknown batch mode %q", mode)
+	}
+
+	var commitOuts []*wire.TxOut
+	for _, r := range batch.reveals {
+		vsize, err := r.vsize()
+		if err != nil {
+			return nil, err
+		}
+		if vsize > MaxStandardTxWeight/4 {
+			return nil, fmt.Errorf("reveal of %d vB exceeds the standard transaction weight", vsize)
+		}
+		value := vsize * feeRate
+		for _, out := range r.revealTx.TxOut {
+			value += out.Value
+		}
+		for _, parent := range r.parents {
+			value -= parent.Value
+		}
+		tree, err := r.tree()
+		if err != nil {
+			return nil, err
+		}
+		pkScript, err := tree.PkScript()
+		if err != nil {
+			return nil, err
+		}
+		commitOuts = append(commitOuts, wire.NewTxOut(value, pkScript))
+	}
+	commitTx, err := buildCommitTx(utxo, commitOuts, feeRate, nil, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	batch.commitTx = commitTx
+	for i, r := range batch.reveals {
+		r.commitTx = commitTx
+		r.revealTx.TxIn[r.input].PreviousOutPoint = wire.OutPoint{Hash: commitTx.TxHash(), Index: uint32(i)}
+	}
+	if err := checkChildren(batch.reveals[0], parents); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// checkChildren makes sure that every envelope of the reveal names each
+// parent and that the reveal spends the parents and returns them unchanged,
+// which ord requires to recognize the children.
+func checkChildren(r *revealTxs, parents []*BatchParent) error {
+	envelopes, err := ParseTapscriptEnvelopes(r.script, r.input)
+	if err != nil {
+		return err
+	}
+	for i, parent := range parents {
+		in, out := r.revealTx.TxIn[i], r.revealTx.TxOut[i]
+		if in.PreviousOutPoint != parent.Utxo.OutPoint() || out.Value != parent.Utxo.Value {
+			return fmt.Errorf("the reveal does not spend and return parent %s", parent.Id)
+		}
+		for _, envelope := range envelopes {
+			found := false
+			for _, id := range envelope.Parents {
+				found = found || id == parent.Id
+			}
+			if !found {
+				return fmt.Errorf("inscription %d of the reveal does not name parent %s", envelope.Offset, parent.Id)
+			}
+		}
+	}
+	return nil
+}
+
+func newBatchRevealTx(commitIndex uint32) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	in := wire.NewTxIn(&wire.OutPoint{Index: commitIndex}, nil, nil)
+	in.Sequence = defaultSequenceNum
+	tx.AddTxIn(in)
+	return tx
+}
+
+func addBatchOutput(tx *wire.MsgTx, destination btcutil.Address, postage int64) error {
+	pkScript, err := txscript.PayToAddrScript(destination)
+	if err != nil {
+		return err
+	}
+	tx.AddTxOut(wire.NewTxOut(postage, pkScript))
+	return nil
+}
+
+// sign signs the commit with keys and then every reveal with privateKey.
+func (b *inscriptionBatch) sign(privateKey *btcec.PrivateKey, keys KeySource, utxo []*Utxo) ([]byte, [][]byte, error) {
+	commitTx, err := signCommitTx(keys, utxo, b.commitTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	commit, err := serializeTx(commitTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reveals [][]byte
+	for _, r := range b.reveals {
+		revealTx, err := completeRevealTx(privateKey, keys, commitTx, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		reveal, err := serializeTx(revealTx)
+		if err != nil {
+			return nil, nil, err
+		}
+		reveals = append(reveals, reveal)
+	}
+	return commit, reveals, nil
+}
+
+// psbts returns the commit PSBT and a PSBT for every reveal.
+func (b *inscriptionBatch) psbts(pubKeys PubKeySource, utxo []*Utxo, prevTx PrevTxFetcher) ([]byte, [][]byte, error) {
+	commit, reveal, err := b.reveals[0].psbts(pubKeys, utxo, prevTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	reveals := [][]byte{reveal}
+	for _, r := range b.reveals[1:] {
+		reveal, err := r.revealPsbt(pubKeys, prevTx)
+		if err != nil {
+			return nil, nil, err
+		}
+		reveals = append(reveals, reveal)
+	}
+	return commit, reveals, nil
+}
+
+// inscriptionIds returns the id of every item, in the order of the items,
+// once the reveals are final.
+func (b *inscriptionBatch) inscriptionIds(items int) []InscriptionId {
+	ids := make([]InscriptionId, items)
+	for i := range ids {
+		if b.mode == BatchRevealPerItem {
+			ids[i] = InscriptionId{Txid: b.reveals[i].revealTx.TxHash()}
+		} else {
+			ids[i] = InscriptionId{Txid: b.reveals[0].revealTx.TxHash(), Index: uint32(i)}
+		}
+	}
+	return ids
+}
+
+// fees returns the fees of the commit, given the outputs it spends, and of
+// every reveal.
+func (b *inscriptionBatch) fees(utxo []*Utxo) (commit int64, reveals int64) {
+	for _, in := range b.commitTx.TxIn {
+		if prevOut := UtxoList(utxo).FetchPrevOutput(in.PreviousOutPoint); prevOut != nil {
+			commit += prevOut.Value
+		}
+	}
+	for _, out := range b.commitTx.TxOut {
+		commit -= out.Value
+	}
+	for _, r := range b.reveals {
+		reveals += b.commitTx.TxOut[r.revealTx.TxIn[r.input].PreviousOutPoint.Index].Value
+		for _, parent := range r.parents {
+			reveals += parent.Value
+		}
+		for _, out := range r.revealTx.TxOut {
+			reveals -= out.Value
+		}
+	}
+	return commit, reveals
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedTestBatch builds and signs a batch of three inscriptions, the last to
+// another address, funded by one taproot utxo.
+func signedTestBatch(t *testing.T, mode BatchMode) (*inscriptionBatch, []*BatchItem, []*Utxo) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	other, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), net)
+	require.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 1000000, PkScript: pkScript}}
+
+	items := []*BatchItem{
+		{Inscription: &Inscription{ContentType: "text/plain", Body: []byte("a")}, Destination: address},
+		{Inscription: &Inscription{ContentType: "text/plain", Body: []byte("b"), Metadata: []byte{0xa0}}, Destination: address},
+		{Inscription: &Inscription{ContentType: "image/png", Body: make([]byte, 1000)}, Destination: other},
+	}
+	if mode == BatchSameSat {
+		items[2].Destination = address
+	}
+	batch, err := buildInscriptionBatch(key.PubKey(), utxo, items, nil, nil, mode, 546, 10, net)
+	require.NoError(t, err)
+	_, _, err = batch.sign(key, singleKey{key}, utxo)
+	require.NoError(t, err)
+	return batch, items, utxo
+}
+
+// assertRevealsValid runs the script engine on every input of every reveal
+// and checks that it pays at least feeRate.
+func assertRevealsValid(t *testing.T, batch *inscriptionBatch, feeRate int64) {
+	for _, r := range batch.reveals {
+		assert.Equal(t, batch.commitTx.TxHash(), r.revealTx.TxIn[r.input].PreviousOutPoint.Hash)
+		fetcher := r.prevOuts()
+		sigHashes := txscript.NewTxSigHashes(r.revealTx, fetcher)
+		fee := int64(0)
+		for i, in := range r.revealTx.TxIn {
+			prevOut := fetcher.FetchPrevOutput(in.PreviousOutPoint)
+			require.NotNil(t, prevOut)
+			engine, err := txscript.NewEngine(prevOut.PkScript, r.revealTx, i, txscript.StandardVerifyFlags, nil,
+				sigHashes, prevOut.Value, fetcher)
+			require.NoError(t, err)
+			assert.NoError(t, engine.Execute())
+			fee += prevOut.Value
+		}
+		for _, out := range r.revealTx.TxOut {
+			fee -= out.Value
+		}
+		vsize := (blockchain.GetTransactionWeight(btcutil.NewTx(r.revealTx)) + 3) / 4
+		assert.GreaterOrEqual(t, fee, vsize*feeRate)
+		require.NotNil(t, r.fee)
+		assert.Equal(t, &revealFee{Vsize: vsize, Fee: fee, Required: vsize * feeRate}, r.fee)
+	}
+}
+
+func TestBatchSeparateOutputs(t *testing.T) {
+	batch, items, _ := signedTestBatch(t, BatchSeparateOutputs)
+	assert.Len(t, batch.reveals, 1)
+	assertRevealsValid(t, batch, 10)
+
+	reveal := batch.reveals[0].revealTx
+	assert.Len(t, reveal.TxOut, 3)
+	envelopes := ParseEnvelopes(reveal)
+	assert.Len(t, envelopes, 3)
+	for i, envelope := range envelopes {
+		assert.Equal(t, items[i].Inscription.Body, envelope.Body)
+		if i == 0 {
+			assert.Nil(t, envelope.Pointer)
+		} else {
+			// the i-th inscription is on the first sat of the i-th output
+			assert.Equal(t, uint64P(uint64(i)*546), envelope.Pointer)
+		}
+		pkScript, err := txscript.PayToAddrScript(items[i].Destination)
+		assert.NoError(t, err)
+		assert.Equal(t, pkScript, reveal.TxOut[i].PkScript)
+	}
+	assert.Equal(t, []byte{0xa0}, envelopes[1].Metadata)
+	assert.Nil(t, items[1].Inscription.Pointer, "the items are not changed")
+	assert.Equal(t, []InscriptionId{
+		{Txid: reveal.TxHash(), Index: 0}, {Txid: reveal.TxHash(), Index: 1}, {Txid: reveal.TxHash(), Index: 2},
+	}, batch.inscriptionIds(len(items)))
+}
+
+func TestBatchSameSat(t *testing.T) {
+	batch, _, _ := signedTestBatch(t, BatchSameSat)
+	assertRevealsValid(t, batch, 10)
+	reveal := batch.reveals[0].revealTx
+	assert.Len(t, reveal.TxOut, 1)
+	envelopes := ParseEnvelopes(reveal)
+	assert.Len(t, envelopes, 3)
+	for _, envelope := range envelopes {
+		assert.Nil(t, envelope.Pointer)
+	}
+}
+
+func TestBatchSameSatOneDestination(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	a, err := getP2TRAddress(key.PubKey(), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	b, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	items := []*BatchItem{{Inscription: &Inscription{}, Destination: a}, {Inscription: &Inscription{}, Destination: b}}
+	_, err = buildInscriptionBatch(key.PubKey(), nil, items, nil, nil, BatchSameSat, 546, 1, &chaincfg.RegressionNetParams)
+	assert.Error(t, err)
+}
+
+func TestBatchRevealPerItem(t *testing.T) {
+	batch, items, utxo := signedTestBatch(t, BatchRevealPerItem)
+	assert.Len(t, batch.reveals, 3)
+	assertRevealsValid(t, batch, 10)
+	for i, r := range batch.reveals {
+		assert.Equal(t, uint32(i), r.revealTx.TxIn[0].PreviousOutPoint.Index)
+		envelopes := ParseEnvelopes(r.revealTx)
+		assert.Len(t, envelopes, 1)
+		assert.Equal(t, items[i].Inscription.Body, envelopes[0].Body)
+		assert.Equal(t, InscriptionId{Txid: r.revealTx.TxHash()}, batch.inscriptionIds(len(items))[i])
+	}
+	// the commit pays every reveal and its change
+	assert.Len(t, batch.commitTx.TxOut, 4)
+	commitFee, revealFees := batch.fees(utxo)
+	assert.Positive(t, commitFee)
+	assert.Positive(t, revealFees)
+	total := int64(0)
+	for _, out := range batch.commitTx.TxOut {
+		total += out.Value
+	}
+	assert.Equal(t, utxo[0].Value, total+commitFee)
+}
+
+func TestBatchChildren(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	other, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), net)
+	require.NoError(t, err)
+	otherScript, err := txscript.PayToAddrScript(other)
+	require.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 1000000, PkScript: pkScript}}
+	parent := &BatchParent{
+		Id:          InscriptionId{Txid: chainhash.Hash{1}, Index: 0},
+		Utxo:        &Utxo{TxHash: HexToHash(chainhash.Hash{1}.String()), Index: 1, Value: 10000, PkScript: pkScript},
+		Destination: otherScript,
+	}
+	items := []*BatchItem{
+		{Inscription: &Inscription{ContentType: "text/plain", Body: []byte("a")}, Destination: address},
+		{Inscription: &Inscription{ContentType: "text/plain", Body: []byte("b")}, Destination: address},
+	}
+	batch, err := buildInscriptionBatch(key.PubKey(), utxo, items, []*BatchParent{parent}, nil, BatchSeparateOutputs, 546, 10, net)
+	require.NoError(t, err)
+	_, _, err = batch.sign(key, singleKey{key}, utxo)
+	require.NoError(t, err)
+	assertRevealsValid(t, batch, 10)
+
+	r := batch.reveals[0]
+	assert.Equal(t, 1, r.input)
+	assert.Equal(t, parent.Utxo.OutPoint(), r.revealTx.TxIn[0].PreviousOutPoint)
+	assert.Equal(t, wire.NewTxOut(10000, otherScript), r.revealTx.TxOut[0])
+	envelopes := ParseEnvelopes(r.revealTx)
+	require.Len(t, envelopes, 2)
+	for _, envelope := range envelopes {
+		assert.Equal(t, 1, envelope.Input)
+		assert.Equal(t, []InscriptionId{parent.Id}, envelope.Parents)
+	}
+	// the children follow the parent output
+	assert.Nil(t, envelopes[0].Pointer)
+	assert.Equal(t, uint64P(10000+546), envelopes[1].Pointer)
+	assert.Nil(t, items[0].Inscription.Parents, "the items are not changed")
+
+	_, err = buildInscriptionBatch(key.PubKey(), utxo, items, []*BatchParent{parent}, nil, BatchRevealPerItem, 546, 10, net)
+	assert.Error(t, err)
+}
+
+func TestBatchUnknownMode(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	_, err = buildInscriptionBatch(key.PubKey(), nil, []*BatchItem{{Inscription: &Inscription{}}}, nil, nil, "shared-output", 546, 1, &chaincfg.RegressionNetParams)
+	assert.Error(t, err)
+}
+
+func TestBatchRevealInputIndex(t *testing.T) {
+	tx := newBatchRevealTx(2)
+	assert.Equal(t, wire.OutPoint{Index: 2}, tx.TxIn[0].PreviousOutPoint)
+}
+
+func TestBatchManifest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.json"), []byte("{}"), 0600))
+	manifest := `mode: reveal-per-item
+postage: 1000
+inscriptions:
+  - file: a.txt
+    metadata:
+      title: a
+      n: 1
+  - file: b.json
+    content_type: application/json
+    metaprotocol: test
+    destination: bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4
+`
+	path := filepath.Join(dir, "batch.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(manifest), 0600))
+
+	m, err := loadBatchManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, BatchRevealPerItem, m.Mode)
+	assert.EqualValues(t, 1000, m.Postage)
+	assert.Equal(t, filepath.Join(dir, "a.txt"), m.Inscriptions[0].File)
+
+	const wallet = "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"
+	items, err := m.items(wallet)
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, []byte("hello"), items[0].Inscription.Body)
+	assert.Equal(t, "text/plain; charset=utf-8", items[0].Inscription.ContentType)
+	// {"title": "a", "n": 1}
+	assert.Equal(t, []byte{0xa2, 0x65, 't', 'i', 't', 'l', 'e', 0x61, 'a', 0x61, 'n', 0x01}, items[0].Inscription.Metadata)
+	assert.Equal(t, wallet, items[0].Destination.EncodeAddress())
+	assert.Equal(t, "application/json", items[1].Inscription.ContentType)
+	assert.Equal(t, "test", items[1].Inscription.Metaprotocol)
+	assert.Nil(t, items[1].Inscription.Metadata)
+	assert.Equal(t, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", items[1].Destination.EncodeAddress())
+}
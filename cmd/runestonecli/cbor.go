@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CBOR major types
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborSimple   = 7
+)
+
+// yamlToCBOR encodes a YAML value as CBOR, the way ord turns the metadata of
+// a batch into the metadata field: maps keep the order of the document.
+func yamlToCBOR(node *yaml.Node) ([]byte, error) {
+	return appendCBOR(nil, node)
+}
+
+func appendCBOR(b []byte, node *yaml.Node) ([]byte, error) {
+	var err error
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return append(b, cborSimple<<5|22), nil
+		}
+		return appendCBOR(b, node.Content[0])
+	case yaml.AliasNode:
+		return appendCBOR(b, node.Alias)
+	case yaml.SequenceNode:
+		b = appendCBORHead(b, cborArray, uint64(len(node.Content)))
+		for _, item := range node.Content {
+			if b, err = appendCBOR(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case yaml.MappingNode:
+		b = appendCBORHead(b, cborMap, uint64(len(node.Content)/2))
+		for _, item := range node.Content {
+			if b, err = appendCBOR(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case yaml.ScalarNode:
+		return appendCBORScalar(b, node)
+	}
+	return nil, fmt.Errorf("line %d: unsupported yaml value", node.Line)
+}
+
+func appendCBORScalar(b []byte, node *yaml.Node) ([]byte, error) {
+	switch node.ShortTag() {
+	case "!!null":
+		return append(b, cborSimple<<5|22), nil
+	case "!!bool":
+		var v bool
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		if v {
+			return append(b, cborSimple<<5|21), nil
+		}
+		return append(b, cborSimple<<5|20), nil
+	case "!!int":
+		var v int64
+		if err := node.Decode(&v); err != nil {
+			var u uint64
+			if err := node.Decode(&u); err != nil {
+				return nil, err
+			}
+			return appendCBORHead(b, cborUnsigned, u), nil
+		}
+		if v < 0 {
+			return appendCBORHead(b, cborNegative, uint64(-1-v)), nil
+		}
+		return appendCBORHead(b, cborUnsigned, uint64(v)), nil
+	case "!!float":
+		var v float64
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		b = append(b, cborSimple<<5|27)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v)), nil
+	default:
+		b = appendCBORHead(b, cborText, uint64(len(node.Value)))
+		return append(b, node.Value...), nil
+	}
+}
+
+// appendCBORHead appends the major type and the shortest encoding of n.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major<<5|27), n)
+	}
+}
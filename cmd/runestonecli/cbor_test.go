@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestYamlToCBOR(t *testing.T) {
+	for _, test := range []struct {
+		yaml string
+		cbor string
+	}{
+		// examples of RFC 8949, appendix A
+		{"0", "00"},
+		{"23", "17"},
+		{"24", "1818"},
+		{"1000000", "1a000f4240"},
+		{"18446744073709551615", "1bffffffffffffffff"},
+		{"-1", "20"},
+		{"-1000", "3903e7"},
+		{"1.1", "fb3ff199999999999a"},
+		{"false", "f4"},
+		{"true", "f5"},
+		{"null", "f6"},
+		{`"IETF"`, "6449455446"},
+		{"[1, [2, 3], [4, 5]]", "8301820203820405"},
+		{"{a: 1, b: [2, 3]}", "a26161016162820203"},
+		// maps keep the order of the document
+		{"{b: 1, a: 2}", "a2616201616102"},
+		{"x: &v hi\ny: *v", "a261786268696179626869"},
+	} {
+		var node yaml.Node
+		assert.NoError(t, yaml.Unmarshal([]byte(test.yaml), &node), test.yaml)
+		cbor, err := yamlToCBOR(&node)
+		assert.NoError(t, err, test.yaml)
+		assert.Equal(t, test.cbor, hex.EncodeToString(cbor), test.yaml)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// dustLimit is the smallest change output worth creating.
+	dustLimit = 546
+	// bnbMaxTries bounds the branch-and-bound search.
+	bnbMaxTries = 100000
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// coin is a utxo with its value net of the fee of spending it.
+type coin struct {
+	utxo      *Utxo
+	effective int64
+}
+
+// inputWeight is the weight an input spending pkScript adds to a
+// transaction, signature included.
+func inputWeight(pkScript []byte) (int64, error) {
+	in := wire.NewTxIn(&wire.OutPoint{}, nil, nil)
+	if err := mockSignInput(in, pkScript); err != nil {
+		return 0, err
+	}
+	// outpoint, sequence and signature script
+	base := int64(chainhash.HashSize + 4 + 4 + wire.VarIntSerializeSize(uint64(len(in.SignatureScript))) + len(in.SignatureScript))
+	return base*4 + int64(in.Witness.SerializeSize()), nil
+}
+
+// vbytesFee is the fee of weight at feeRate sat/vB, rounded up.
+func vbytesFee(weight, feeRate int64) int64 {
+	return (weight*feeRate + 3) / 4
+}
+
+// selectCoins picks utxos to pay target, the outputs plus the fee of the
+// transaction without inputs. changeCost is what a change output would cost,
+// its fee plus the dust it must at least hold.
+//
+// It first looks for a set that overshoots target by less than changeCost, so
+// that the change output can be left out; the search is branch and bound over
+// the effective values, as in Bitcoin Core. Failing that it pays target plus
+// changeCost with the single smallest utxo that can, or else the largest
+// utxos, whichever leaves the least change. changeless reports which of the
+// two was done.
+func selectCoins(utxos []*Utxo, target, changeCost, feeRate int64) (selected []*Utxo, changeless bool, err error) {
+	coins := make([]coin, 0, len(utxos))
+	total := int64(0)
+	for _, utxo := range utxos {
+		weight, err := inputWeight(utxo.PkScript)
+		if err != nil {
+			continue
+		}
+		effective := utxo.Value - vbytesFee(weight, feeRate)
+		if effective <= 0 {
+			continue
+		}
+		coins = append(coins, coin{utxo: utxo, effective: effective})
+		total += effective
+	}
+	if total < target {
+		return nil, false, ErrInsufficientBalance
+	}
+	sort.Slice(coins, func(i, j int) bool {
+		return coins[i].effective > coins[j].effective
+	})
+	if set := branchAndBound(coins, target, changeCost); set != nil {
+		return set, true, nil
+	}
+	if total < target+changeCost {
+		return nil, false, ErrInsufficientBalance
+	}
+	return knapsack(coins, target+changeCost), false, nil
+}
+
+// branchAndBound returns the set of coins, sorted by descending effective
+// value, whose sum lies in [target, target+window] with the least excess, or
+// nil if none was found.
+func branchAndBound(coins []coin, target, window int64) []*Utxo {
+	// remaining[i] is the sum of coins[i:]
+	remaining := make([]int64, len(coins)+1)
+	for i := len(coins) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + coins[i].effective
+	}
+	var (
+		best      []bool
+		bestWaste int64 = -1
+		included        = make([]bool, len(coins))
+		tries     int
+	)
+	var search func(depth int, sum int64)
+	search = func(depth int, sum int64) {
+		if tries++; tries > bnbMaxTries {
+			return
+		}
+		if sum > target+window || sum+remaining[depth] < target {
+			return
+		}
+		if sum >= target {
+			if waste := sum - target; bestWaste < 0 || waste < bestWaste {
+				bestWaste = waste
+				best = append(best[:0], included...)
+			}
+			return
+		}
+		if depth == len(coins) {
+			return
+		}
+		included[depth] = true
+		search(depth+1, sum+coins[depth].effective)
+		included[depth] = false
+		if bestWaste == 0 {
+			return
+		}
+		// equal coins after an excluded one only repeat the same sums
+		next := depth + 1
+		for next < len(coins) && coins[next].effective == coins[depth].effective {
+			next++
+		}
+		search(next, sum)
+	}
+	search(0, 0)
+	if bestWaste < 0 {
+		return nil
+	}
+	var set []*Utxo
+	for i, in := range best {
+		if in {
+			set = append(set, coins[i].utxo)
+		}
+	}
+	return set
+}
+
+// knapsack pays need with the smallest single coin that can, or the largest
+// coins first, whichever overshoots less. coins are sorted by descending
+// effective value and sum to at least need.
+func knapsack(coins []coin, need int64) []*Utxo {
+	var single *Utxo
+	singleExcess := int64(-1)
+	for _, c := range coins {
+		if c.effective >= need {
+			single, singleExcess = c.utxo, c.effective-need
+		}
+	}
+	var largest []*Utxo
+	sum := int64(0)
+	for _, c := range coins {
+		if sum >= need {
+			break
+		}
+		largest = append(largest, c.utxo)
+		sum += c.effective
+	}
+	if single != nil && singleExcess <= sum-need {
+		return []*Utxo{single}
+	}
+	return largest
+}
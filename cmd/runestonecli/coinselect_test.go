@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// effectiveUtxos returns P2TR utxos worth effectives at 1 sat/vB, after the
+// fee of spending them.
+func effectiveUtxos(t *testing.T, effectives ...int64) []*Utxo {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	pkScript := keyUtxos(t, key)[0].PkScript
+	weight, err := inputWeight(pkScript)
+	require.NoError(t, err)
+	utxos := make([]*Utxo, len(effectives))
+	for i, effective := range effectives {
+		utxos[i] = &Utxo{TxHash: Hash{byte(i + 1)}, Value: effective + vbytesFee(weight, 1), PkScript: pkScript}
+	}
+	return utxos
+}
+
+// effectives returns the effective values of utxos at 1 sat/vB.
+func effectives(t *testing.T, utxos []*Utxo) []int64 {
+	var values []int64
+	for _, utxo := range utxos {
+		weight, err := inputWeight(utxo.PkScript)
+		require.NoError(t, err)
+		values = append(values, utxo.Value-vbytesFee(weight, 1))
+	}
+	return values
+}
+
+func TestSelectCoins(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		coins      []int64
+		target     int64
+		want       []int64
+		changeless bool
+		err        error
+	}{
+		{name: "exact match", coins: []int64{5000, 3000, 2000, 1500}, target: 4500, want: []int64{3000, 1500}, changeless: true},
+		{name: "match within the change cost", coins: []int64{5000, 3000, 1000}, target: 3950, want: []int64{3000, 1000}, changeless: true},
+		{name: "smallest single coin", coins: []int64{10000, 7000, 3000, 2000}, target: 6000, want: []int64{7000}},
+		{name: "largest coins first", coins: []int64{4000, 3000, 2500}, target: 6000, want: []int64{4000, 3000}},
+		{name: "insufficient", coins: []int64{4000, 3000}, target: 7001, err: ErrInsufficientBalance},
+		{name: "no coins", target: 1, err: ErrInsufficientBalance},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, changeless, err := selectCoins(effectiveUtxos(t, tc.coins...), tc.target, 100, 1)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, effectives(t, selected))
+			assert.Equal(t, tc.changeless, changeless)
+		})
+	}
+}
+
+func TestSelectCoinsSkipsUneconomic(t *testing.T) {
+	utxos := effectiveUtxos(t, 3000)
+	// worth less than the fee of spending it, and a script no key signs
+	utxos = append(utxos, &Utxo{Value: 50, PkScript: utxos[0].PkScript}, &Utxo{Value: 100000, PkScript: []byte{0x51}})
+	selected, _, err := selectCoins(utxos, 2950, 100, 1)
+	require.NoError(t, err)
+	assert.Equal(t, utxos[:1], selected)
+	_, _, err = selectCoins(utxos, 3001, 100, 1)
+	assert.ErrorIs(t, err, ErrInsufficientBalance)
+}
+
+func testCoins(values ...int64) []coin {
+	coins := make([]coin, len(values))
+	for i, value := range values {
+		coins[i] = coin{utxo: &Utxo{Value: value}, effective: value}
+	}
+	return coins
+}
+
+func utxoValues(utxos []*Utxo) []int64 {
+	var values []int64
+	for _, utxo := range utxos {
+		values = append(values, utxo.Value)
+	}
+	return values
+}
+
+func TestBranchAndBound(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		coins  []int64
+		target int64
+		window int64
+		want   []int64
+	}{
+		{name: "exact", coins: []int64{8, 5, 4, 3, 1}, target: 7, window: 0, want: []int64{4, 3}},
+		{name: "least excess", coins: []int64{10, 6, 5}, target: 10, window: 2, want: []int64{10}},
+		{name: "excess within the window", coins: []int64{10, 6, 5}, target: 9, window: 2, want: []int64{10}},
+		{name: "equal coins", coins: []int64{5, 5, 5, 5, 2}, target: 12, window: 0, want: []int64{5, 5, 2}},
+		{name: "all coins", coins: []int64{5, 4}, target: 9, window: 0, want: []int64{5, 4}},
+		{name: "none in the window", coins: []int64{10, 6, 5}, target: 12, window: 2},
+		{name: "not enough", coins: []int64{5, 4}, target: 10, window: 100},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, utxoValues(branchAndBound(testCoins(tc.coins...), tc.target, tc.window)))
+		})
+	}
+}
+
+func TestKnapsack(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		coins []int64
+		need  int64
+		want  []int64
+	}{
+		{name: "smallest single coin", coins: []int64{100, 60, 30}, need: 50, want: []int64{60}},
+		{name: "largest coins", coins: []int64{40, 30, 20}, need: 65, want: []int64{40, 30}},
+		{name: "exact single coin", coins: []int64{100, 50, 20}, need: 50, want: []int64{50}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, utxoValues(knapsack(testCoins(tc.coins...), tc.need)))
+		})
+	}
+}
+
+// testAssetChecker answers from assets and counts the questions.
+type testAssetChecker struct {
+	assets map[wire.OutPoint]*OutputAssets
+	calls  int
+	err    error
+}
+
+func (c *testAssetChecker) OutputAssets(outpoint wire.OutPoint) (*OutputAssets, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	if assets, ok := c.assets[outpoint]; ok {
+		return assets, nil
+	}
+	return &OutputAssets{}, nil
+}
+
+func TestAssetFilter(t *testing.T) {
+	plain := &Utxo{TxHash: Hash{1}, Confirmations: 1}
+	runes := &Utxo{TxHash: Hash{2}, Confirmations: 1}
+	inscribed := &Utxo{TxHash: Hash{3}, Confirmations: 1}
+	// not known to ord yet, maybe an incoming transfer
+	unconfirmed := &Utxo{TxHash: Hash{4}}
+	// the change of a mint we sent
+	change := &Utxo{TxHash: Hash{5}, Index: 2}
+	utxos := []*Utxo{plain, runes, inscribed, unconfirmed, change}
+	assets := map[wire.OutPoint]*OutputAssets{
+		runes.OutPoint():     {Runes: []string{"840000:1"}},
+		inscribed.OutPoint(): {Inscriptions: []string{"6fb976ab49dcec017f1e201e84395983204ae1a7c2abf7ced0a85d692e442799i0"}},
+	}
+	for _, tc := range []struct {
+		name       string
+		carryRunes bool
+		want       []*Utxo
+	}{
+		{name: "inscribe", want: []*Utxo{plain, change}},
+		{name: "mint", carryRunes: true, want: []*Utxo{plain, runes, change}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := &testAssetChecker{assets: assets}
+			filter := newAssetFilter(checker, tc.carryRunes)
+			filter.keep(change.OutPoint())
+			kept, err := filter.spendable(utxos)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, kept)
+			// answers are cached
+			_, err = filter.spendable(utxos)
+			require.NoError(t, err)
+			assert.Equal(t, 3, checker.calls)
+		})
+	}
+
+	// without a checker nothing is dropped
+	var filter *assetFilter
+	kept, err := filter.spendable(utxos)
+	require.NoError(t, err)
+	assert.Equal(t, utxos, kept)
+
+	failing := errors.New("ord is down")
+	_, err = newAssetFilter(&testAssetChecker{err: failing}, true).spendable(utxos)
+	assert.ErrorIs(t, err, failing)
+}
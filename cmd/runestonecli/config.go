@@ -2,10 +2,8 @@ package main
 
 import (
 	"bytes"
-	"regexp"
 
 	// "crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,15 +14,27 @@ import (
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/bxelab/runestone"
+	"lukechampine.com/uint128"
 )
 
 type Config struct {
-	WalletName   string
-	PrivateKey   string
+	WalletName string // watch-only wallet of the node, default walletname_8888
+	RescanFrom *int64 // rescan the chain from this height when new addresses are imported
+	Keystore   string // path of the encrypted keystore, default keystore.json
+	Key        string // keystore name of the main wallet key
+	HDState    string // addresses derived from hd keys, default hdwallet.json
+	HDRotate   string // "tx" or "batch": new mint output and change addresses of hd keys per transaction or per batch
+	Wallets    []struct {
+		Key        string
+		PrivateKey string // refused, import it with `key import`
+	}
+	PrivateKey   string // refused, import it with `key import`
 	FeePerByte   int64
+	Fee          *FeeConfig
 	UtxoAmount   int64
 	IsAutoSpeed  int64
 	SpeedFee     int64
@@ -32,7 +42,16 @@ type Config struct {
 	Network      string
 	RpcUrl       string
 	LocalRpcUrl  string
-	Etching      *struct {
+	UtxoSource   string // "node" (default): wallet of LocalRpcUrl; "esplora": RpcUrl only
+	RuneSource   string
+	IndexDir     string // where RuneSource index keeps its state, empty: in memory
+	OrdUrl       string
+	BlockNotify  string
+	ZmqBlockUrl  string
+	// commit outputs of etch and inscribe get a leaf the wallet key can spend
+	// this many blocks after the commit, 0: none
+	RecoveryBlocks uint32
+	Etching        *struct {
 		Rune              string
 		Logo              string
 		Symbol            *string
@@ -51,111 +70,55 @@ type Config struct {
 	}
 }
 
-var wallet_name = "walletname_8888"
-
-// importPrivateKey 导入私钥到指定钱包
-func (c Config) importPrivateKey(cksum string) error {
-	_, addr, _ := c.GetPrivateKeyAddr()
+// defaultWalletName is the watch-only wallet used when WalletName is empty.
+const defaultWalletName = "walletname_8888"
 
+// importAddress 导入地址到观察钱包, 返回是否新导入
+func (c Config) importAddress(addr string) (bool, error) {
 	isExists, err := c.CheckAddressInWallet(addr)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if isExists {
-		return nil
+		return false, nil
 	}
 
-	addesc := "addr(" + addr + ")"
-
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      "mm",
-		"method":  "importdescriptors",
-		"params": [][]map[string]interface{}{
-			{
-				{
-					"desc":      fmt.Sprintf("%s#%s", addesc, cksum), // 确保描述符的正确性
-					"timestamp": "now",
-					"active":    false,
-					"index":     0,
-					"internal":  false,
-					"label":     "mm",
-					"watchonly": true, // 设置为仅观察地址
-				},
-			},
-		},
-	})
+	desc, err := withChecksum("addr(" + addr + ")")
 	if err != nil {
-		return err
+		return false, err
 	}
-
-	localrpc := config.GetLocalRpcUrl() + "/wallet/" + wallet_name
-
-	resp, err := http.Post(localrpc, "application/json", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return err
+	var result []struct {
+		Success bool `json:"success"`
+		Error   *struct {
+			Message string `json:"message"`
+		} `json:"error"`
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	err = c.walletCall("importdescriptors", []interface{}{
+		[]map[string]interface{}{
+			{
+				"desc":      desc,
+				"timestamp": "now",
+				"active":    false,
+				"internal":  false,
+				"label":     "mm",
+				"watchonly": true, // 设置为仅观察地址
+			},
+		},
+	}, &result)
 	if err != nil {
-		return err
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return err
+		return false, err
 	}
-
-	if errMsg, ok := result["error"]; ok && errMsg != nil {
-		return fmt.Errorf("RPC error: %v", errMsg)
+	if len(result) != 1 {
+		return false, errors.New("importdescriptors returned no result")
 	}
-
-	// fmt.Println(result)
-	// 提取校验和
-	checksum := handleResult(result)
-	if checksum != "" {
-		fmt.Println("地址导入中, 稍候...")
-		err := c.importPrivateKey(checksum)
-		if err != nil {
-			fmt.Println("地址导入失败")
-			return err
+	if !result[0].Success {
+		if result[0].Error != nil {
+			return false, fmt.Errorf("import %s: %s", addr, result[0].Error.Message)
 		}
-		fmt.Println("地址导入成功")
-		return nil
+		return false, fmt.Errorf("import %s failed", addr)
 	}
-
-	return nil
-}
-
-// 提取并比较校验和
-func extractAndCompareChecksum(errorMessage string) string {
-	re := regexp.MustCompile(`Provided checksum '([a-z0-9]+)' does not match computed checksum '([a-z0-9]+)'`)
-	matches := re.FindStringSubmatch(errorMessage)
-
-	if len(matches) == 3 {
-		return matches[2]
-	}
-
-	return ""
-}
-
-func handleResult(result map[string]interface{}) string {
-	if resultList, ok := result["result"].([]interface{}); ok && len(resultList) > 0 {
-		if errorDetails, ok := resultList[0].(map[string]interface{})["error"].(map[string]interface{}); ok {
-			// 提取 message 字段
-			message, ok := errorDetails["message"].(string)
-			if !ok {
-				return ""
-			}
-
-			// 提取校验和
-			return extractAndCompareChecksum(message)
-		}
-	}
-
-	return ""
+	return true, nil
 }
 
 func (c Config) walletExists(walletName string) (bool, error) {
@@ -220,7 +183,7 @@ func (c Config) CheckAddressInWallet(address string) (bool, error) {
 		return false, err
 	}
 
-	localrpc := c.GetLocalRpcUrl() + "/wallet/" + wallet_name
+	localrpc := c.GetLocalRpcUrl() + "/wallet/" + c.walletName()
 
 	resp, err := http.Post(localrpc, "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
@@ -256,26 +219,27 @@ func (c Config) CheckAddressInWallet(address string) (bool, error) {
 // 新建个观察钱包
 func (c Config) createWallet() (string, error) {
 	//检测钱包是否存在，没有则新建一个临时使用
-	isExists, err := c.walletExists(wallet_name)
+	walletName := c.walletName()
+	isExists, err := c.walletExists(walletName)
 
 	if err != nil {
 		return "", err
 	}
 
 	if isExists {
-		err := c.importPrivateKey("aaaaaaaa")
+		err := c.importWallets()
 		if err != nil {
 			return "", err
 		}
 
-		return wallet_name, nil
+		return walletName, nil
 	}
 
 	reqBody, err := json.Marshal(map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      "mm",
 		"method":  "createwallet",
-		"params":  []interface{}{wallet_name, true, true, nil, true, true},
+		"params":  []interface{}{walletName, true, true, nil, true, true},
 	})
 	if err != nil {
 		return "", err
@@ -303,12 +267,52 @@ func (c Config) createWallet() (string, error) {
 		return "", fmt.Errorf("RPC error: %v", errMsg)
 	}
 
-	err = c.importPrivateKey("aaaaaaaa")
+	err = c.importWallets()
 	if err != nil {
 		return "", err
 	}
 
-	return wallet_name, nil
+	return walletName, nil
+}
+
+// importWallets 将所有mint钱包的地址导入到观察钱包, 有新导入的地址并且配置了
+// RescanFrom时从该高度重新扫描区块, 找回导入前收到的utxo
+func (c Config) importWallets() error {
+	addresses, err := c.GetMintAddresses()
+	if err != nil {
+		return err
+	}
+	imported := 0
+	for _, address := range addresses {
+		isNew, err := c.importAddress(address)
+		if err != nil {
+			return err
+		}
+		if isNew {
+			imported++
+		}
+	}
+	if imported > 0 {
+		p.Printf("Imported %d addresses into wallet %s\n", imported, c.walletName())
+		if c.RescanFrom != nil {
+			return c.rescan(*c.RescanFrom)
+		}
+	}
+	return nil
+}
+
+// FeeConfig selects the fee rate sources used when FeePerByte is 0.
+type FeeConfig struct {
+	Sources      []string // static, node, mempool-recommended, mempool-blocks; tried in order
+	Static       int64    // rate of the static source
+	Min          int64    // lower clamp, sat/vB
+	Max          int64    // upper clamp, sat/vB, 0 for none
+	CacheSeconds int64
+	ConfTarget   int64  // estimatesmartfee conf_target
+	EstimateMode string // estimatesmartfee estimate_mode
+	Recommended  string // fastestFee, halfHourFee, hourFee, economyFee or minimumFee
+	Period       string // fee-rates period of mempool-blocks
+	Percentile   *int   // 0, 10, 25, 50, 75, 90 or 100, default 90
 }
 
 func DefaultConfig() Config {
@@ -324,6 +328,58 @@ func (c Config) GetFeePerByte() int64 {
 	return c.FeePerByte
 }
 
+// GetFee returns the fee configuration with defaults filled in.
+func (c Config) GetFee() FeeConfig {
+	fee := FeeConfig{}
+	if c.Fee != nil {
+		fee = *c.Fee
+	}
+	if len(fee.Sources) == 0 {
+		fee.Sources = []string{"mempool-blocks"}
+	}
+	if fee.Min == 0 {
+		fee.Min = 1
+	}
+	if fee.CacheSeconds == 0 {
+		fee.CacheSeconds = 90
+	}
+	if fee.ConfTarget == 0 {
+		fee.ConfTarget = 1
+	}
+	if fee.Recommended == "" {
+		fee.Recommended = "fastestFee"
+	}
+	if fee.Period == "" {
+		fee.Period = "100m"
+	}
+	if fee.Percentile == nil {
+		percentile := 90
+		fee.Percentile = &percentile
+	}
+	return fee
+}
+
+// GetFeeEstimator returns FeePerByte if it is set, otherwise the sources of Fee.
+func (c Config) GetFeeEstimator() (FeeEstimator, error) {
+	if c.FeePerByte > 0 {
+		return staticFee(c.FeePerByte), nil
+	}
+	return newFeeEstimator(c, c.GetFee().Sources)
+}
+
+// GetSpeedFeeEstimator returns SpeedFee if it is set, otherwise the sources of
+// Fee: fees, the estimator of GetFeeEstimator, unless FeePerByte replaces them.
+func (c Config) GetSpeedFeeEstimator(fees FeeEstimator) (FeeEstimator, error) {
+	if c.SpeedFee > 0 {
+		return staticFee(c.SpeedFee), nil
+	}
+	if c.FeePerByte > 0 {
+		// stuck transactions are sped up to the current rate
+		return newFeeEstimator(c, c.GetFee().Sources)
+	}
+	return fees, nil
+}
+
 func (c Config) GetLocalRpcUrl() string {
 	return c.LocalRpcUrl
 }
@@ -347,6 +403,15 @@ func (c Config) GetUnconfirmeds() int64 {
 	return c.Unconfirmeds
 }
 
+// walletName is the watch-only wallet of the node that holds the mint
+// addresses.
+func (c Config) walletName() string {
+	if c.WalletName == "" {
+		return defaultWalletName
+	}
+	return c.WalletName
+}
+
 func (c Config) GetWalletName() (string, error) {
 	//先新建临时钱包，将提供的私钥导入到钱包中
 	var err error
@@ -376,6 +441,115 @@ func (c Config) GetMint() (*runestone.RuneId, int64, error) {
 	return runeId, c.Mint.MintNum, nil
 }
 
+// GetEtching converts the Etching config into a runestone etching. Terms are
+// set if any of their fields is.
+func (c Config) GetEtching() (*runestone.Etching, error) {
+	if c.Etching == nil {
+		return nil, errors.New("Etching config is required")
+	}
+	if c.Etching.Rune == "" {
+		return nil, errors.New("Etching.Rune is required")
+	}
+	spacedRune, err := runestone.SpacedRuneFromString(c.Etching.Rune)
+	if err != nil {
+		return nil, err
+	}
+	etching := &runestone.Etching{Rune: &spacedRune.Rune}
+	if spacedRune.Spacers != 0 {
+		etching.Spacers = &spacedRune.Spacers
+	}
+	if c.Etching.Symbol != nil {
+		symbol := []rune(*c.Etching.Symbol)
+		if len(symbol) != 1 {
+			return nil, errors.New("Etching.Symbol must be one character")
+		}
+		etching.Symbol = &symbol[0]
+	}
+	if c.Etching.Divisibility != nil {
+		if *c.Etching.Divisibility < 0 || *c.Etching.Divisibility > runestone.MaxDivisibility {
+			return nil, fmt.Errorf("Etching.Divisibility must be between 0 and %d", runestone.MaxDivisibility)
+		}
+		divisibility := uint8(*c.Etching.Divisibility)
+		etching.Divisibility = &divisibility
+	}
+	amount := func(v *uint64) *uint128.Uint128 {
+		if v == nil {
+			return nil
+		}
+		u := uint128.From64(*v)
+		return &u
+	}
+	height := func(v *int) (*uint64, error) {
+		if v == nil {
+			return nil, nil
+		}
+		if *v < 0 {
+			return nil, errors.New("Etching heights and offsets must not be negative")
+		}
+		u := uint64(*v)
+		return &u, nil
+	}
+	etching.Premine = amount(c.Etching.Premine)
+	terms := &runestone.Terms{Amount: amount(c.Etching.Amount), Cap: amount(c.Etching.Cap)}
+	for i, v := range []*int{c.Etching.HeightStart, c.Etching.HeightEnd, c.Etching.HeightOffsetStart, c.Etching.HeightOffsetEnd} {
+		u, err := height(v)
+		if err != nil {
+			return nil, err
+		}
+		if i < 2 {
+			terms.Height[i] = u
+		} else {
+			terms.Offset[i-2] = u
+		}
+	}
+	if *terms != (runestone.Terms{}) {
+		etching.Terms = terms
+	}
+	return etching, nil
+}
+
+// GetRuneSource returns where mint terms and mint counts are looked up:
+// "ord" for the ord api at OrdUrl, "index" for the built-in index fed from
+// RpcUrl. It returns nil if no source is configured.
+func (c Config) GetRuneSource() (RuneSource, error) {
+	switch c.RuneSource {
+	case "":
+		return nil, nil
+	case "ord":
+		if c.OrdUrl == "" {
+			return nil, errors.New("OrdUrl is required")
+		}
+		return NewOrdConnector(c), nil
+	case "index":
+		source := newIndexRuneSource(NewMempoolConnector(c))
+		source.dir = c.IndexDir
+		return source, nil
+	}
+	return nil, fmt.Errorf("unknown RuneSource: %s", c.RuneSource)
+}
+
+// GetUtxoSource returns where utxos are found and transactions are sent:
+// "node" for the watch-only wallet of LocalRpcUrl, "esplora" for the api at
+// RpcUrl.
+func (c Config) GetUtxoSource() (UtxoSource, error) {
+	switch c.UtxoSource {
+	case "", "node":
+		return nodeUtxoSource{}, nil
+	case "esplora":
+		if c.RpcUrl == "" {
+			return nil, errors.New("RpcUrl is required")
+		}
+		return esploraUtxoSource{NewMempoolConnector(c)}, nil
+	}
+	return nil, fmt.Errorf("unknown UtxoSource: %s", c.UtxoSource)
+}
+
+// usesNodeWallet reports whether the mint addresses must be imported into
+// the watch-only wallet of the node.
+func (c Config) usesNodeWallet() bool {
+	return c.UtxoSource == "" || c.UtxoSource == "node"
+}
+
 func (c Config) GetNetwork() *chaincfg.Params {
 	if c.Network == "mainnet" {
 		return &chaincfg.MainNetParams
@@ -392,43 +566,302 @@ func (c Config) GetNetwork() *chaincfg.Params {
 	panic("unknown network")
 }
 
-func (c Config) GetPrivateKeyAddr() (*btcec.PrivateKey, string, error) {
-	if c.PrivateKey == "" {
-		return nil, "", errors.New("PrivateKey is required")
+// MintWallet is the key, or hd account, used by a mint worker. Address is
+// where utxos are first expected; hd wallets may also hold utxos on the other
+// addresses they have handed out.
+type MintWallet struct {
+	Name    string
+	Keys    KeySource // nil for a watch-only wallet
+	PubKeys PubKeySource
+	Address string
+
+	watch           []string // addresses of a single key, Address first
+	hd              *hdWallet
+	receive, change string // current rotated outputs of an hd wallet
+}
+
+// Addresses returns every address that may hold utxos of the wallet.
+func (w *MintWallet) Addresses() []string {
+	if w.hd == nil {
+		return w.watch
+	}
+	var addresses []string
+	for _, a := range w.hd.Addresses() {
+		addresses = append(addresses, a.Address)
+	}
+	return addresses
+}
+
+// Outputs returns the address of the mint output and, for hd wallets with
+// HDRotate set, a separate change address; otherwise change is empty and stays
+// in the mint output. rotate derives fresh addresses.
+func (w *MintWallet) Outputs(rotate bool) (receive, change string, err error) {
+	if w.hd == nil || config.HDRotate == "" {
+		return w.Address, "", nil
+	}
+	if rotate || w.receive == "" {
+		if w.receive, err = w.hd.Next(hdReceive); err != nil {
+			return "", "", err
+		}
+		if w.change, err = w.hd.Next(hdChange); err != nil {
+			return "", "", err
+		}
+	}
+	return w.receive, w.change, nil
+}
+
+func (c Config) GetKeystorePath() string {
+	if c.Keystore == "" {
+		return "keystore.json"
+	}
+	return c.Keystore
+}
+
+func (c Config) GetKeystore() (*Keystore, error) {
+	return LoadKeystore(c.GetKeystorePath())
+}
+
+func (c Config) GetHDState() (*hdState, error) {
+	path := c.HDState
+	if path == "" {
+		path = "hdwallet.json"
+	}
+	return loadHDState(path)
+}
+
+func (c Config) GetHDRotate() (string, error) {
+	switch c.HDRotate {
+	case "", "tx", "batch":
+		return c.HDRotate, nil
+	}
+	return "", fmt.Errorf("unknown HDRotate: %s", c.HDRotate)
+}
+
+// GetKeyNames returns Key followed by the Key of every entry of Wallets,
+// skipping duplicates. Plaintext private keys in the config are refused.
+func (c Config) GetKeyNames() ([]string, error) {
+	if c.PrivateKey != "" {
+		return nil, errors.New("PrivateKey in config.yaml is no longer supported, run `key import --from-config <name>` and set Key instead")
+	}
+	names := make([]string, 0, len(c.Wallets)+1)
+	if c.Key != "" {
+		names = append(names, c.Key)
+	}
+	for i, w := range c.Wallets {
+		if w.PrivateKey != "" {
+			return nil, fmt.Errorf("wallet %d: PrivateKey in config.yaml is no longer supported, run `key import --from-config <name>` and set Key instead", i)
+		}
+		if w.Key == "" {
+			return nil, fmt.Errorf("wallet %d: Key is required", i)
+		}
+		names = append(names, w.Key)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("Key or Wallets is required")
+	}
+	seen := make(map[string]bool)
+	unique := names[:0]
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique, nil
+}
+
+// GetMintAddresses returns the addresses of every mint wallet without
+// decrypting the keys.
+func (c Config) GetMintAddresses() ([]string, error) {
+	names, err := c.GetKeyNames()
+	if err != nil {
+		return nil, err
+	}
+	ks, err := c.GetKeystore()
+	if err != nil {
+		return nil, err
+	}
+	state, err := c.GetHDState()
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, name := range names {
+		key, err := ks.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if key.Type == keyTypeHD {
+			xpub, err := key.AccountXPub()
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", name, err)
+			}
+			hd, err := newHDWallet(name, xpub, c.GetNetwork(), state)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := hd.First(); err != nil {
+				return nil, err
+			}
+			for _, a := range hd.Addresses() {
+				addresses = append(addresses, a.Address)
+			}
+			continue
+		}
+		pubKey, err := key.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", name, err)
+		}
+		keyAddrs, err := c.keyAddresses(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, keyAddrs...)
+	}
+	return addresses, nil
+}
+
+// GetMintWallets decrypts the key of every mint wallet, asking for the
+// keystore passphrase once. Addresses newly derived by hd wallets are
+// imported into the watch-only wallet of the node.
+func (c Config) GetMintWallets() ([]*MintWallet, error) {
+	return c.mintWallets(true)
+}
+
+// GetWatchWallets is GetMintWallets without the private keys, for exporting
+// PSBTs. Keys is nil.
+func (c Config) GetWatchWallets() ([]*MintWallet, error) {
+	return c.mintWallets(false)
+}
+
+func (c Config) mintWallets(decrypt bool) ([]*MintWallet, error) {
+	names, err := c.GetKeyNames()
+	if err != nil {
+		return nil, err
 	}
-	pkBytes, err := hex.DecodeString(c.PrivateKey)
+	if _, err := c.GetHDRotate(); err != nil {
+		return nil, err
+	}
+	ks, err := c.GetKeystore()
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	state, err := c.GetHDState()
+	if err != nil {
+		return nil, err
+	}
+	wallets := make([]*MintWallet, 0, len(names))
+	for _, name := range names {
+		key, err := ks.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		var passphrase []byte
+		if decrypt {
+			if passphrase, err = getPassphrase(false); err != nil {
+				return nil, err
+			}
+		}
+		if key.Type == keyTypeHD {
+			var account *hdkeychain.ExtendedKey
+			if decrypt {
+				account, err = key.DecryptHD(passphrase)
+			} else {
+				account, err = key.AccountXPub()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", name, err)
+			}
+			hd, err := newHDWallet(name, account, c.GetNetwork(), state)
+			if err != nil {
+				return nil, err
+			}
+			if c.usesNodeWallet() {
+				hd.onNew = func(address string) error {
+					_, err := c.importAddress(address)
+					return err
+				}
+			}
+			address, err := hd.First()
+			if err != nil {
+				return nil, err
+			}
+			w := &MintWallet{Name: name, PubKeys: hd, Address: address, hd: hd}
+			if decrypt {
+				w.Keys = hd
+			}
+			wallets = append(wallets, w)
+			continue
+		}
+		w := &MintWallet{Name: name}
+		var pubKey *btcec.PublicKey
+		if decrypt {
+			privKey, err := key.Decrypt(passphrase)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", name, err)
+			}
+			w.Keys = singleKey{privKey}
+			pubKey = privKey.PubKey()
+		} else if pubKey, err = key.PublicKey(); err != nil {
+			return nil, fmt.Errorf("key %q: %w", name, err)
+		}
+		w.PubKeys = singlePubKey{pubKey}
+		if w.watch, err = c.keyAddresses(pubKey); err != nil {
+			return nil, err
+		}
+		w.Address = w.watch[0]
+		wallets = append(wallets, w)
 	}
-	privKey, pubKey := btcec.PrivKeyFromBytes(pkBytes)
+	return wallets, nil
+}
+
+// keyAddresses returns the taproot address of pubKey, used for mint outputs,
+// followed by its p2wpkh, p2sh-p2wpkh and p2pkh addresses, which may fund mints.
+func (c Config) keyAddresses(pubKey *btcec.PublicKey) ([]string, error) {
+	addrs, err := keyAddresses(pubKey, c.GetNetwork())
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
+	addresses := make([]string, len(addrs))
+	for i, addr := range addrs {
+		addresses[i] = addr.EncodeAddress()
+	}
+	return addresses, nil
+}
+
+// taprootAddress returns the key-path-only taproot address of pubKey.
+func (c Config) taprootAddress(pubKey *btcec.PublicKey) (string, error) {
 	tapKey := txscript.ComputeTaprootKeyNoScript(pubKey)
 	addr, err := btcutil.NewAddressTaproot(
 		schnorr.SerializePubKey(tapKey), c.GetNetwork(),
 	)
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
-	address := addr.EncodeAddress()
+	return addr.EncodeAddress(), nil
+}
 
-	return privKey, address, nil
+// GetRuneLogo reads the Etching.Logo file, if set, and detects its type.
+// GetRecoveryScript is the recovery leaf of the commit outputs of pk, nil
+// without RecoveryBlocks.
+func (c Config) GetRecoveryScript(pk *btcec.PublicKey) ([]byte, error) {
+	if c.RecoveryBlocks == 0 {
+		return nil, nil
+	}
+	return CreateRecoveryScript(pk, c.RecoveryBlocks)
 }
-func (c Config) GetRuneLogo() (mime string, data []byte) {
-	if c.Etching != nil && c.Etching.Logo != "" {
-		mime, err := getContentType(c.Etching.Logo)
-		if err != nil {
-			return "", nil
-		}
-		data, err := getFileBytes(c.Etching.Logo)
-		if err != nil {
-			return "", nil
-		}
-		return mime, data
 
+func (c Config) GetRuneLogo() (mime string, data []byte, err error) {
+	if c.Etching == nil || c.Etching.Logo == "" {
+		return "", nil, nil
 	}
-	return "", nil
+	if mime, err = getContentType(c.Etching.Logo); err != nil {
+		return "", nil, err
+	}
+	if data, err = getFileBytes(c.Etching.Logo); err != nil {
+		return "", nil, err
+	}
+	return mime, data, nil
 }
 
 func getContentType(filePath string) (string, error) {
@@ -438,13 +871,14 @@ func getContentType(filePath string) (string, error) {
 	}
 	defer file.Close()
 
+	// detect from what was read, zeros after the end of a small file look binary
 	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil {
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
 		return "", err
 	}
 
-	contentType := http.DetectContentType(buffer)
+	contentType := http.DetectContentType(buffer[:n])
 	return contentType, nil
 }
 func getFileBytes(filePath string) ([]byte, error) {
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+// txReport is what decode tells about a transaction.
+type txReport struct {
+	*txSummary
+	Inscription *inscriptionReport `json:"inscription,omitempty"`
+}
+
+type inscriptionReport struct {
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size"`
+	Text        string `json:"text,omitempty"` // only for text content
+	Error       string `json:"error,omitempty"`
+}
+
+func runDecode(args []string) {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	asJson := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		p.Printf("Usage: decode [--json] <tx hex|psbt|txid|file>\n")
+		os.Exit(2)
+	}
+	report, err := decodeTx(fs.Arg(0))
+	if err != nil {
+		p.Println(err.Error())
+		os.Exit(1)
+	}
+	if *asJson {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			p.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	printReport(report)
+}
+
+// decodeTx reads a transaction from input, a file or the text itself: raw hex,
+// a PSBT in binary or base64, or a txid fetched from the UtxoSource. The
+// outputs spent by a transaction that is not a PSBT are fetched from the
+// UtxoSource too, if it has them, for the fee.
+func decodeTx(input string) (*txReport, error) {
+	data := []byte(input)
+	if file, err := os.ReadFile(input); err == nil {
+		data = file
+	}
+	trimmed := bytes.TrimSpace(data)
+	var tx *wire.MsgTx
+	var prevOuts txscript.PrevOutputFetcher
+	switch {
+	case bytes.HasPrefix(data, []byte("psbt\xff")) || bytes.HasPrefix(trimmed, []byte("cHNidP")):
+		packet, err := parsePsbt(data)
+		if err != nil {
+			return nil, err
+		}
+		prevOuts = psbtPrevOuts(packet)
+		// signed PSBTs are decoded with their final witnesses
+		if tx, err = finalizePsbt(packet); err != nil {
+			tx = packet.UnsignedTx
+		}
+	case len(trimmed) == chainhash.MaxHashStringSize:
+		hash, err := chainhash.NewHashFromStr(string(trimmed))
+		if err != nil {
+			return nil, err
+		}
+		source, err := config.GetUtxoSource()
+		if err != nil {
+			return nil, err
+		}
+		if tx, err = source.GetRawTx(*hash); err != nil {
+			return nil, err
+		}
+	default:
+		raw, err := hex.DecodeString(string(trimmed))
+		if err != nil {
+			return nil, errors.New("input is neither a transaction, a PSBT nor a txid")
+		}
+		tx = wire.NewMsgTx(wire.TxVersion)
+		if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+			return nil, err
+		}
+	}
+	if prevOuts == nil {
+		prevOuts = fetchPrevOuts(tx)
+	}
+	report := &txReport{txSummary: summarizeTx(tx, prevOuts, config.GetNetwork(), runeLookup())}
+	contentType, content, err := GetInscriptionContent(tx)
+	switch {
+	case errors.Is(err, ErrNoInscription):
+	case err != nil:
+		report.Inscription = &inscriptionReport{Error: err.Error()}
+	default:
+		report.Inscription = &inscriptionReport{ContentType: contentType, Size: len(content)}
+		if isTextContent(contentType) && utf8.Valid(content) {
+			report.Inscription.Text = string(content)
+		}
+	}
+	return report, nil
+}
+
+// fetchPrevOuts returns the outputs spent by tx that the UtxoSource finds,
+// none if there is no UtxoSource.
+func fetchPrevOuts(tx *wire.MsgTx) txscript.PrevOutputFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	source, err := config.GetUtxoSource()
+	if err != nil {
+		return fetcher
+	}
+	prevTxs := map[chainhash.Hash]*wire.MsgTx{}
+	for _, in := range tx.TxIn {
+		outpoint := in.PreviousOutPoint
+		prevTx, ok := prevTxs[outpoint.Hash]
+		if !ok {
+			if prevTx, err = source.GetRawTx(outpoint.Hash); err != nil {
+				continue
+			}
+			prevTxs[outpoint.Hash] = prevTx
+		}
+		if int(outpoint.Index) < len(prevTx.TxOut) {
+			fetcher.AddPrevOut(outpoint, prevTx.TxOut[outpoint.Index])
+		}
+	}
+	return fetcher
+}
+
+// runeLookup returns the entries of the RuneSource, if one is configured.
+func runeLookup() func(runestone.RuneId) (*runestone.RuneEntry, bool) {
+	source, err := config.GetRuneSource()
+	if err != nil || source == nil {
+		return nil
+	}
+	return func(id runestone.RuneId) (*runestone.RuneEntry, bool) {
+		entry, err := source.GetRuneEntry(id)
+		return entry, err == nil && entry != nil
+	}
+}
+
+func isTextContent(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || strings.HasPrefix(contentType, "application/json")
+}
+
+func printReport(r *txReport) {
+	p.Printf("Transaction %s\n", r.Txid)
+	p.Printf("Size: %d vB, weight %d WU\n", r.Vsize, r.Weight)
+	if !r.Signed {
+		p.Printf("Not signed, sizes are estimated\n")
+	}
+	if r.Fee != nil {
+		p.Printf("Fee: %d sats (%.2f sat/vB)\n", *r.Fee, *r.FeeRate)
+	} else {
+		p.Printf("Fee: unknown, spent outputs not found\n")
+	}
+	p.Printf("Inputs:\n")
+	for _, in := range r.Inputs {
+		if in.Value != nil {
+			fmt.Printf("  %s %d %s\n", in.Outpoint, *in.Value, in.Address)
+		} else {
+			fmt.Printf("  %s\n", in.Outpoint)
+		}
+	}
+	p.Printf("Outputs:\n")
+	for i, out := range r.Outputs {
+		dest := out.Address
+		if dest == "" {
+			dest = out.Script
+		}
+		fmt.Printf("  %d %d %s\n", i, out.Value, dest)
+	}
+	switch x := r.Runestone; {
+	case r.RunestoneError != "":
+		p.Printf("Runestone: %s\n", r.RunestoneError)
+	case x == nil:
+	case x.Cenotaph:
+		p.Printf("Cenotaph: %s\n", x.Flaw)
+		if x.Etching != nil {
+			p.Printf("  Etching %s burned\n", x.Etching.Rune)
+		}
+		if x.Mint != nil {
+			p.Printf("  Mint %s %s burned\n", x.Mint.ID, x.Mint.Rune)
+		}
+	default:
+		p.Printf("Runestone:\n")
+		if e := x.Etching; e != nil {
+			p.Printf("  Etching %s, symbol %s, divisibility %d, premine %s\n", e.Rune, e.Symbol, e.Divisibility, e.Premine)
+			if t := e.Terms; t != nil {
+				p.Printf("  Terms: amount %s, cap %s, height %s, offset %s\n", t.Amount, t.Cap, formatRange(t.Height), formatRange(t.Offset))
+			}
+		}
+		if x.Mint != nil {
+			p.Printf("  Mint %s %s %s\n", x.Mint.ID, x.Mint.Rune, x.Mint.Amount)
+		}
+		for _, edict := range x.Edicts {
+			p.Printf("  Edict %s %s %s to output %d\n", edict.ID, edict.Rune, edict.Amount, edict.Output)
+		}
+		if x.Pointer != nil {
+			p.Printf("  Pointer: output %d\n", *x.Pointer)
+		}
+	}
+	if in := r.Inscription; in != nil {
+		if in.Error != "" {
+			p.Printf("Inscription: %s\n", in.Error)
+		} else {
+			p.Printf("Inscription: %s, %d bytes\n", in.ContentType, in.Size)
+			if in.Text != "" {
+				fmt.Println(in.Text)
+			}
+		}
+	}
+}
+
+// formatRange shows an optional [start, end) range of heights.
+func formatRange(r [2]*uint64) string {
+	bound := func(b *uint64) string {
+		if b == nil {
+			return "-"
+		}
+		return fmt.Sprint(*b)
+	}
+	return "[" + bound(r[0]) + ", " + bound(r[1]) + ")"
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescriptorChecksum(t *testing.T) {
+	// vectors from BIP 380 and Bitcoin Core
+	for _, desc := range []string{
+		"addr(mkmZxiEcEd8ZqjQWVZuC6so5dFMKEFpN2j)#02wpgw69",
+		"raw(deadbeef)#89f8spxm",
+	} {
+		checksummed, err := withChecksum(desc[:len(desc)-9])
+		require.NoError(t, err)
+		assert.Equal(t, desc, checksummed)
+	}
+
+	// the checksum covers every character
+	checksum, err := descriptorChecksum("raw(deadbeee)")
+	require.NoError(t, err)
+	assert.NotEqual(t, "89f8spxm", checksum)
+
+	_, err = descriptorChecksum("raw(deadbeef)\n")
+	assert.ErrorContains(t, err, "invalid character")
+}
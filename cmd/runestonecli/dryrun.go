@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+// txSummary is the JSON written next to every transaction of a dry run, for
+// review before broadcast.
+type txSummary struct {
+	Txid           string                 `json:"txid"`
+	Inputs         []txSummaryIn          `json:"inputs"`
+	Outputs        []txSummaryOut         `json:"outputs"`
+	Fee            *int64                 `json:"fee,omitempty"` // unknown without every spent output
+	FeeRate        *float64               `json:"fee_rate,omitempty"`
+	Vsize          int64                  `json:"vsize"`
+	Weight         int64                  `json:"weight"`
+	Signed         bool                   `json:"signed"` // sizes of unsigned transactions are estimated
+	Runestone      *runestone.Explanation `json:"runestone,omitempty"`
+	RunestoneError string                 `json:"runestone_error,omitempty"`
+}
+
+type txSummaryIn struct {
+	Outpoint string `json:"outpoint"`
+	Value    *int64 `json:"value,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+type txSummaryOut struct {
+	Value   int64  `json:"value"`
+	Address string `json:"address,omitempty"`
+	Script  string `json:"script"`
+}
+
+// summarizeTx describes tx. prevOuts may lack some spent outputs, then the fee
+// is left out. lookup names the runes of the runestone and may be nil, as for
+// runestone.Explain.
+func summarizeTx(tx *wire.MsgTx, prevOuts txscript.PrevOutputFetcher, net *chaincfg.Params, lookup func(runestone.RuneId) (*runestone.RuneEntry, bool)) *txSummary {
+	s := &txSummary{Txid: tx.TxHash().String(), Signed: true}
+	sized := tx
+	for _, in := range tx.TxIn {
+		if len(in.Witness) == 0 && len(in.SignatureScript) == 0 {
+			s.Signed = false
+		}
+	}
+	if !s.Signed {
+		sized = tx.Copy()
+	}
+	inValue, known := int64(0), true
+	for i, in := range tx.TxIn {
+		sin := txSummaryIn{Outpoint: in.PreviousOutPoint.String()}
+		var prevOut *wire.TxOut
+		if prevOuts != nil {
+			prevOut = prevOuts.FetchPrevOutput(in.PreviousOutPoint)
+		}
+		if prevOut == nil {
+			known = false
+			s.Inputs = append(s.Inputs, sin)
+			continue
+		}
+		value := prevOut.Value
+		sin.Value = &value
+		sin.Address = scriptAddress(prevOut.PkScript, net)
+		sin.Type = classifyInput(prevOut.PkScript).String()
+		inValue += value
+		if !s.Signed {
+			mockSignInput(sized.TxIn[i], prevOut.PkScript)
+		}
+		s.Inputs = append(s.Inputs, sin)
+	}
+	outValue := int64(0)
+	for _, out := range tx.TxOut {
+		s.Outputs = append(s.Outputs, txSummaryOut{
+			Value:   out.Value,
+			Address: scriptAddress(out.PkScript, net),
+			Script:  hex.EncodeToString(out.PkScript),
+		})
+		outValue += out.Value
+	}
+	s.Weight = blockchain.GetTransactionWeight(btcutil.NewTx(sized))
+	s.Vsize = (s.Weight + 3) / 4
+	if known {
+		fee := inValue - outValue
+		rate := float64(fee) / float64(s.Vsize)
+		s.Fee, s.FeeRate = &fee, &rate
+	}
+	explanation, err := runestone.Explain(tx, lookup)
+	s.Runestone = explanation
+	if err != nil {
+		s.RunestoneError = err.Error()
+	}
+	return s
+}
+
+func scriptAddress(pkScript []byte, net *chaincfg.Params) string {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, net)
+	if err != nil || len(addrs) != 1 {
+		return ""
+	}
+	return addrs[0].EncodeAddress()
+}
+
+// writeTxFiles writes a transaction to <dir>/<name>.hex, or a PSBT to
+// <dir>/<name>.psbt, with its summary in <dir>/<name>.json.
+func writeTxFiles(dir, name string, data []byte, isPsbt bool, tx *wire.MsgTx, prevOuts txscript.PrevOutputFetcher) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, name+".hex")
+	content := []byte(hex.EncodeToString(data) + "\n")
+	if isPsbt {
+		file, content = filepath.Join(dir, name+".psbt"), data
+	}
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		return err
+	}
+	summary, err := json.MarshalIndent(summarizeTx(tx, prevOuts, config.GetNetwork(), runeLookup()), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), append(summary, '\n'), 0600); err != nil {
+		return err
+	}
+	fmt.Println(i18n("WriteTxToFile"), file)
+	return nil
+}
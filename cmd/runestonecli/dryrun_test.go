@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"lukechampine.com/uint128"
+)
+
+func TestSummarizeUnsignedTx(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	utxos := keyUtxos(t, key)
+	tx := wire.NewMsgTx(2)
+	for _, utxo := range utxos {
+		outpoint := utxo.OutPoint()
+		tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(399000, utxos[0].PkScript))
+
+	s := summarizeTx(tx, UtxoList(utxos), &chaincfg.RegressionNetParams, nil)
+	assert.False(t, s.Signed)
+	assert.Equal(t, tx.TxHash().String(), s.Txid)
+	require.Len(t, s.Inputs, 4)
+	for i, in := range s.Inputs {
+		assert.Equal(t, classifyInput(utxos[i].PkScript).String(), in.Type)
+		require.NotNil(t, in.Value)
+		assert.Equal(t, int64(100000), *in.Value)
+		assert.NotEmpty(t, in.Address)
+	}
+	require.NotNil(t, s.Fee)
+	assert.Equal(t, int64(1000), *s.Fee)
+	assert.Equal(t, float64(1000)/float64(s.Vsize), *s.FeeRate)
+	assert.Nil(t, s.Runestone)
+
+	// the sizes are those of the transaction once signed, give or take the
+	// length of the DER signatures
+	_, err = signCommitTx(singleKey{key}, utxos, tx)
+	require.NoError(t, err)
+	signed := mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+	assert.GreaterOrEqual(t, s.Vsize, signed)
+	assert.LessOrEqual(t, s.Vsize-signed, int64(3))
+	assert.Equal(t, (s.Weight+3)/4, s.Vsize)
+
+	s = summarizeTx(tx, UtxoList(utxos), &chaincfg.RegressionNetParams, nil)
+	assert.True(t, s.Signed)
+	assert.Equal(t, signed, s.Vsize)
+}
+
+func TestSummarizeTxUnknownInputs(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	utxos := keyUtxos(t, key)
+	tx := wire.NewMsgTx(2)
+	for _, utxo := range utxos[:2] {
+		outpoint := utxo.OutPoint()
+		tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(150000, utxos[0].PkScript))
+
+	s := summarizeTx(tx, UtxoList(utxos[:1]), &chaincfg.RegressionNetParams, nil)
+	assert.Nil(t, s.Fee)
+	assert.Nil(t, s.FeeRate)
+	assert.NotNil(t, s.Inputs[0].Value)
+	assert.Nil(t, s.Inputs[1].Value)
+	assert.Empty(t, s.Inputs[1].Type)
+	s = summarizeTx(tx, nil, &chaincfg.RegressionNetParams, nil)
+	assert.Nil(t, s.Fee)
+}
+
+func TestSummarizeTxRunestone(t *testing.T) {
+	id := runestone.RuneId{Block: 840000, Tx: 1}
+	edict, err := (&runestone.Runestone{Edicts: []runestone.Edict{{ID: id, Amount: uint128.From64(1000), Output: 1}}}).Encipher()
+	require.NoError(t, err)
+	// output 5 does not exist, the runes would be burned
+	cenotaph, err := (&runestone.Runestone{Edicts: []runestone.Edict{{ID: id, Output: 5}}}).Encipher()
+	require.NoError(t, err)
+	// a varint running past the end of the payload
+	truncated, err := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).AddOp(runestone.MAGIC_NUMBER).AddData([]byte{0x80}).Script()
+	require.NoError(t, err)
+	other, err := txscript.NullDataScript([]byte("hello"))
+	require.NoError(t, err)
+
+	summarize := func(pkScript []byte) *txSummary {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(0, pkScript))
+		tx.AddTxOut(wire.NewTxOut(546, pkScript))
+		return summarizeTx(tx, nil, &chaincfg.RegressionNetParams, nil)
+	}
+	s := summarize(edict)
+	require.NotNil(t, s.Runestone)
+	assert.False(t, s.Runestone.Cenotaph)
+	assert.Equal(t, []runestone.EdictExplanation{{ID: "840000:1", Amount: "1000", Output: 1}}, s.Runestone.Edicts)
+	assert.Empty(t, s.RunestoneError)
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"edicts":[{"id":"840000:1","amount":"1000","output":1}]`)
+
+	s = summarize(cenotaph)
+	require.NotNil(t, s.Runestone)
+	assert.True(t, s.Runestone.Cenotaph)
+	assert.Equal(t, runestone.EdictOutput.String(), s.Runestone.Flaw)
+
+	s = summarize(truncated)
+	require.NotNil(t, s.Runestone)
+	assert.True(t, s.Runestone.Cenotaph)
+	assert.Equal(t, runestone.Varint.String(), s.Runestone.Flaw)
+
+	assert.Nil(t, summarize(other).Runestone)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"lukechampine.com/uint128"
+)
+
+// envelopeProtocolId follows OP_FALSE OP_IF at the start of an envelope.
+var envelopeProtocolId = []byte("ord")
+
+// Envelope tags, as defined by ord. Even tags that are not known make an
+// inscription unbound.
+const (
+	TagContentType     = 1
+	TagPointer         = 2
+	TagParent          = 3
+	TagMetadata        = 5
+	TagMetaprotocol    = 7
+	TagContentEncoding = 9
+	TagDelegate        = 11
+	TagRune            = 13
+)
+
+// InscriptionId is the txid of the reveal transaction and the index of the
+// envelope in it.
+type InscriptionId struct {
+	Txid  chainhash.Hash
+	Index uint32
+}
+
+func (id InscriptionId) String() string {
+	return fmt.Sprintf("%si%d", id.Txid, id.Index)
+}
+
+// InscriptionIdFromString parses an id of the form <txid>i<index>.
+func InscriptionIdFromString(s string) (InscriptionId, error) {
+	txid, index, ok := strings.Cut(s, "i")
+	if !ok || len(txid) != chainhash.MaxHashStringSize {
+		return InscriptionId{}, fmt.Errorf("invalid inscription id %q", s)
+	}
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return InscriptionId{}, fmt.Errorf("invalid inscription id %q: %w", s, err)
+	}
+	n, err := strconv.ParseUint(index, 10, 32)
+	if err != nil {
+		return InscriptionId{}, fmt.Errorf("invalid inscription id %q: %w", s, err)
+	}
+	return InscriptionId{Txid: *hash, Index: uint32(n)}, nil
+}
+
+// Envelope is an inscription as ord reads it from the tapscript of an input.
+// Fields that are absent or malformed are nil.
+type Envelope struct {
+	Input  int // index of the input
+	Offset int // index of the envelope in the tapscript of the input
+
+	Body            []byte
+	ContentType     []byte
+	ContentEncoding []byte
+	Metaprotocol    []byte
+	Metadata        []byte // CBOR, concatenated from every metadata field
+	Pointer         *uint64
+	Parents         []InscriptionId
+	Delegate        *InscriptionId
+	Rune            *runestone.Rune
+
+	// DuplicateField is set when a tag appears twice, IncompleteField when the
+	// last tag has no value and UnrecognizedEvenField when an even tag is not
+	// known. Pushnum marks envelopes with OP_1NEGATE..OP_16 instead of pushes;
+	// Stutter an OP_FALSE repeated before the envelope.
+	DuplicateField        bool
+	IncompleteField       bool
+	UnrecognizedEvenField bool
+	Pushnum               bool
+	Stutter               bool
+}
+
+// ParseEnvelopes returns the envelopes of every input of tx, in order. An input
+// whose tapscript does not parse has none.
+func ParseEnvelopes(tx *wire.MsgTx) []*Envelope {
+	var envelopes []*Envelope
+	for i, in := range tx.TxIn {
+		script := witnessTapscript(in.Witness)
+		if script == nil {
+			continue
+		}
+		found, err := ParseTapscriptEnvelopes(script, i)
+		if err != nil {
+			continue
+		}
+		envelopes = append(envelopes, found...)
+	}
+	return envelopes
+}
+
+// witnessTapscript returns the script of a script path spend: the element
+// before the control block, skipping the annex.
+func witnessTapscript(witness wire.TxWitness) []byte {
+	n := len(witness)
+	if n >= 2 && len(witness[n-1]) > 0 && witness[n-1][0] == txscript.TaprootAnnexTag {
+		n--
+	}
+	if n < 2 {
+		return nil
+	}
+	return witness[n-2]
+}
+
+// ParseTapscriptEnvelopes tokenizes script and returns its envelopes, each an
+// OP_FALSE OP_IF "ord" followed by pushes up to OP_ENDIF.
+func ParseTapscriptEnvelopes(script []byte, input int) ([]*Envelope, error) {
+	tokens, err := tokenizeScript(script)
+	if err != nil {
+		return nil, err
+	}
+	var envelopes []*Envelope
+	stuttered := false
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].isEmptyPush() {
+			continue
+		}
+		payload, pushnum, next, stutter, ok := envelopePayload(tokens, i+1)
+		i = next - 1
+		if !ok {
+			stuttered = stutter
+			continue
+		}
+		envelope := parseEnvelopePayload(payload)
+		envelope.Input, envelope.Offset = input, len(envelopes)
+		envelope.Pushnum, envelope.Stutter = pushnum, stuttered
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes, nil
+}
+
+type scriptToken struct {
+	opcode byte
+	data   []byte
+}
+
+func (t scriptToken) isPush() bool {
+	return t.opcode <= txscript.OP_PUSHDATA4
+}
+
+func (t scriptToken) isEmptyPush() bool {
+	return t.isPush() && len(t.data) == 0
+}
+
+func tokenizeScript(script []byte) ([]scriptToken, error) {
+	var tokens []scriptToken
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		tokens = append(tokens, scriptToken{opcode: tokenizer.Opcode(), data: tokenizer.Data()})
+	}
+	return tokens, tokenizer.Err()
+}
+
+// envelopePayload reads the envelope whose OP_FALSE precedes tokens[start].
+// It returns the pushes after the protocol id and the index of the token after
+// the last one read, which ends the envelope or shows there is none. stutter
+// reports whether a failed envelope is followed by another OP_FALSE.
+func envelopePayload(tokens []scriptToken, start int) (payload [][]byte, pushnum bool, next int, stutter, ok bool) {
+	i := start
+	if i >= len(tokens) || tokens[i].opcode != txscript.OP_IF {
+		return nil, false, i, i < len(tokens) && tokens[i].isEmptyPush(), false
+	}
+	i++
+	if i >= len(tokens) || !tokens[i].isPush() || !bytes.Equal(tokens[i].data, envelopeProtocolId) {
+		return nil, false, i, i < len(tokens) && tokens[i].isEmptyPush(), false
+	}
+	payload = [][]byte{}
+	for i++; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case token.opcode == txscript.OP_ENDIF:
+			return payload, pushnum, i + 1, false, true
+		case token.opcode == txscript.OP_1NEGATE:
+			pushnum = true
+			payload = append(payload, []byte{0x81})
+		case token.opcode >= txscript.OP_1 && token.opcode <= txscript.OP_16:
+			pushnum = true
+			payload = append(payload, []byte{token.opcode - txscript.OP_1 + 1})
+		case token.isPush():
+			// an empty value is still a value
+			payload = append(payload, append([]byte{}, token.data...))
+		default:
+			return nil, false, i + 1, false, false
+		}
+	}
+	// no OP_ENDIF
+	return nil, false, i, false, false
+}
+
+// parseEnvelopePayload splits the payload into tag and value pairs up to the
+// first empty push at an even position; the pushes after it are the body.
+func parseEnvelopePayload(payload [][]byte) *Envelope {
+	envelope := &Envelope{}
+	end := len(payload)
+	for i := 0; i < len(payload); i += 2 {
+		if len(payload[i]) == 0 {
+			end = i
+			envelope.Body = []byte{}
+			for _, push := range payload[i+1:] {
+				envelope.Body = append(envelope.Body, push...)
+			}
+			break
+		}
+	}
+	fields := map[string][][]byte{}
+	var tags []string
+	for i := 0; i < end; i += 2 {
+		if i+1 == end {
+			envelope.IncompleteField = true
+			break
+		}
+		tag := string(payload[i])
+		if _, ok := fields[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		fields[tag] = append(fields[tag], payload[i+1])
+	}
+	for _, values := range fields {
+		if len(values) > 1 {
+			envelope.DuplicateField = true
+		}
+	}
+	// take removes the first value of tag, as ord does; the duplicates stay,
+	// and make an even tag unrecognized
+	take := func(tag byte) []byte {
+		values := fields[string([]byte{tag})]
+		if len(values) == 0 {
+			return nil
+		}
+		fields[string([]byte{tag})] = values[1:]
+		return values[0]
+	}
+	takeAll := func(tag byte) [][]byte {
+		values := fields[string([]byte{tag})]
+		delete(fields, string([]byte{tag}))
+		return values
+	}
+	envelope.ContentEncoding = take(TagContentEncoding)
+	envelope.ContentType = take(TagContentType)
+	envelope.Delegate = parseInscriptionIdField(take(TagDelegate))
+	if chunks := takeAll(TagMetadata); chunks != nil {
+		envelope.Metadata = []byte{}
+		for _, chunk := range chunks {
+			envelope.Metadata = append(envelope.Metadata, chunk...)
+		}
+	}
+	envelope.Metaprotocol = take(TagMetaprotocol)
+	for _, value := range takeAll(TagParent) {
+		if id := parseInscriptionIdField(value); id != nil {
+			envelope.Parents = append(envelope.Parents, *id)
+		}
+	}
+	envelope.Pointer = parsePointerField(take(TagPointer))
+	envelope.Rune = parseRuneField(take(TagRune))
+	for _, tag := range tags {
+		if len(fields[tag]) > 0 && tag[0]%2 == 0 {
+			envelope.UnrecognizedEvenField = true
+		}
+	}
+	return envelope
+}
+
+// parseInscriptionIdField reads a txid followed by the index in little endian,
+// either in 4 bytes or without trailing zeros.
+func parseInscriptionIdField(value []byte) *InscriptionId {
+	if len(value) < chainhash.HashSize || len(value) > chainhash.HashSize+4 {
+		return nil
+	}
+	index := value[chainhash.HashSize:]
+	if len(index) > 0 && len(index) != 4 && index[len(index)-1] == 0 {
+		return nil
+	}
+	id := &InscriptionId{}
+	copy(id.Txid[:], value[:chainhash.HashSize])
+	var le [4]byte
+	copy(le[:], index)
+	id.Index = binary.LittleEndian.Uint32(le[:])
+	return id
+}
+
+// parsePointerField reads a little endian integer that fits in 64 bits.
+func parsePointerField(value []byte) *uint64 {
+	if value == nil {
+		return nil
+	}
+	for i := 8; i < len(value); i++ {
+		if value[i] != 0 {
+			return nil
+		}
+	}
+	var le [8]byte
+	copy(le[:], value)
+	pointer := binary.LittleEndian.Uint64(le[:])
+	return &pointer
+}
+
+// parseRuneField reads the little endian value of the rune a reveal etches.
+func parseRuneField(value []byte) *runestone.Rune {
+	if value == nil || len(value) > 16 {
+		return nil
+	}
+	var le [16]byte
+	copy(le[:], value)
+	r := runestone.NewRune(uint128.FromBytes(le[:]))
+	return &r
+}
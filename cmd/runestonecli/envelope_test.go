@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"lukechampine.com/uint128"
+)
+
+// The vectors follow the envelope tests of ord.
+
+// pushes encodes each item as a data push, as rust-bitcoin's push_slice does.
+func pushes(items ...[]byte) []byte {
+	var script []byte
+	for _, item := range items {
+		script = appendPush(script, item)
+	}
+	return script
+}
+
+func envelopeScript(payload ...[]byte) []byte {
+	script := []byte{txscript.OP_FALSE, txscript.OP_IF}
+	script = append(script, pushes(payload...)...)
+	return append(script, txscript.OP_ENDIF)
+}
+
+// envelope is a witness spending envelopeScript(payload...).
+func envelope(payload ...[]byte) wire.TxWitness {
+	return wire.TxWitness{envelopeScript(payload...), {}}
+}
+
+func parseWitnesses(witnesses ...wire.TxWitness) []*Envelope {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for _, witness := range witnesses {
+		in := wire.NewTxIn(&wire.OutPoint{}, nil, witness)
+		tx.AddTxIn(in)
+	}
+	return ParseEnvelopes(tx)
+}
+
+var (
+	ord       = []byte("ord")
+	textPlain = []byte("text/plain;charset=utf-8")
+)
+
+func TestParseEnvelopesEmpty(t *testing.T) {
+	assert.Empty(t, parseWitnesses(wire.TxWitness{}))
+	assert.Empty(t, parseWitnesses(wire.TxWitness{{}, {}}))
+}
+
+func TestParseEnvelopesIgnoresKeyPathSpends(t *testing.T) {
+	script := envelopeScript(ord)
+	assert.Empty(t, parseWitnesses(wire.TxWitness{script}))
+	assert.Empty(t, parseWitnesses(wire.TxWitness{script, {txscript.TaprootAnnexTag}}))
+}
+
+func TestParseEnvelopesFromTapscript(t *testing.T) {
+	script := envelopeScript(ord)
+	assert.Equal(t, []*Envelope{{}}, parseWitnesses(wire.TxWitness{script, {}}))
+	assert.Equal(t, []*Envelope{{}}, parseWitnesses(wire.TxWitness{script, {}, {txscript.TaprootAnnexTag}}))
+}
+
+func TestParseEnvelopesIgnoresUnparsableScripts(t *testing.T) {
+	script := append([]byte{txscript.OP_FALSE, txscript.OP_IF}, pushes(ord)...)
+	script = append(script, txscript.OP_ENDIF, txscript.OP_DATA_1)
+	assert.Empty(t, parseWitnesses(wire.TxWitness{script, {}}))
+}
+
+func TestParseEnvelopeFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload [][]byte
+		want    *Envelope
+	}{
+		{"duplicate field", [][]byte{ord, {255}, {}, {255}, {}},
+			&Envelope{DuplicateField: true}},
+		{"content type", [][]byte{ord, {1}, textPlain, {}, ord},
+			&Envelope{ContentType: textPlain, Body: ord}},
+		{"content encoding", [][]byte{ord, {1}, textPlain, {9}, []byte("br"), {}, ord},
+			&Envelope{ContentType: textPlain, ContentEncoding: []byte("br"), Body: ord}},
+		{"unknown odd tag", [][]byte{ord, {1}, textPlain, {255}, []byte("bar"), {}, ord},
+			&Envelope{ContentType: textPlain, Body: ord}},
+		{"unknown even tag", [][]byte{ord, {22}, {0}, {}, ord},
+			&Envelope{Body: ord, UnrecognizedEvenField: true}},
+		{"duplicate even tag", [][]byte{ord, {2}, {1}, {2}, {2}},
+			&Envelope{Pointer: uint64P(1), DuplicateField: true, UnrecognizedEvenField: true}},
+		{"no body", [][]byte{ord, {1}, textPlain},
+			&Envelope{ContentType: textPlain}},
+		{"no content type", [][]byte{ord, {}, []byte("foo")},
+			&Envelope{Body: []byte("foo")}},
+		{"body in multiple pushes", [][]byte{ord, {1}, textPlain, {}, []byte("foo"), []byte("bar")},
+			&Envelope{ContentType: textPlain, Body: []byte("foobar")}},
+		{"body in zero pushes", [][]byte{ord, {1}, textPlain, {}},
+			&Envelope{ContentType: textPlain, Body: []byte{}}},
+		{"body in empty pushes", [][]byte{ord, {1}, textPlain, {}, {}, {}, {}, {}, {}},
+			&Envelope{ContentType: textPlain, Body: []byte{}}},
+		{"incomplete field", [][]byte{ord, {99}},
+			&Envelope{IncompleteField: true}},
+		{"empty metadata", [][]byte{ord, {5}, {}},
+			&Envelope{Metadata: []byte{}}},
+		{"metadata in chunks", [][]byte{ord, {5}, {0}, {5}, {1}},
+			&Envelope{Metadata: []byte{0, 1}, DuplicateField: true}},
+		{"metaprotocol", [][]byte{ord, {7}, []byte("brc-20")},
+			&Envelope{Metaprotocol: []byte("brc-20")}},
+		{"pointer", [][]byte{ord, {2}, {1, 2}},
+			&Envelope{Pointer: uint64P(0x0201)}},
+		{"rune", [][]byte{ord, {13}, {1, 1}},
+			&Envelope{Rune: runeP(0x0101)}},
+		{"large rune", [][]byte{ord, {13}, bytes.Repeat([]byte{1}, 17)},
+			&Envelope{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, []*Envelope{test.want}, parseWitnesses(envelope(test.payload...)))
+		})
+	}
+}
+
+func TestParseEnvelopeParentsAndDelegate(t *testing.T) {
+	txid := bytes.Repeat([]byte{1}, chainhash.HashSize)
+	parent := func(index ...byte) []byte {
+		return append(append([]byte{}, txid...), index...)
+	}
+	hash, _ := chainhash.NewHash(txid)
+
+	envelopes := parseWitnesses(envelope(ord, []byte{3}, parent(), []byte{3}, parent(1), []byte{3}, parent(0), []byte{11}, parent(2, 0, 0, 0)))
+	assert.Len(t, envelopes, 1)
+	assert.Equal(t, []InscriptionId{{Txid: *hash}, {Txid: *hash, Index: 1}}, envelopes[0].Parents)
+	assert.Equal(t, &InscriptionId{Txid: *hash, Index: 2}, envelopes[0].Delegate)
+	assert.True(t, envelopes[0].DuplicateField)
+
+	assert.Nil(t, parseInscriptionIdField(txid[1:]))
+	assert.Nil(t, parseInscriptionIdField(parent(1, 0)))
+	assert.Nil(t, parseInscriptionIdField(parent(1, 0, 0, 0, 0)))
+	assert.Equal(t, &InscriptionId{Txid: *hash, Index: 0x01000001}, parseInscriptionIdField(parent(1, 0, 0, 1)))
+	assert.Equal(t, "0101010101010101010101010101010101010101010101010101010101010101i1", InscriptionId{Txid: *hash, Index: 1}.String())
+}
+
+func TestInscriptionIdFromString(t *testing.T) {
+	hash, _ := chainhash.NewHash(bytes.Repeat([]byte{1}, chainhash.HashSize))
+	id := InscriptionId{Txid: *hash, Index: 7}
+	parsed, err := InscriptionIdFromString(id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, id, parsed)
+
+	for _, s := range []string{"", "i0", hash.String(), hash.String() + "i", hash.String() + "i-1", hash.String()[1:] + "i0"} {
+		_, err := InscriptionIdFromString(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParsePointerField(t *testing.T) {
+	assert.Nil(t, parsePointerField(nil))
+	assert.Equal(t, uint64P(0), parsePointerField([]byte{}))
+	assert.Equal(t, uint64P(0), parsePointerField([]byte{0}))
+	assert.Equal(t, uint64P(0x0807060504030201), parsePointerField([]byte{1, 2, 3, 4, 5, 6, 7, 8}))
+	assert.Equal(t, uint64P(0x060504030201), parsePointerField([]byte{1, 2, 3, 4, 5, 6}))
+	assert.Equal(t, uint64P(0x0807060504030201), parsePointerField([]byte{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0, 0}))
+	assert.Nil(t, parsePointerField([]byte{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0, 1}))
+	assert.Nil(t, parsePointerField([]byte{1, 2, 3, 4, 5, 6, 7, 8, 1}))
+}
+
+func TestParseEnvelopesIgnoresInvalidEnvelopes(t *testing.T) {
+	noEndif := append([]byte{txscript.OP_FALSE, txscript.OP_IF}, pushes(ord)...)
+	noOpFalse := append([]byte{txscript.OP_IF}, pushes(ord)...)
+	noOpFalse = append(noOpFalse, txscript.OP_ENDIF)
+	opcode := append([]byte{txscript.OP_FALSE, txscript.OP_IF}, pushes(ord)...)
+	opcode = append(opcode, txscript.OP_CHECKSIG, txscript.OP_ENDIF)
+	for name, script := range map[string][]byte{
+		"no endif":            noEndif,
+		"no op_false":         noOpFalse,
+		"empty envelope":      envelopeScript(),
+		"wrong protocol":      envelopeScript([]byte("foo")),
+		"non-push in payload": opcode,
+	} {
+		assert.Empty(t, parseWitnesses(wire.TxWitness{script, {}}), name)
+	}
+}
+
+func TestParseEnvelopesIgnoresSurroundingOpcodes(t *testing.T) {
+	payload := [][]byte{ord, {1}, textPlain, {}, ord}
+	want := []*Envelope{{ContentType: textPlain, Body: ord}}
+
+	trailing := append(envelopeScript(payload...), txscript.OP_CHECKSIG)
+	assert.Equal(t, want, parseWitnesses(wire.TxWitness{trailing, {}}))
+	preceding := append([]byte{txscript.OP_CHECKSIG}, envelopeScript(payload...)...)
+	assert.Equal(t, want, parseWitnesses(wire.TxWitness{preceding, {}}))
+	// OP_FALSE OP_IF inside an invalid envelope does not start another one
+	nested := append([]byte{txscript.OP_FALSE, txscript.OP_IF}, pushes(ord)...)
+	nested = append(nested, txscript.OP_NOP, txscript.OP_IF)
+	nested = append(nested, pushes(ord)...)
+	nested = append(nested, txscript.OP_ENDIF)
+	assert.Empty(t, parseWitnesses(wire.TxWitness{nested, {}}))
+}
+
+func TestParseEnvelopesInOneWitness(t *testing.T) {
+	script := append(envelopeScript(ord, []byte{1}, textPlain, []byte{}, []byte("foo")),
+		envelopeScript(ord, []byte{1}, textPlain, []byte{}, []byte("bar"))...)
+	assert.Equal(t, []*Envelope{
+		{ContentType: textPlain, Body: []byte("foo")},
+		{ContentType: textPlain, Body: []byte("bar"), Offset: 1},
+	}, parseWitnesses(wire.TxWitness{script, {}}))
+}
+
+func TestParseEnvelopesInSeveralInputs(t *testing.T) {
+	assert.Equal(t, []*Envelope{
+		{ContentType: textPlain, Body: []byte("foo")},
+		{ContentType: textPlain, Body: []byte("bar"), Input: 2},
+	}, parseWitnesses(
+		envelope(ord, []byte{1}, textPlain, []byte{}, []byte("foo")),
+		wire.TxWitness{},
+		envelope(ord, []byte{1}, textPlain, []byte{}, []byte("bar")),
+	))
+}
+
+func TestParseEnvelopesPushnum(t *testing.T) {
+	pushnums := map[byte]byte{txscript.OP_1NEGATE: 0x81, txscript.OP_1: 1, txscript.OP_2: 2, txscript.OP_16: 16}
+	for op, value := range pushnums {
+		script := append([]byte{txscript.OP_FALSE, txscript.OP_IF}, pushes(ord)...)
+		script = append(script, txscript.OP_FALSE, op, txscript.OP_ENDIF)
+		assert.Equal(t, []*Envelope{{Body: []byte{value}, Pushnum: true}},
+			parseWitnesses(wire.TxWitness{script, {}}))
+	}
+}
+
+func TestParseEnvelopesStutter(t *testing.T) {
+	tests := []struct {
+		prefix  []byte
+		stutter bool
+	}{
+		{[]byte{txscript.OP_FALSE}, true},
+		{[]byte{txscript.OP_FALSE, txscript.OP_IF}, true},
+		{[]byte{txscript.OP_FALSE, txscript.OP_IF, txscript.OP_FALSE, txscript.OP_IF}, true},
+		{[]byte{txscript.OP_FALSE, txscript.OP_AND}, false},
+	}
+	for _, test := range tests {
+		script := append(append([]byte{}, test.prefix...), envelopeScript(ord)...)
+		assert.Equal(t, []*Envelope{{Stutter: test.stutter}}, parseWitnesses(wire.TxWitness{script, {}}), "%x", test.prefix)
+	}
+}
+
+func TestGetInscriptionContent(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	assert.NoError(t, err)
+	content := bytes.Repeat([]byte("0 1 OP_ENDIF "), 100)
+	script, err := CreateInscriptionScript(key.PubKey(), "text/plain", content, nil)
+	assert.NoError(t, err)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, wire.TxWitness{make([]byte, 64), script, make([]byte, 33)}))
+
+	contentType, body, err := GetInscriptionContent(tx)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, content, body)
+
+	_, _, err = GetInscriptionContent(wire.NewMsgTx(wire.TxVersion))
+	assert.ErrorIs(t, err, ErrNoInscription)
+}
+
+func uint64P(v uint64) *uint64 {
+	return &v
+}
+
+func runeP(v uint64) *runestone.Rune {
+	r := runestone.NewRune(uint128.From64(v))
+	return &r
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+type etchOptions struct {
+	notifier BlockNotifier // 等待commit成熟时的新区块通知
+	psbtDir  string        // 只导出PSBT, 不签名不广播
+	outDir   string        // dry run: 签名后写入文件, 不广播
+}
+
+func runEtch(args []string) {
+	fs := flag.NewFlagSet("etch", flag.ExitOnError)
+	notify := fs.String("notify", config.BlockNotify, "new block source while the commit matures: poll, zmq or stdin (one line per block)")
+	interval := fs.Duration("poll-interval", 10*time.Second, "interval of the poll block source")
+	psbtDir := fs.String("psbt", "", "write the commit and reveal as unsigned PSBTs to this directory and exit")
+	dryRun := fs.Bool("dry-run", false, "write the signed commit and reveal with JSON summaries to --out instead of broadcasting, and exit")
+	outDir := fs.String("out", "", "directory of --dry-run, default dryrun; setting it implies --dry-run")
+	fs.IntVar(&passphraseFd, "passphrase-fd", -1, "read the keystore passphrase from this file descriptor")
+	fs.Parse(args)
+	if *dryRun && *outDir == "" {
+		*outDir = "dryrun"
+	}
+
+	notifier, err := newBlockNotifier(*notify, config.ZmqBlockUrl, *interval)
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	source, err := config.GetUtxoSource()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	if config.usesNodeWallet() {
+		if !loadWallet() {
+			return
+		}
+	} else {
+		checkAndPrintConfig()
+	}
+	if err := BuildEtchTxs(source, etchOptions{notifier: notifier, psbtDir: *psbtDir, outDir: *outDir}); err != nil {
+		p.Println(err.Error())
+	}
+}
+
+// BuildEtchTxs etches the rune of the Etching config from the first wallet.
+// The reveal commits to the rune in the envelope of the logo inscription, if
+// Etching.Logo is set, so that the rune and its logo are revealed together.
+// The commit is broadcast first and the reveal once the commit has matured.
+func BuildEtchTxs(source UtxoSource, opts etchOptions) error {
+	etching, err := config.GetEtching()
+	if err != nil {
+		return err
+	}
+	r := runestone.Runestone{Etching: etching}
+	runeData, err := r.Encipher()
+	if err != nil {
+		return err
+	}
+	p.Printf("Etch Rune[%s] data: 0x%x\n", config.Etching.Rune, runeData)
+
+	net := config.GetNetwork()
+	tip, err := source.GetBlockHeight()
+	if err != nil {
+		return err
+	}
+	// the commit is mined at tip+1 at the earliest, and the reveal in the
+	// block that gives the commit COMMIT_CONFIRMATIONS confirmations
+	if err := checkEtchable(*etching.Rune, net.Net, tip+runestone.COMMIT_CONFIRMATIONS); err != nil {
+		return err
+	}
+
+	var logo *Inscription
+	mime, data, err := config.GetRuneLogo()
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		logo = &Inscription{ContentType: mime, Body: data}
+	}
+
+	funding, err := loadRevealFunding(source, opts.psbtDir != "")
+	if err != nil {
+		return err
+	}
+	wallet := funding.wallet
+	recovery, err := config.GetRecoveryScript(funding.pubKey)
+	if err != nil {
+		return err
+	}
+	txs, err := buildRuneEtchingRevealTxs(funding.pubKey, funding.utxos, runeData, *etching.Rune, logo, funding.feeRate, defaultRevealOutValue, net, wallet.Address, recovery)
+	if err != nil {
+		return err
+	}
+	if err := printEtchEstimate(txs, funding.utxos, logo, funding.feeRate); err != nil {
+		return err
+	}
+
+	if opts.psbtDir != "" {
+		commit, reveal, err := txs.psbts(wallet.PubKeys, funding.utxos, source.GetRawTx)
+		if err != nil {
+			return err
+		}
+		if err := writeTxFiles(opts.psbtDir, "etch-commit", commit, true, txs.commitTx, UtxoList(funding.utxos)); err != nil {
+			return err
+		}
+		return writeTxFiles(opts.psbtDir, "etch-reveal", reveal, true, txs.revealTx, txs.prevOuts())
+	}
+
+	commit, reveal, err := txs.sign(funding.privateKey, wallet.Keys, funding.utxos)
+	if err != nil {
+		return err
+	}
+	printRevealFee(txs)
+	commitTx, revealTx := &wire.MsgTx{}, &wire.MsgTx{}
+	if err := commitTx.Deserialize(bytes.NewReader(commit)); err != nil {
+		return err
+	}
+	if err := revealTx.Deserialize(bytes.NewReader(reveal)); err != nil {
+		return err
+	}
+	if err := VerifyTx(commitTx, VerifyOptions{PrevOuts: UtxoList(funding.utxos), FeeRate: funding.feeRate}); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	if err := VerifyTx(revealTx, VerifyOptions{PrevOuts: txs.prevOuts(), FeeRate: funding.feeRate, Runestone: runeData}); err != nil {
+		return fmt.Errorf("reveal: %w", err)
+	}
+	if opts.outDir != "" {
+		if err := writeTxFiles(opts.outDir, "etch-commit", commit, false, commitTx, UtxoList(funding.utxos)); err != nil {
+			return err
+		}
+		return writeTxFiles(opts.outDir, "etch-reveal", reveal, false, revealTx, txs.prevOuts())
+	}
+
+	// the reveal is printed before anything is sent, so that it can still be
+	// broadcast by hand if we are interrupted
+	p.Printf("Reveal transaction: %s\n", hex.EncodeToString(reveal))
+	commitTxid, err := source.SendTx(commit)
+	if err != nil {
+		return err
+	}
+	p.Printf("Commit transaction broadcast: %s\n", commitTxid)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return broadcastReveal(ctx, source, opts.notifier, commitTxid, reveal)
+}
+
+// checkEtchable reports why r cannot be etched in a reveal mined at height.
+func checkEtchable(r runestone.Rune, net wire.BitcoinNet, height uint64) error {
+	if r.IsReserved() {
+		return fmt.Errorf("rune %s is reserved", r.String())
+	}
+	if minimum := runestone.MinimumAtHeight(net, height); r.Value.Cmp(minimum.Value) < 0 {
+		return fmt.Errorf("rune %s is shorter than %s, the minimum at block %d", r.String(), minimum.String(), height)
+	}
+	return nil
+}
+
+// broadcastReveal waits until the commit has COMMIT_CONFIRMATIONS-1
+// confirmations, so that the reveal can be mined in the next block, and sends
+// the reveal, again after every block until it is accepted.
+func broadcastReveal(ctx context.Context, source UtxoSource, notifier BlockNotifier, commitTxid string, reveal []byte) error {
+	p.Printf("Waiting for the commit to be confirmed...\n")
+	for {
+		if err := notifier.Wait(ctx); err != nil {
+			return err
+		}
+		_, confirmed, err := source.GetTxFee(commitTxid)
+		if err != nil {
+			p.Println(err.Error())
+			continue
+		}
+		if confirmed {
+			break
+		}
+	}
+	// the tip is the block of the commit or later
+	height, err := source.GetBlockHeight()
+	if err != nil {
+		return err
+	}
+	target := height + runestone.COMMIT_CONFIRMATIONS - 2
+	if _, err := waitForHeight(ctx, notifier, source.GetBlockHeight, target); err != nil {
+		return err
+	}
+	for {
+		txid, err := source.SendTx(reveal)
+		if err == nil {
+			p.Printf("Reveal transaction broadcast: %s\n", txid)
+			return nil
+		}
+		p.Printf("Reveal broadcast failed, retrying at the next block: %s\n", err)
+		if err := notifier.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// printEtchEstimate shows the sizes and fees of the unsigned commit and
+// reveal before they are signed.
+func printEtchEstimate(txs *revealTxs, utxos []*Utxo, logo *Inscription, feeRate int64) error {
+	commit := summarizeTx(txs.commitTx, UtxoList(utxos), config.GetNetwork(), nil)
+	commitFee := int64(0)
+	if commit.Fee != nil {
+		commitFee = *commit.Fee
+	}
+	revealVsize, err := txs.vsize()
+	if err != nil {
+		return err
+	}
+	revealFee := txs.commitTx.TxOut[0].Value
+	for _, out := range txs.revealTx.TxOut {
+		revealFee -= out.Value
+	}
+	p.Printf("Fee rate %d sat/vB: commit %d vB, fee %d; reveal %d vB, fee %d; total fee %d\n",
+		feeRate, commit.Vsize, commitFee, revealVsize, revealFee, commitFee+revealFee)
+	if logo != nil {
+		p.Printf("Logo inscription: %s, %d bytes\n", logo.ContentType, len(logo.Body))
+	}
+	return nil
+}
+
+func addressScript(address string) ([]byte, error) {
+	addr, err := btcutil.DecodeAddress(address, config.GetNetwork())
+	if err != nil {
+		return nil, errors.New("invalid address " + address + ": " + err.Error())
+	}
+	return txscript.PayToAddrScript(addr)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"lukechampine.com/uint128"
+)
+
+func TestEtchingRevealWithLogo(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	assert.NoError(t, err)
+	net := &chaincfg.RegressionNetParams
+	receiver, err := getP2TRAddress(key.PubKey(), net)
+	assert.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(receiver)
+	assert.NoError(t, err)
+	utxo := []*Utxo{{Index: 1, Value: 100000, PkScript: pkScript}}
+
+	spaced, err := runestone.SpacedRuneFromString("UNCOMMON•GOODS")
+	assert.NoError(t, err)
+	runeData, err := (&runestone.Runestone{Etching: &runestone.Etching{Rune: &spaced.Rune, Spacers: &spaced.Spacers}}).Encipher()
+	assert.NoError(t, err)
+	logo := &Inscription{ContentType: "image/png", Body: []byte{0x89, 'P', 'N', 'G'}}
+
+	txs, err := buildRuneEtchingRevealTxs(key.PubKey(), utxo, runeData, spaced.Rune, logo, 2, defaultRevealOutValue, net, receiver.EncodeAddress(), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, logo.Rune, "the logo of the caller is not changed")
+	assert.EqualValues(t, 2, txs.revealTx.Version)
+	assert.EqualValues(t, runestone.COMMIT_CONFIRMATIONS-1, txs.revealTx.TxIn[0].Sequence)
+	assert.Equal(t, runeData, txs.revealTx.TxOut[0].PkScript)
+
+	// one script holds the logo and the commitment to the rune
+	envelopes, err := ParseTapscriptEnvelopes(txs.script, 0)
+	assert.NoError(t, err)
+	assert.Len(t, envelopes, 1)
+	assert.Equal(t, []byte("image/png"), envelopes[0].ContentType)
+	assert.Equal(t, logo.Body, envelopes[0].Body)
+	assert.Equal(t, &spaced.Rune, envelopes[0].Rune)
+	tokens, err := tokenizeScript(txs.script)
+	assert.NoError(t, err)
+	assert.Contains(t, tokens, scriptToken{opcode: byte(len(spaced.Rune.Commitment())), data: spaced.Rune.Commitment()})
+
+	// without a logo the commitment is pushed alone
+	txs, err = buildRuneEtchingRevealTxs(key.PubKey(), utxo, runeData, spaced.Rune, nil, 2, defaultRevealOutValue, net, receiver.EncodeAddress(), nil)
+	assert.NoError(t, err)
+	envelopes, err = ParseTapscriptEnvelopes(txs.script, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, envelopes)
+	tokens, err = tokenizeScript(txs.script)
+	assert.NoError(t, err)
+	assert.Contains(t, tokens, scriptToken{opcode: byte(len(spaced.Rune.Commitment())), data: spaced.Rune.Commitment()})
+}
+
+func TestEtchEstimateWithRecovery(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	assert.NoError(t, err)
+	net := &chaincfg.RegressionNetParams
+	receiver, err := getP2TRAddress(key.PubKey(), net)
+	assert.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(receiver)
+	assert.NoError(t, err)
+	utxo := []*Utxo{{Index: 1, Value: 100000, PkScript: pkScript}}
+	spaced, err := runestone.SpacedRuneFromString("UNCOMMON•GOODS")
+	assert.NoError(t, err)
+	runeData, err := (&runestone.Runestone{Etching: &runestone.Etching{Rune: &spaced.Rune, Spacers: &spaced.Spacers}}).Encipher()
+	assert.NoError(t, err)
+	recovery, err := CreateRecoveryScript(key.PubKey(), 144)
+	assert.NoError(t, err)
+
+	txs, err := buildRuneEtchingRevealTxs(key.PubKey(), utxo, runeData, spaced.Rune, nil, 2, defaultRevealOutValue, net, receiver.EncodeAddress(), recovery)
+	assert.NoError(t, err)
+	assert.NoError(t, printEtchEstimate(txs, utxo, nil, 2))
+	estimate, err := txs.vsize()
+	assert.NoError(t, err)
+	_, reveal, err := txs.sign(key, singleKey{key}, utxo)
+	assert.NoError(t, err)
+	signed := wire.NewMsgTx(wire.TxVersion)
+	assert.NoError(t, signed.Deserialize(bytes.NewReader(reveal)))
+	assert.Equal(t, mempool.GetTxVirtualSize(btcutil.NewTx(signed)), estimate)
+	// the control block proves the recovery leaf as well
+	assert.Equal(t, estimate-8, revealVsize(txs.revealTx, txs.script))
+}
+
+func TestCheckEtchable(t *testing.T) {
+	height := uint64(runestone.FirstRuneHeight(wire.MainNet))
+	assert.NoError(t, checkEtchable(runestone.MinimumAtHeight(wire.MainNet, height), wire.MainNet, height))
+	short := runestone.NewRune(runestone.MinimumAtHeight(wire.MainNet, height).Value.Sub64(1))
+	assert.Error(t, checkEtchable(short, wire.MainNet, height))
+	assert.Error(t, checkEtchable(runestone.Reserved(840000, 1), wire.MainNet, height))
+	assert.NoError(t, checkEtchable(runestone.NewRune(uint128.From64(0)), wire.MainNet, height+uint64(runestone.SUBSIDY_HALVING_INTERVAL)))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FeeEstimator returns a fee rate in sat/vB.
+type FeeEstimator interface {
+	EstimateFee() (int64, error)
+}
+
+var ErrNoFeeRate = errors.New("no fee rate available")
+
+// staticFee always returns the configured rate.
+type staticFee int64
+
+func (f staticFee) EstimateFee() (int64, error) {
+	if f <= 0 {
+		return 0, ErrNoFeeRate
+	}
+	return int64(f), nil
+}
+
+// nodeFeeEstimator asks the local node with estimatesmartfee.
+type nodeFeeEstimator struct {
+	confTarget int64
+	mode       string
+}
+
+func (e nodeFeeEstimator) EstimateFee() (int64, error) {
+	params := []interface{}{e.confTarget}
+	if e.mode != "" {
+		params = append(params, e.mode)
+	}
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "estimatesmartfee",
+		"method":  "estimatesmartfee",
+		"params":  params,
+	})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.Post(config.GetLocalRpcUrl(), "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result struct {
+			FeeRate *float64 `json:"feerate"`
+			Errors  []string `json:"errors"`
+		} `json:"result"`
+		Error interface{} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	if result.Error != nil {
+		return 0, fmt.Errorf("RPC error: %v", result.Error)
+	}
+	if result.Result.FeeRate == nil {
+		return 0, fmt.Errorf("estimatesmartfee: %v", result.Result.Errors)
+	}
+	// BTC/kvB to sat/vB
+	return int64(math.Ceil(*result.Result.FeeRate * 1e5)), nil
+}
+
+// mempoolRecommendedFee reads one level of /v1/fees/recommended, e.g.
+// fastestFee, halfHourFee, hourFee, economyFee or minimumFee.
+type mempoolRecommendedFee struct {
+	connector *MempoolConnector
+	level     string
+}
+
+func (e mempoolRecommendedFee) EstimateFee() (int64, error) {
+	fees, err := e.connector.GetRecommendedFees()
+	if err != nil {
+		return 0, err
+	}
+	fee, ok := fees[e.level]
+	if !ok {
+		return 0, fmt.Errorf("recommended fees have no %s", e.level)
+	}
+	return jsonFeeRate(fee)
+}
+
+// mempoolBlockFeeRate reads a percentile (0, 10, 25, 50, 75, 90 or 100) of the
+// fee rates in the latest blocks of /v1/mining/blocks/fee-rates/<period>.
+type mempoolBlockFeeRate struct {
+	connector  *MempoolConnector
+	period     string
+	percentile int
+}
+
+func (e mempoolBlockFeeRate) EstimateFee() (int64, error) {
+	rates, err := e.connector.GetBlockFeeRates(e.period)
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 {
+		return 0, ErrNoFeeRate
+	}
+	key := fmt.Sprintf("avgFee_%d", e.percentile)
+	fee, ok := rates[len(rates)-1][key]
+	if !ok {
+		return 0, fmt.Errorf("block fee rates have no %s", key)
+	}
+	return jsonFeeRate(fee)
+}
+
+// validPercentile reports whether the block fee rates have percentile.
+func validPercentile(percentile int) bool {
+	switch percentile {
+	case 0, 10, 25, 50, 75, 90, 100:
+		return true
+	}
+	return false
+}
+
+func jsonFeeRate(n json.Number) (int64, error) {
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Ceil(f)), nil
+}
+
+// fallbackFee returns the first positive rate of its sources.
+type fallbackFee []FeeEstimator
+
+func (f fallbackFee) EstimateFee() (int64, error) {
+	var errs []error
+	for _, e := range f {
+		fee, err := e.EstimateFee()
+		if err == nil && fee > 0 {
+			return fee, nil
+		}
+		if err == nil {
+			err = ErrNoFeeRate
+		}
+		errs = append(errs, err)
+	}
+	return 0, fmt.Errorf("%w: %w", ErrNoFeeRate, errors.Join(errs...))
+}
+
+// clampedFee keeps a rate within [min, max]; a zero bound is not applied.
+type clampedFee struct {
+	FeeEstimator
+	min, max int64
+}
+
+func (c clampedFee) EstimateFee() (int64, error) {
+	fee, err := c.FeeEstimator.EstimateFee()
+	if err != nil {
+		return 0, err
+	}
+	if c.min > 0 && fee < c.min {
+		fee = c.min
+	}
+	if c.max > 0 && fee > c.max {
+		fee = c.max
+	}
+	return fee, nil
+}
+
+// cachedFee shares one rate between all callers for ttl. Failures are not
+// cached, and a stale rate is never returned.
+type cachedFee struct {
+	FeeEstimator
+	ttl time.Duration
+
+	mu  sync.Mutex
+	fee int64
+	at  time.Time
+}
+
+func (c *cachedFee) EstimateFee() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fee > 0 && time.Since(c.at) < c.ttl {
+		return c.fee, nil
+	}
+	fee, err := c.FeeEstimator.EstimateFee()
+	if err != nil {
+		return 0, err
+	}
+	if fee <= 0 {
+		return 0, ErrNoFeeRate
+	}
+	c.fee, c.at = fee, time.Now()
+	return fee, nil
+}
+
+// newFeeEstimator builds a chain of the named sources, tried in order:
+// "static", "node", "mempool-recommended" and "mempool-blocks".
+func newFeeEstimator(c Config, sources []string) (FeeEstimator, error) {
+	fee := c.GetFee()
+	var chain fallbackFee
+	for _, source := range sources {
+		switch source {
+		case "static":
+			chain = append(chain, staticFee(fee.Static))
+		case "node":
+			chain = append(chain, nodeFeeEstimator{confTarget: fee.ConfTarget, mode: fee.EstimateMode})
+		case "mempool-recommended":
+			chain = append(chain, mempoolRecommendedFee{connector: NewMempoolConnector(c), level: fee.Recommended})
+		case "mempool-blocks":
+			if !validPercentile(*fee.Percentile) {
+				return nil, fmt.Errorf("unsupported fee Percentile %d, use 0, 10, 25, 50, 75, 90 or 100", *fee.Percentile)
+			}
+			chain = append(chain, mempoolBlockFeeRate{connector: NewMempoolConnector(c), period: fee.Period, percentile: *fee.Percentile})
+		default:
+			return nil, fmt.Errorf("unknown fee source: %s", source)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no fee source configured")
+	}
+	return &cachedFee{
+		FeeEstimator: clampedFee{FeeEstimator: chain, min: fee.Min, max: fee.Max},
+		ttl:          time.Duration(fee.CacheSeconds) * time.Second,
+	}, nil
+}
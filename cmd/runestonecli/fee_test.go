@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFee returns its rates in turn and counts the calls.
+type countingFee struct {
+	rates []int64
+	calls int
+}
+
+func (f *countingFee) EstimateFee() (int64, error) {
+	f.calls++
+	rate := f.rates[(f.calls-1)%len(f.rates)]
+	if rate < 0 {
+		return 0, errors.New("backend down")
+	}
+	return rate, nil
+}
+
+func TestFallbackFee(t *testing.T) {
+	down := &countingFee{rates: []int64{-1}}
+	fee, err := fallbackFee{down, staticFee(0), staticFee(7), staticFee(9)}.EstimateFee()
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), fee)
+	assert.Equal(t, 1, down.calls)
+
+	_, err = fallbackFee{down, staticFee(0)}.EstimateFee()
+	assert.ErrorIs(t, err, ErrNoFeeRate)
+	assert.ErrorContains(t, err, "backend down")
+}
+
+func TestClampedFee(t *testing.T) {
+	for _, c := range []struct {
+		rate, min, max, want int64
+	}{
+		{5, 1, 0, 5},
+		{5, 10, 0, 10},
+		{500, 1, 100, 100},
+		{50, 0, 0, 50},
+	} {
+		fee, err := clampedFee{FeeEstimator: staticFee(c.rate), min: c.min, max: c.max}.EstimateFee()
+		require.NoError(t, err)
+		assert.Equal(t, c.want, fee, "%d in [%d, %d]", c.rate, c.min, c.max)
+	}
+	_, err := clampedFee{FeeEstimator: staticFee(0), min: 1}.EstimateFee()
+	assert.ErrorIs(t, err, ErrNoFeeRate)
+}
+
+func TestCachedFee(t *testing.T) {
+	source := &countingFee{rates: []int64{3, -1, 0, 4}}
+	cached := &cachedFee{FeeEstimator: source, ttl: time.Hour}
+	for i := 0; i < 3; i++ {
+		fee, err := cached.EstimateFee()
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), fee)
+	}
+	assert.Equal(t, 1, source.calls)
+
+	// failures are not cached, and neither is a stale rate returned
+	cached.at = time.Now().Add(-2 * time.Hour)
+	_, err := cached.EstimateFee()
+	assert.ErrorContains(t, err, "backend down")
+	_, err = cached.EstimateFee()
+	assert.ErrorIs(t, err, ErrNoFeeRate)
+	fee, err := cached.EstimateFee()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), fee)
+	assert.Equal(t, 4, source.calls)
+}
+
+// feeRatesServer serves /v1/mining/blocks/fee-rates with two blocks.
+func feeRatesServer(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/mining/blocks/fee-rates/100m" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[{"avgHeight":849999,"timestamp":1719000000,"avgFee_0":1,"avgFee_10":2,"avgFee_25":3,"avgFee_50":4,"avgFee_75":5,"avgFee_90":6,"avgFee_100":70},`+
+			`{"avgHeight":850000,"timestamp":1719000600,"avgFee_0":2,"avgFee_10":3.2,"avgFee_25":4,"avgFee_50":5,"avgFee_75":8,"avgFee_90":12,"avgFee_100":300}]`)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestConfigFeeEstimator(t *testing.T) {
+	c := Config{Network: "mainnet", RpcUrl: feeRatesServer(t)}
+	fees, err := c.GetFeeEstimator()
+	require.NoError(t, err)
+	fee, err := fees.EstimateFee()
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), fee, "90th percentile of the latest block")
+
+	// 0 is the lowest fee rate, not the default
+	for percentile, want := range map[int]int64{0: 2, 10: 4, 100: 300} {
+		percentile := percentile
+		c.Fee = &FeeConfig{Percentile: &percentile}
+		fees, err := c.GetFeeEstimator()
+		require.NoError(t, err)
+		fee, err := fees.EstimateFee()
+		require.NoError(t, err)
+		assert.Equal(t, want, fee, "percentile %d", percentile)
+	}
+
+	percentile := 95
+	c.Fee = &FeeConfig{Percentile: &percentile}
+	_, err = c.GetFeeEstimator()
+	assert.ErrorContains(t, err, "unsupported fee Percentile 95")
+	// the percentile only matters to mempool-blocks
+	c.Fee.Sources = []string{"static"}
+	_, err = c.GetFeeEstimator()
+	assert.NoError(t, err)
+}
+
+func TestConfigSpeedFeeEstimator(t *testing.T) {
+	c := Config{Network: "mainnet", RpcUrl: feeRatesServer(t)}
+	fees, err := c.GetFeeEstimator()
+	require.NoError(t, err)
+	speedFees, err := c.GetSpeedFeeEstimator(fees)
+	require.NoError(t, err)
+	assert.Same(t, fees, speedFees, "one cache for both")
+
+	c.FeePerByte = 2
+	fees, err = c.GetFeeEstimator()
+	require.NoError(t, err)
+	speedFees, err = c.GetSpeedFeeEstimator(fees)
+	require.NoError(t, err)
+	fee, err := speedFees.EstimateFee()
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), fee, "not FeePerByte")
+
+	c.SpeedFee = 20
+	speedFees, err = c.GetSpeedFeeEstimator(fees)
+	require.NoError(t, err)
+	assert.Equal(t, staticFee(20), speedFees)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BIP86 derives key-path-only taproot addresses at
+// m/86'/coin'/account'/chain/index.
+const (
+	bip86Purpose = 86
+	hdReceive    = 0
+	hdChange     = 1
+)
+
+// bip86Account derives the account key m/86'/coin'/account' from a master key.
+func bip86Account(master *hdkeychain.ExtendedKey, net *chaincfg.Params, account uint32) (*hdkeychain.ExtendedKey, error) {
+	key := master
+	for _, i := range []uint32{bip86Purpose, net.HDCoinType, account} {
+		var err error
+		key, err = key.Derive(hdkeychain.HardenedKeyStart + i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// parseHDAccount turns an extended private key or a BIP39 mnemonic into a
+// BIP86 account key for net. An extended key of depth 3 is taken to be the
+// account key already.
+func parseHDAccount(secret, bip39Passphrase string, net *chaincfg.Params) (*hdkeychain.ExtendedKey, error) {
+	secret = strings.TrimSpace(secret)
+	var master *hdkeychain.ExtendedKey
+	if words := strings.Fields(secret); len(words) > 1 {
+		seed, err := mnemonicSeed(words, bip39Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		defer zero(seed)
+		if master, err = hdkeychain.NewMaster(seed, net); err != nil {
+			return nil, err
+		}
+	} else {
+		key, err := hdkeychain.NewKeyFromString(secret)
+		if err != nil {
+			return nil, err
+		}
+		if !key.IsPrivate() {
+			return nil, errors.New("extended key is not private")
+		}
+		if !key.IsForNet(net) {
+			return nil, errors.New("extended key is for another network")
+		}
+		switch key.Depth() {
+		case 0:
+			master = key
+		case 3:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("extended key of depth %d is neither a master nor an account key", key.Depth())
+		}
+	}
+	return bip86Account(master, net, 0)
+}
+
+// bip39English is the English word list of BIP39.
+//
+//go:embed bip39_english.txt
+var bip39English string
+
+var bip39Words = sync.OnceValue(func() map[string]int {
+	words := make(map[string]int, 2048)
+	for i, word := range strings.Fields(bip39English) {
+		words[word] = i
+	}
+	return words
+})
+
+// mnemonicSeed is the BIP39 seed of a mnemonic, after checking its words
+// against the English word list and its checksum, so that a typo cannot
+// derive another wallet.
+func mnemonicSeed(words []string, passphrase string) ([]byte, error) {
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, fmt.Errorf("a mnemonic has 12, 15, 18, 21 or 24 words, not %d", len(words))
+	}
+	// 11 bits per word: the entropy followed by one checksum bit per 32 bits
+	// of entropy
+	bits := make([]byte, len(words)*11/8+1)
+	for i, word := range words {
+		index, ok := bip39Words()[norm.NFKD.String(word)]
+		if !ok {
+			return nil, fmt.Errorf("mnemonic word %d %q is not in the BIP39 English word list", i+1, word)
+		}
+		for b := 0; b < 11; b++ {
+			if index&(1<<(10-b)) != 0 {
+				n := i*11 + b
+				bits[n/8] |= 0x80 >> (n % 8)
+			}
+		}
+	}
+	entropy := bits[:len(words)*11*32/33/8]
+	checksumBits := len(entropy) / 4
+	checksum := sha256.Sum256(entropy)
+	mask := byte(0xff) << (8 - checksumBits)
+	if bits[len(entropy)]&mask != checksum[0]&mask {
+		return nil, errors.New("mnemonic checksum mismatch, check the words and their order")
+	}
+	mnemonic := norm.NFKD.String(strings.Join(words, " "))
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+	return pbkdf2.Key([]byte(mnemonic), []byte(salt), 2048, 64, sha512.New), nil
+}
+
+// hdState records the addresses handed out by every hd wallet, so that later
+// runs find their utxos and the keys to sign for them.
+type hdState struct {
+	path    string
+	mu      sync.Mutex
+	Wallets map[string]*hdWalletState `json:"wallets"` // by account xpub
+}
+
+type hdWalletState struct {
+	Name      string       `json:"name"`
+	Next      [2]uint32    `json:"next"` // next receive and change index
+	Addresses []*hdAddress `json:"addresses"`
+}
+
+type hdAddress struct {
+	Path     string `json:"path"`
+	Chain    uint32 `json:"chain"`
+	Index    uint32 `json:"index"`
+	Address  string `json:"address"`
+	PkScript string `json:"pkscript"`
+}
+
+// loadHDState reads the state at path. A missing file is an empty state.
+func loadHDState(path string) (*hdState, error) {
+	s := &hdState{path: path, Wallets: map[string]*hdWalletState{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("hd state %s: %w", path, err)
+	}
+	if s.Wallets == nil {
+		s.Wallets = map[string]*hdWalletState{}
+	}
+	return s, nil
+}
+
+// save must be called with mu held.
+func (s *hdState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Clean(s.path))
+}
+
+// hdWallet hands out BIP86 addresses of one account. Without the private
+// account key it can still list and derive addresses, but not sign.
+type hdWallet struct {
+	name    string
+	account *hdkeychain.ExtendedKey
+	xpub    string
+	net     *chaincfg.Params
+	state   *hdState
+
+	// onNew is called with every newly derived address, e.g. to import it
+	// into the watch-only wallet of the node.
+	onNew func(address string) error
+}
+
+func newHDWallet(name string, account *hdkeychain.ExtendedKey, net *chaincfg.Params, state *hdState) (*hdWallet, error) {
+	if !account.IsForNet(net) {
+		return nil, fmt.Errorf("key %q is for another network", name)
+	}
+	if account.Depth() != 3 {
+		return nil, fmt.Errorf("key %q is not an account key", name)
+	}
+	xpub, err := account.Neuter()
+	if err != nil {
+		return nil, err
+	}
+	w := &hdWallet{name: name, account: account, xpub: xpub.String(), net: net, state: state}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if _, ok := state.Wallets[w.xpub]; !ok {
+		state.Wallets[w.xpub] = &hdWalletState{Name: name}
+	}
+	return w, nil
+}
+
+func (w *hdWallet) path(chain, index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", bip86Purpose, w.net.HDCoinType,
+		w.account.ChildIndex()-hdkeychain.HardenedKeyStart, chain, index)
+}
+
+func (w *hdWallet) derive(chain, index uint32) (*hdkeychain.ExtendedKey, error) {
+	key, err := w.account.Derive(chain)
+	if err != nil {
+		return nil, err
+	}
+	return key.Derive(index)
+}
+
+// First returns the first receive address, deriving it if needed.
+func (w *hdWallet) First() (string, error) {
+	w.state.mu.Lock()
+	ws := w.state.Wallets[w.xpub]
+	for _, a := range ws.Addresses {
+		if a.Chain == hdReceive && a.Index == 0 {
+			w.state.mu.Unlock()
+			return a.Address, nil
+		}
+	}
+	w.state.mu.Unlock()
+	return w.Next(hdReceive)
+}
+
+// Next derives the next unused address of chain and records it.
+func (w *hdWallet) Next(chain uint32) (string, error) {
+	address, err := w.record(chain)
+	if err != nil {
+		return "", err
+	}
+	if w.onNew != nil {
+		if err := w.onNew(address); err != nil {
+			return "", err
+		}
+	}
+	return address, nil
+}
+
+func (w *hdWallet) record(chain uint32) (string, error) {
+	w.state.mu.Lock()
+	defer w.state.mu.Unlock()
+	ws := w.state.Wallets[w.xpub]
+	index := ws.Next[chain]
+	key, err := w.derive(chain, index)
+	if err != nil {
+		return "", err
+	}
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return "", err
+	}
+	addr, err := getP2TRAddress(pubKey, w.net)
+	if err != nil {
+		return "", err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return "", err
+	}
+	ws.Addresses = append(ws.Addresses, &hdAddress{
+		Path:     w.path(chain, index),
+		Chain:    chain,
+		Index:    index,
+		Address:  addr.EncodeAddress(),
+		PkScript: hex.EncodeToString(pkScript),
+	})
+	ws.Next[chain] = index + 1
+	return addr.EncodeAddress(), w.state.save()
+}
+
+// Addresses returns every recorded address of the wallet.
+func (w *hdWallet) Addresses() []*hdAddress {
+	w.state.mu.Lock()
+	defer w.state.mu.Unlock()
+	return append([]*hdAddress(nil), w.state.Wallets[w.xpub].Addresses...)
+}
+
+// KeyForScript returns the child key of a recorded address.
+func (w *hdWallet) KeyForScript(pkScript []byte) (*btcec.PrivateKey, error) {
+	if !w.account.IsPrivate() {
+		return nil, fmt.Errorf("key %q is watch-only", w.name)
+	}
+	key, err := w.childForScript(pkScript)
+	if err != nil {
+		return nil, err
+	}
+	return key.ECPrivKey()
+}
+
+// PubKeyForScript returns the public child key of a recorded address.
+func (w *hdWallet) PubKeyForScript(pkScript []byte) (*btcec.PublicKey, error) {
+	key, err := w.childForScript(pkScript)
+	if err != nil {
+		return nil, err
+	}
+	return key.ECPubKey()
+}
+
+func (w *hdWallet) childForScript(pkScript []byte) (*hdkeychain.ExtendedKey, error) {
+	for _, a := range w.Addresses() {
+		script, err := hex.DecodeString(a.PkScript)
+		if err != nil || !bytes.Equal(script, pkScript) {
+			continue
+		}
+		return w.derive(a.Chain, a.Index)
+	}
+	return nil, fmt.Errorf("key %q has no address for script %x", w.name, pkScript)
+}
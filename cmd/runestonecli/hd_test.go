@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// TestMnemonicSeed checks vectors of the BIP39 reference implementation,
+// which all use the passphrase TREZOR.
+func TestMnemonicSeed(t *testing.T) {
+	for _, v := range []struct {
+		mnemonic, seed string
+	}{
+		{testMnemonic, "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"},
+		{"legal winner thank year wave sausage worth useful legal winner thank yellow", "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607"},
+		{"letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic bless", "c0c519bd0e91a2ed54357d9d1ebef6f5af218a153624cf4f2da911a0ed8f7a09e2ef61af0aca007096df430022f7a2b6fb91661a9589097069720d015e4e982f"},
+	} {
+		seed, err := mnemonicSeed(strings.Fields(v.mnemonic), "TREZOR")
+		require.NoError(t, err, v.mnemonic)
+		assert.Equal(t, v.seed, hex.EncodeToString(seed))
+	}
+}
+
+func TestMnemonicSeedInvalid(t *testing.T) {
+	for mnemonic, msg := range map[string]string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon":                                                                    "checksum mismatch",
+		"about abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon":                                                                      "checksum mismatch",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandn about":                                                                       `word 11 "abandn"`,
+		"Abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about":                                                                      `word 1 "Abandon"`,
+		"legal winner thank year wave sausage worth useful legal winner thank yellow yellow":                                                                                 "not 13",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic zoo": "checksum mismatch",
+	} {
+		_, err := mnemonicSeed(strings.Fields(mnemonic), "")
+		assert.ErrorContains(t, err, msg, mnemonic)
+	}
+}
+
+// TestBIP86 checks the account key and addresses of the BIP86 test vectors.
+func TestBIP86(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	account, err := parseHDAccount(testMnemonic, "", net)
+	require.NoError(t, err)
+	assert.Equal(t, "xprv9xgqHN7yz9MwCkxsBPN5qetuNdQSUttZNKw1dcYTV4mkaAFiBVGQziHs3NRSWMkCzvgjEe3n9xV8oYywvM8at9yRqyaZVz6TYYhX98VjsUk", account.String())
+	xpub, err := account.Neuter()
+	require.NoError(t, err)
+	assert.Equal(t, "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ", xpub.String())
+
+	// the account key itself is accepted too
+	same, err := parseHDAccount(account.String(), "", net)
+	require.NoError(t, err)
+	assert.Equal(t, account.String(), same.String())
+
+	state, err := loadHDState(filepath.Join(t.TempDir(), "hdwallet.json"))
+	require.NoError(t, err)
+	w, err := newHDWallet("hd", account, net, state)
+	require.NoError(t, err)
+	for _, want := range []struct {
+		chain   uint32
+		address string
+	}{
+		{hdReceive, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{hdReceive, "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"},
+		{hdChange, "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7"},
+	} {
+		address, err := w.Next(want.chain)
+		require.NoError(t, err)
+		assert.Equal(t, want.address, address)
+	}
+	assert.Equal(t, "m/86'/0'/0'/1/0", w.Addresses()[2].Path)
+
+	// a reload of the state hands out the next addresses
+	state, err = loadHDState(state.path)
+	require.NoError(t, err)
+	w, err = newHDWallet("hd", account, net, state)
+	require.NoError(t, err)
+	first, err := w.First()
+	require.NoError(t, err)
+	assert.Equal(t, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr", first)
+	assert.Len(t, w.Addresses(), 3)
+
+	_, err = parseHDAccount(testMnemonic, "", &chaincfg.TestNet3Params)
+	require.NoError(t, err)
+	_, err = newHDWallet("hd", account, &chaincfg.TestNet3Params, state)
+	assert.ErrorContains(t, err, "another network")
+}
@@ -38,6 +38,79 @@ func init() {
 	initString("Mint Rune[%s] data: 0x%x\n", "挖掘符文[%s] 数据: 0x%x\n")
 	initString("BuildMintRuneTx error:", "构建挖掘符文交易错误：")
 	initString("mint rune tx: %x\n", "挖掘符文交易: %x\n")
+	initString("Mint progress: %d/%d\n", "MINT进度: %d/%d\n")
+	initString("  worker %d [%s]: minted %d, speedups %d, failures %d, unconfirmed depth %d\n", "  worker %d [%s]: 已mint %d, 加速 %d, 失败 %d, 未确认链深度 %d\n")
+	initString("No RuneSource configured, mint cap and height window are not checked\n", "未配置RuneSource，不检查符文的mint上限和区块高度范围\n")
+	initString("Minting %s is closed at block %d: %s\n", "符文 %s 在区块 %d 已无法mint: %s\n")
+	initString("Warning: only %s mints of %s remain, fewer than our %d pending mints\n", "警告：符文 %[2]s 仅剩 %[1]s 张可mint，少于我们待mint的 %[3]d 张\n")
+	initString("Unknown command: %s\n", "未知命令: %s\n")
+	initString("Current block %d, waiting for block %d...\n", "当前区块 %d，等待区块 %d...\n")
+	initString("worker %d pre-signed %d mint transactions\n", "worker %d 预签名了 %d 笔mint交易\n")
+	initString("Waiting for block %d to broadcast, mints can be mined from block %d\n", "等待区块 %d 后广播，区块 %d 开始可以mint\n")
+	initString("Interrupted, waiting for mint workers to stop...\n", "收到中断信号，等待mint任务停止...\n")
+	initString("Keystore passphrase", "密钥库密码")
+	initString("Repeat passphrase", "再次输入密码")
+	initString("Private key (hex or WIF)", "私钥（hex或WIF）")
+	initString("Usage: key import|export|list\n", "用法: key import|export|list\n")
+	initString("Imported key %s into %s\n", "已导入私钥 %s 到 %s\n")
+	initString("Remove PrivateKey from config.yaml and set Key (and Wallets[].Key) to the names above\n", "请删除config.yaml中的PrivateKey，并将Key（以及Wallets[].Key）设置为上面的名称\n")
+	initString("Extended private key or mnemonic", "扩展私钥（xprv）或助记词")
+	initString("BIP39 passphrase (empty for none)", "BIP39密码（没有则留空）")
+	initString("Anyone with this key can spend the coins of its address", "任何拿到此私钥的人都可以花费该地址上的币")
+	initString("Usage: finalize [--broadcast|--out <dir>] <signed.psbt>...\n", "用法: finalize [--broadcast|--out <目录>] <已签名的psbt文件>...\n")
+	initString("Broadcast %s: %s\n", "已广播 %s: %s\n")
+	initString("worker %d exported %d mint PSBTs to %s\n", "worker %d 导出了 %d 个mint PSBT到 %s\n")
+	initString("worker %d wrote %d mint transactions to %s\n", "worker %d 写入了 %d 笔mint交易到 %s\n")
+	initString("Imported %d addresses into wallet %s\n", "已导入 %d 个地址到钱包 %s\n")
+	initString("Rescanning wallet %s from block %d, this can take a while...\n", "钱包 %s 从区块 %d 开始重新扫描，可能需要较长时间...\n")
+	initString("Rescan progress: %.1f%% (%ds)\n", "扫描进度: %.1f%% (%d秒)\n")
+	initString("Rescanned blocks %d to %d\n", "已扫描区块 %d 到 %d\n")
+	initString("No RuneSource configured, inscriptions on utxos are not checked\n", "没有配置RuneSource，不检查utxo上的铭文\n")
+	initString("Usage: decode [--json] <tx hex|psbt|txid|file>\n", "用法: decode [--json] <交易hex|psbt|txid|文件>\n")
+	initString("Transaction %s\n", "交易 %s\n")
+	initString("Size: %d vB, weight %d WU\n", "大小: %d vB, 权重 %d WU\n")
+	initString("Not signed, sizes are estimated\n", "未签名，大小为估算值\n")
+	initString("Fee: %d sats (%.2f sat/vB)\n", "手续费: %d 聪 (%.2f sat/vB)\n")
+	initString("Fee: unknown, spent outputs not found\n", "手续费: 未知，找不到花费的输出\n")
+	initString("Inputs:\n", "输入:\n")
+	initString("Outputs:\n", "输出:\n")
+	initString("Runestone: %s\n", "符文石: %s\n")
+	initString("Runestone:\n", "符文石:\n")
+	initString("Cenotaph: %s\n", "无效符文石(cenotaph): %s\n")
+	initString("  Etching %s burned\n", "  发行 %s 已销毁\n")
+	initString("  Mint %s %s burned\n", "  铸造 %s %s 已销毁\n")
+	initString("  Etching %s, symbol %s, divisibility %d, premine %s\n", "  发行 %s, 符号 %s, 可分性 %d, 预挖 %s\n")
+	initString("  Terms: amount %s, cap %s, height %s, offset %s\n", "  条款: 数量 %s, 上限 %s, 高度 %s, 偏移 %s\n")
+	initString("  Mint %s %s %s\n", "  铸造 %s %s %s\n")
+	initString("  Edict %s %s %s to output %d\n", "  转移 %s %s %s 到输出 %d\n")
+	initString("  Pointer: output %d\n", "  默认输出: %d\n")
+	initString("Inscription: %s\n", "铭文: %s\n")
+	initString("Inscription: %s, %d bytes\n", "铭文: %s, %d 字节\n")
+	initString("Etch Rune[%s] data: 0x%x\n", "发行符文[%s] 数据: 0x%x\n")
+	initString("Fee rate %d sat/vB: commit %d vB, fee %d; reveal %d vB, fee %d; total fee %d\n", "费率 %d sat/vB: commit交易 %d vB, 手续费 %d; reveal交易 %d vB, 手续费 %d; 总手续费 %d\n")
+	initString("Logo inscription: %s, %d bytes\n", "Logo铭文: %s, %d 字节\n")
+	initString("Reveal transaction: %s\n", "reveal交易: %s\n")
+	initString("Commit transaction broadcast: %s\n", "commit交易已广播: %s\n")
+	initString("Waiting for the commit to be confirmed...\n", "等待commit交易确认...\n")
+	initString("Reveal transaction broadcast: %s\n", "reveal交易已广播: %s\n")
+	initString("Reveal broadcast failed, retrying at the next block: %s\n", "reveal交易广播失败，下一个区块重试: %s\n")
+	initString("Usage: inscribe [flags] <file> | --batch <manifest>\n", "用法: inscribe [参数] <文件> | --batch <清单文件>\n")
+	initString("Batch of %d inscriptions in %d reveals at %d sat/vB: commit fee %d, reveal fees %d, total fee %d\n", "批量铭刻 %d 个铭文，%d 笔reveal交易，费率 %d sat/vB: commit手续费 %d, reveal手续费 %d, 总手续费 %d\n")
+	initString("Batch state written to %s\n", "批量铭刻状态已写入 %s\n")
+	initString("Reveal %d broadcast failed, see %s to recover: %s\n", "第 %d 笔reveal交易广播失败，可用 %s 恢复: %s\n")
+	initString("Inscription %s\n", "铭文 %s\n")
+	initString("Reveal %d vB pays %d sat, %d sat/vB requires %d: %+d sat\n", "reveal交易 %d vB 支付 %d 聪, 费率 %d sat/vB 需要 %d: %+d 聪\n")
+	initString("Usage: recover [flags] <commit txid> --etching | --file <file> | --state <state file>\n", "用法: recover [参数] <commit交易id> --etching | --file <文件> | --state <状态文件>\n")
+	initString("Recovering %d outputs of commit %s to %s: %d sat at %d sat/vB\n", "取回commit交易 %[2]s 的 %[1]d 个输出到 %[3]s: %[4]d 聪, 费率 %[5]d sat/vB\n")
+	initString("Recovery transaction broadcast: %s\n", "取回交易已广播: %s\n")
+	initString("Reveal %s broadcast failed: %s\n", "reveal交易 %s 广播失败: %s\n")
+	initString("Usage: balance [--json] [--from <height>] [address|outpoint...]\n", "用法: balance [--json] [--from <高度>] [地址|outpoint...]\n")
+	initString("No RuneSource configured, rune balances are not shown\n", "未配置RuneSource，不显示符文余额\n")
+	initString("RuneSource %s cannot list rune balances\n", "RuneSource %s 不能查询符文余额\n")
+	initString("UtxoSource %s cannot list the outputs of an address\n", "UtxoSource %s 不能列出地址的输出\n")
+	initString("Address %s\n", "地址 %s\n")
+	initString("BTC: %d sat confirmed, %d sat unconfirmed\n", "BTC: 已确认 %d 聪, 未确认 %d 聪\n")
+	initString("Runes:\n", "符文:\n")
 }
 func initString(english, chinese string) {
 	key := english
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+	"gopkg.in/yaml.v3"
+)
+
+// batchManifest is a batch file, as ord reads them, plus the reveal-per-item
+// mode and a default destination.
+type batchManifest struct {
+	Mode         BatchMode           `yaml:"mode"`
+	Parents      []string            `yaml:"parents"`
+	Postage      int64               `yaml:"postage"`
+	Destination  string              `yaml:"destination"`
+	Inscriptions []batchManifestItem `yaml:"inscriptions"`
+}
+
+type batchManifestItem struct {
+	File         string    `yaml:"file"`
+	ContentType  string    `yaml:"content_type"` // detected from the file if empty
+	Destination  string    `yaml:"destination"`
+	Metaprotocol string    `yaml:"metaprotocol"`
+	Metadata     yaml.Node `yaml:"metadata"` // written as CBOR
+}
+
+// loadBatchManifest reads a manifest. Files are relative to its directory.
+func loadBatchManifest(path string) (*batchManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &batchManifest{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range manifest.Inscriptions {
+		if file := manifest.Inscriptions[i].File; file != "" && !filepath.IsAbs(file) {
+			manifest.Inscriptions[i].File = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+	return manifest, nil
+}
+
+// items reads the files of the manifest. Inscriptions without destination go
+// to defaultDestination.
+func (m *batchManifest) items(defaultDestination string) ([]*BatchItem, error) {
+	if m.Destination != "" {
+		defaultDestination = m.Destination
+	}
+	var items []*BatchItem
+	for _, entry := range m.Inscriptions {
+		if entry.File == "" {
+			return nil, errors.New("every inscription of the batch needs a file")
+		}
+		body, err := getFileBytes(entry.File)
+		if err != nil {
+			return nil, err
+		}
+		ins := &Inscription{ContentType: entry.ContentType, Metaprotocol: entry.Metaprotocol, Body: body}
+		if ins.ContentType == "" {
+			if ins.ContentType, err = getContentType(entry.File); err != nil {
+				return nil, err
+			}
+		}
+		if entry.Metadata.Kind != 0 {
+			if ins.Metadata, err = yamlToCBOR(&entry.Metadata); err != nil {
+				return nil, fmt.Errorf("metadata of %s: %w", entry.File, err)
+			}
+		}
+		destination := entry.Destination
+		if destination == "" {
+			destination = defaultDestination
+		}
+		address, err := btcutil.DecodeAddress(destination, config.GetNetwork())
+		if err != nil {
+			return nil, fmt.Errorf("destination of %s: %w", entry.File, err)
+		}
+		items = append(items, &BatchItem{Inscription: ins, Destination: address})
+	}
+	return items, nil
+}
+
+// batchState is written before a batch is broadcast. It holds the signed
+// transactions and, for every commit output, the script and key that spend it,
+// so that the output can be spent again if its reveal does not confirm.
+type batchState struct {
+	Network  string        `json:"network"`
+	Mode     BatchMode     `json:"mode"`
+	FeeRate  int64         `json:"fee_rate"`
+	Commit   string        `json:"commit"`
+	CommitTx string        `json:"commit_tx,omitempty"` // hex, unless exported as PSBT
+	Parents  []string      `json:"parents,omitempty"`   // spent and returned by the first reveal
+	Reveals  []revealState `json:"reveals"`
+}
+
+type revealState struct {
+	Outpoint             string                   `json:"outpoint"` // the commit output
+	Value                int64                    `json:"value"`
+	InternalKey          string                   `json:"internal_key"` // x-only
+	Script               string                   `json:"script"`
+	ControlBlock         string                   `json:"control_block"`
+	Recovery             string                   `json:"recovery,omitempty"` // the recovery leaf
+	RecoveryControlBlock string                   `json:"recovery_control_block,omitempty"`
+	Txid                 string                   `json:"txid"`
+	Tx                   string                   `json:"tx,omitempty"`
+	Inscriptions         []inscriptionStateRecord `json:"inscriptions"`
+}
+
+type inscriptionStateRecord struct {
+	Id          string `json:"id"`
+	File        string `json:"file"`
+	Destination string `json:"destination"`
+}
+
+func newBatchState(batch *inscriptionBatch, manifest *batchManifest, items []*BatchItem, parents []*BatchParent, feeRate int64, commit []byte, reveals [][]byte) (*batchState, error) {
+	state := &batchState{
+		Network: config.GetNetwork().Name,
+		Mode:    batch.mode,
+		FeeRate: feeRate,
+		Commit:  batch.commitTx.TxHash().String(),
+	}
+	if commit != nil {
+		state.CommitTx = hex.EncodeToString(commit)
+	}
+	for _, parent := range parents {
+		state.Parents = append(state.Parents, parent.Id.String())
+	}
+	ids := batch.inscriptionIds(len(items))
+	for i, r := range batch.reveals {
+		tree, err := r.tree()
+		if err != nil {
+			return nil, err
+		}
+		controlBlock, err := tree.ControlBlock(0)
+		if err != nil {
+			return nil, err
+		}
+		outpoint := r.revealTx.TxIn[r.input].PreviousOutPoint
+		reveal := revealState{
+			Outpoint:     outpoint.String(),
+			Value:        batch.commitTx.TxOut[outpoint.Index].Value,
+			InternalKey:  hex.EncodeToString(schnorr.SerializePubKey(r.pubKey)),
+			Script:       hex.EncodeToString(r.script),
+			ControlBlock: hex.EncodeToString(controlBlock),
+			Txid:         r.revealTx.TxHash().String(),
+		}
+		if r.recovery != nil {
+			recoveryControlBlock, err := tree.ControlBlock(1)
+			if err != nil {
+				return nil, err
+			}
+			reveal.Recovery = hex.EncodeToString(r.recovery)
+			reveal.RecoveryControlBlock = hex.EncodeToString(recoveryControlBlock)
+		}
+		if reveals != nil {
+			reveal.Tx = hex.EncodeToString(reveals[i])
+		}
+		for j, item := range items {
+			if batch.mode == BatchRevealPerItem && j != i {
+				continue
+			}
+			reveal.Inscriptions = append(reveal.Inscriptions, inscriptionStateRecord{
+				Id:          ids[j].String(),
+				File:        manifest.Inscriptions[j].File,
+				Destination: item.Destination.EncodeAddress(),
+			})
+		}
+		state.Reveals = append(state.Reveals, reveal)
+	}
+	return state, nil
+}
+
+func (s *batchState) write(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	p.Printf("Batch state written to %s\n", path)
+	return nil
+}
+
+func readBatchState(path string) (*batchState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &batchState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+// trees returns the script tree of every commit output, which must be
+// committed to pubKey.
+func (s *batchState) trees(pubKey *btcec.PublicKey) ([]*TapTree, error) {
+	key := hex.EncodeToString(schnorr.SerializePubKey(pubKey))
+	var trees []*TapTree
+	for _, reveal := range s.Reveals {
+		if reveal.InternalKey != key {
+			return nil, fmt.Errorf("commit output %s is committed to key %s, not to the wallet key %s", reveal.Outpoint, reveal.InternalKey, key)
+		}
+		var leaves [][]byte
+		for _, leaf := range []string{reveal.Script, reveal.Recovery} {
+			if leaf == "" {
+				continue
+			}
+			script, err := hex.DecodeString(leaf)
+			if err != nil {
+				return nil, fmt.Errorf("script of %s: %w", reveal.Outpoint, err)
+			}
+			leaves = append(leaves, script)
+		}
+		tree, err := NewTapTree(pubKey, leaves...)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	return trees, nil
+}
+
+// revealFunding is the wallet paying a commit, its spendable utxos, the key of
+// the reveal scripts and the fee rate.
+type revealFunding struct {
+	wallet     *MintWallet
+	utxos      []*Utxo
+	pubKey     *btcec.PublicKey
+	privateKey *btcec.PrivateKey // nil when exporting PSBTs
+	feeRate    int64
+}
+
+// loadRevealFunding takes the first wallet, a watch-only one for psbt. Utxos
+// holding inscriptions or runes are left out if RuneSource can tell.
+func loadRevealFunding(source UtxoSource, psbt bool) (*revealFunding, error) {
+	getWallets := config.GetMintWallets
+	if psbt {
+		getWallets = config.GetWatchWallets
+	}
+	wallets, err := getWallets()
+	if err != nil {
+		return nil, err
+	}
+	f := &revealFunding{wallet: wallets[0]}
+	walletScript, err := addressScript(f.wallet.Address)
+	if err != nil {
+		return nil, err
+	}
+	if psbt {
+		if f.pubKey, err = f.wallet.PubKeys.PubKeyForScript(walletScript); err != nil {
+			return nil, err
+		}
+	} else {
+		if f.privateKey, err = f.wallet.Keys.KeyForScript(walletScript); err != nil {
+			return nil, err
+		}
+		f.pubKey = f.privateKey.PubKey()
+	}
+
+	var assets *assetFilter
+	runeSource, err := config.GetRuneSource()
+	if err != nil {
+		return nil, err
+	}
+	if checker, ok := runeSource.(AssetChecker); ok {
+		assets = newAssetFilter(checker, false)
+	} else {
+		p.Printf("No RuneSource configured, inscriptions on utxos are not checked\n")
+	}
+	utxos, err := source.GetUtxos(f.wallet.Addresses()...)
+	if err == nil {
+		utxos, err = assets.spendable(utxos)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(utxos) == 0 {
+		return nil, ErrInsufficientBalance
+	}
+	f.utxos = utxos
+
+	fees, err := config.GetFeeEstimator()
+	if err != nil {
+		return nil, err
+	}
+	if f.feeRate, err = fees.EstimateFee(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// exclude leaves outpoint out of the utxos paying the commit.
+func (f *revealFunding) exclude(outpoint wire.OutPoint) {
+	var utxos []*Utxo
+	for _, utxo := range f.utxos {
+		if utxo.OutPoint() != outpoint {
+			utxos = append(utxos, utxo)
+		}
+	}
+	f.utxos = utxos
+}
+
+type inscribeOptions struct {
+	destination       string   // 没有destination的铭文的地址
+	parents           []string // 父铭文id
+	parentDestination string   // 父铭文返回的地址, 默认原地址
+	stateFile         string
+	dir               string // 状态文件, dry run和PSBT的目录
+	psbt              bool   // 只导出PSBT, 不签名不广播
+	dryRun            bool   // 签名后写入文件, 不广播
+}
+
+func runInscribe(args []string) {
+	fs := flag.NewFlagSet("inscribe", flag.ExitOnError)
+	batchFile := fs.String("batch", "", "inscribe every file of this batch manifest with one commit")
+	destination := fs.String("destination", "", "address of inscriptions without destination, default the wallet address")
+	var parents []string
+	fs.Func("parent", "inscribe children of this inscription, which the reveal spends; may be repeated", func(id string) error {
+		parents = append(parents, id)
+		return nil
+	})
+	parentDestination := fs.String("parent-destination", "", "address the parents go back to, default where they are")
+	stateFile := fs.String("state", "", "file to write the batch state to, default inscribe-<commit txid>.json in the output directory")
+	psbtDir := fs.String("psbt", "", "write the commit and reveals as unsigned PSBTs to this directory and exit")
+	dryRun := fs.Bool("dry-run", false, "write the signed commit and reveals with JSON summaries to --out instead of broadcasting, and exit")
+	outDir := fs.String("out", "", "directory of --dry-run, default dryrun; setting it implies --dry-run")
+	fs.IntVar(&passphraseFd, "passphrase-fd", -1, "read the keystore passphrase from this file descriptor")
+	fs.Parse(args)
+	if *dryRun && *outDir == "" {
+		*outDir = "dryrun"
+	}
+
+	manifest := &batchManifest{}
+	switch {
+	case *batchFile != "" && fs.NArg() == 0:
+		var err error
+		if manifest, err = loadBatchManifest(*batchFile); err != nil {
+			p.Println(err.Error())
+			return
+		}
+	case *batchFile == "" && fs.NArg() == 1:
+		manifest.Inscriptions = []batchManifestItem{{File: fs.Arg(0)}}
+	default:
+		p.Printf("Usage: inscribe [flags] <file> | --batch <manifest>\n")
+		os.Exit(2)
+	}
+
+	source, err := config.GetUtxoSource()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	if config.usesNodeWallet() {
+		if !loadWallet() {
+			return
+		}
+	} else {
+		checkAndPrintConfig()
+	}
+	opts := inscribeOptions{
+		destination:       *destination,
+		parents:           append(manifest.Parents, parents...),
+		parentDestination: *parentDestination,
+		stateFile:         *stateFile,
+		dir:               ".",
+		psbt:              *psbtDir != "",
+		dryRun:            *outDir != "",
+	}
+	switch {
+	case *psbtDir != "":
+		opts.dir = *psbtDir
+	case *outDir != "":
+		opts.dir = *outDir
+	}
+	if err := BuildInscriptionBatch(source, manifest, opts); err != nil {
+		p.Println(err.Error())
+	}
+}
+
+// BuildInscriptionBatch inscribes the files of manifest with one commit and
+// broadcasts the commit, then the reveals. The batch state is written before
+// anything is broadcast; with psbt or dryRun the transactions are written to
+// dir instead.
+func BuildInscriptionBatch(source UtxoSource, manifest *batchManifest, opts inscribeOptions) error {
+	funding, err := loadRevealFunding(source, opts.psbt)
+	if err != nil {
+		return err
+	}
+	destination := opts.destination
+	if destination == "" {
+		destination = funding.wallet.Address
+	}
+	items, err := manifest.items(destination)
+	if err != nil {
+		return err
+	}
+	parents, err := locateParents(source, funding, opts)
+	if err != nil {
+		return err
+	}
+	mode, postage := manifest.Mode, manifest.Postage
+	if mode == "" {
+		mode = BatchSeparateOutputs
+	}
+	if postage == 0 {
+		postage = defaultRevealOutValue
+	}
+	recovery, err := config.GetRecoveryScript(funding.pubKey)
+	if err != nil {
+		return err
+	}
+	batch, err := buildInscriptionBatch(funding.pubKey, funding.utxos, items, parents, recovery, mode, postage, funding.feeRate, config.GetNetwork())
+	if err != nil {
+		return err
+	}
+	commitFee, revealFee := batch.fees(funding.utxos)
+	p.Printf("Batch of %d inscriptions in %d reveals at %d sat/vB: commit fee %d, reveal fees %d, total fee %d\n",
+		len(items), len(batch.reveals), funding.feeRate, commitFee, revealFee, commitFee+revealFee)
+
+	var commit []byte
+	var reveals [][]byte
+	if opts.psbt {
+		commit, reveals, err = batch.psbts(funding.wallet.PubKeys, funding.utxos, source.GetRawTx)
+	} else {
+		commit, reveals, err = batch.sign(funding.privateKey, funding.wallet.Keys, funding.utxos)
+	}
+	if err != nil {
+		return err
+	}
+	if !opts.psbt {
+		if err := VerifyRawTx(commit, VerifyOptions{PrevOuts: UtxoList(funding.utxos), FeeRate: funding.feeRate}); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		for i, r := range batch.reveals {
+			if err := VerifyRawTx(reveals[i], VerifyOptions{PrevOuts: r.prevOuts(), FeeRate: funding.feeRate}); err != nil {
+				return fmt.Errorf("reveal %d: %w", i, err)
+			}
+			printRevealFee(r)
+		}
+	}
+	var state *batchState
+	if opts.psbt {
+		state, err = newBatchState(batch, manifest, items, parents, funding.feeRate, nil, nil)
+	} else {
+		state, err = newBatchState(batch, manifest, items, parents, funding.feeRate, commit, reveals)
+	}
+	if err != nil {
+		return err
+	}
+	stateFile := opts.stateFile
+	if stateFile == "" {
+		stateFile = filepath.Join(opts.dir, "inscribe-"+state.Commit+".json")
+	}
+	if err := state.write(stateFile); err != nil {
+		return err
+	}
+
+	if opts.psbt || opts.dryRun {
+		if err := writeTxFiles(opts.dir, "inscribe-commit", commit, opts.psbt, batch.commitTx, UtxoList(funding.utxos)); err != nil {
+			return err
+		}
+		for i, r := range batch.reveals {
+			name := fmt.Sprintf("inscribe-reveal-%03d", i)
+			if err := writeTxFiles(opts.dir, name, reveals[i], opts.psbt, r.revealTx, r.prevOuts()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	commitTxid, err := source.SendTx(commit)
+	if err != nil {
+		return err
+	}
+	p.Printf("Commit transaction broadcast: %s\n", commitTxid)
+	for i, reveal := range reveals {
+		txid, err := source.SendTx(reveal)
+		if err != nil {
+			p.Printf("Reveal %d broadcast failed, see %s to recover: %s\n", i, stateFile, err)
+			continue
+		}
+		p.Printf("Reveal transaction broadcast: %s\n", txid)
+	}
+	for _, id := range batch.inscriptionIds(len(items)) {
+		p.Printf("Inscription %s\n", id)
+	}
+	return nil
+}
+
+// printRevealFee reports what a signed reveal pays over the fee its vsize
+// requires.
+func printRevealFee(r *revealTxs) {
+	if r.fee == nil {
+		return
+	}
+	p.Printf("Reveal %d vB pays %d sat, %d sat/vB requires %d: %+d sat\n",
+		r.fee.Vsize, r.fee.Fee, r.feeRate, r.fee.Required, r.fee.Overpaid())
+}
+
+// locateParents finds the outputs of the parent inscriptions with the
+// InscriptionLocator of RuneSource and leaves them out of the funding utxos.
+// The wallet must be able to spend them.
+func locateParents(source UtxoSource, funding *revealFunding, opts inscribeOptions) ([]*BatchParent, error) {
+	if len(opts.parents) == 0 {
+		return nil, nil
+	}
+	runeSource, err := config.GetRuneSource()
+	if err != nil {
+		return nil, err
+	}
+	locator, ok := runeSource.(InscriptionLocator)
+	if !ok {
+		return nil, errors.New("parent inscriptions are located with RuneSource ord")
+	}
+	var destination []byte
+	if opts.parentDestination != "" {
+		if destination, err = addressScript(opts.parentDestination); err != nil {
+			return nil, err
+		}
+	}
+	var parents []*BatchParent
+	for _, s := range opts.parents {
+		id, err := InscriptionIdFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		outpoint, err := locator.InscriptionOutput(id)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := source.GetRawTx(outpoint.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if int(outpoint.Index) >= len(tx.TxOut) {
+			return nil, fmt.Errorf("parent %s: no output %s", id, outpoint)
+		}
+		out := tx.TxOut[outpoint.Index]
+		if opts.psbt {
+			_, err = funding.wallet.PubKeys.PubKeyForScript(out.PkScript)
+		} else {
+			_, err = funding.wallet.Keys.KeyForScript(out.PkScript)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parent %s is on %s, which the wallet cannot spend: %w", id, outpoint, err)
+		}
+		parent := &BatchParent{
+			Id:          id,
+			Utxo:        &Utxo{TxHash: HexToHash(outpoint.Hash.String()), Index: outpoint.Index, Value: out.Value, PkScript: out.PkScript},
+			Destination: destination,
+		}
+		if parent.Destination == nil {
+			parent.Destination = out.PkScript
+		}
+		parents = append(parents, parent)
+		funding.exclude(outpoint)
+	}
+	return parents, nil
+}
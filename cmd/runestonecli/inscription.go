@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+// Inscription is what a reveal writes into its envelope. Empty fields are left
+// out; a nil Body makes an inscription without body.
+type Inscription struct {
+	ContentType     string
+	ContentEncoding string
+	Metaprotocol    string
+	Parents         []InscriptionId
+	Delegate        *InscriptionId
+	Pointer         *uint64
+	Metadata        []byte // CBOR
+	Rune            *runestone.Rune
+	Body            []byte
+}
+
+// Envelope returns OP_FALSE OP_IF "ord", the fields as tag and value pushes,
+// then OP_0 and the body, up to OP_ENDIF. Fields come in the order ord writes
+// them; metadata and the body are split into pushes of at most 520 bytes.
+func (ins *Inscription) Envelope() []byte {
+	script := []byte{txscript.OP_FALSE, txscript.OP_IF}
+	script = appendPush(script, envelopeProtocolId)
+	field := func(tag byte, value []byte) {
+		script = appendPush(script, []byte{tag})
+		script = appendPush(script, value)
+	}
+	if ins.ContentType != "" {
+		field(TagContentType, []byte(ins.ContentType))
+	}
+	if ins.ContentEncoding != "" {
+		field(TagContentEncoding, []byte(ins.ContentEncoding))
+	}
+	if ins.Metaprotocol != "" {
+		field(TagMetaprotocol, []byte(ins.Metaprotocol))
+	}
+	for _, parent := range ins.Parents {
+		field(TagParent, parent.fieldValue())
+	}
+	if ins.Delegate != nil {
+		field(TagDelegate, ins.Delegate.fieldValue())
+	}
+	if ins.Pointer != nil {
+		var le [8]byte
+		binary.LittleEndian.PutUint64(le[:], *ins.Pointer)
+		field(TagPointer, trimTrailingZeros(le[:]))
+	}
+	for _, chunk := range chunks(ins.Metadata) {
+		field(TagMetadata, chunk)
+	}
+	if ins.Rune != nil {
+		field(TagRune, ins.Rune.Commitment())
+	}
+	if ins.Body != nil {
+		script = append(script, txscript.OP_0)
+		for _, chunk := range chunks(ins.Body) {
+			script = appendPush(script, chunk)
+		}
+	}
+	return append(script, txscript.OP_ENDIF)
+}
+
+// Script returns the leaf script of the reveal: a signature check against pk
+// followed by the envelope.
+func (ins *Inscription) Script(pk *btcec.PublicKey) []byte {
+	script := appendPush(nil, schnorr.SerializePubKey(pk))
+	script = append(script, txscript.OP_CHECKSIG)
+	return append(script, ins.Envelope()...)
+}
+
+// RevealVsize estimates the vsize of a reveal spending the leaf script of ins
+// with a schnorr signature and paying outputs, before the key and the commit
+// transaction are known.
+func (ins *Inscription) RevealVsize(outputs ...*wire.TxOut) int64 {
+	// the key push and OP_CHECKSIG
+	script := append(make([]byte, 1+schnorr.PubKeyBytesLen+1), ins.Envelope()...)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	for _, out := range outputs {
+		tx.AddTxOut(out)
+	}
+	return revealVsize(tx, script)
+}
+
+// fieldValue encodes the id as ord does: the txid, then the index in little
+// endian without trailing zeros.
+func (id InscriptionId) fieldValue() []byte {
+	var le [4]byte
+	binary.LittleEndian.PutUint32(le[:], id.Index)
+	return append(append([]byte{}, id.Txid[:]...), trimTrailingZeros(le[:])...)
+}
+
+func trimTrailingZeros(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// chunks splits data into pushes a tapscript may hold.
+func chunks(data []byte) [][]byte {
+	var split [][]byte
+	for len(data) > txscript.MaxScriptElementSize {
+		split = append(split, data[:txscript.MaxScriptElementSize])
+		data = data[txscript.MaxScriptElementSize:]
+	}
+	if len(data) > 0 {
+		split = append(split, data)
+	}
+	return split
+}
+
+// appendPush appends a push of data as is. txscript.ScriptBuilder would turn a
+// push of a single byte up to 16 into OP_1..OP_16, which ord reads as pushnum,
+// and limits scripts to 10000 bytes, which a tapscript may exceed.
+func appendPush(script, data []byte) []byte {
+	switch n := len(data); {
+	case n == 0:
+		return append(script, txscript.OP_0)
+	case n <= txscript.OP_DATA_75:
+		script = append(script, byte(n))
+	case n <= 0xff:
+		script = append(script, txscript.OP_PUSHDATA1, byte(n))
+	case n <= 0xffff:
+		script = append(script, txscript.OP_PUSHDATA2)
+		script = binary.LittleEndian.AppendUint16(script, uint16(n))
+	default:
+		script = append(script, txscript.OP_PUSHDATA4)
+		script = binary.LittleEndian.AppendUint32(script, uint32(n))
+	}
+	return append(script, data...)
+}
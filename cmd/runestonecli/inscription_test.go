@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInscriptionEnvelopeRoundTrip(t *testing.T) {
+	parent := InscriptionId{Txid: chainhash.Hash{1, 2, 3}, Index: 256}
+	delegate := InscriptionId{Txid: chainhash.Hash{4}}
+	metadata := bytes.Repeat([]byte{0xa1}, 600)
+	ins := &Inscription{
+		ContentType:     "text/plain;charset=utf-8",
+		ContentEncoding: "br",
+		Metaprotocol:    "brc-20",
+		Parents:         []InscriptionId{parent, {Txid: chainhash.Hash{5}, Index: 1}},
+		Delegate:        &delegate,
+		Pointer:         uint64P(1000),
+		Metadata:        metadata,
+		Rune:            runeP(0x1234),
+		Body:            []byte("hello"),
+	}
+	envelopes, err := ParseTapscriptEnvelopes(ins.Envelope(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Envelope{{
+		ContentType:     []byte(ins.ContentType),
+		ContentEncoding: []byte("br"),
+		Metaprotocol:    []byte("brc-20"),
+		Parents:         ins.Parents,
+		Delegate:        &delegate,
+		Pointer:         uint64P(1000),
+		Metadata:        metadata,
+		Rune:            runeP(0x1234),
+		Body:            []byte("hello"),
+		// metadata takes two fields
+		DuplicateField: true,
+	}}, envelopes)
+}
+
+func TestInscriptionEnvelopeEncoding(t *testing.T) {
+	assert.Equal(t, envelopeScript(ord), (&Inscription{}).Envelope())
+	assert.Equal(t, envelopeScript(ord, []byte{1}, []byte("a"), []byte{}),
+		(&Inscription{ContentType: "a", Body: []byte{}}).Envelope())
+	// the smallest values are encoded without trailing zeros
+	assert.Equal(t, envelopeScript(ord, []byte{3}, make([]byte, 32), []byte{2}, []byte{}),
+		(&Inscription{Parents: []InscriptionId{{}}, Pointer: uint64P(0)}).Envelope())
+	// single bytes are pushed as data, not as OP_1..OP_16
+	assert.Equal(t, envelopeScript(ord, []byte{}, []byte{5}),
+		(&Inscription{Body: []byte{5}}).Envelope())
+}
+
+func TestInscriptionBodyChunks(t *testing.T) {
+	body := bytes.Repeat([]byte{7}, 2*txscript.MaxScriptElementSize+1)
+	tokens, err := tokenizeScript((&Inscription{Body: body}).Envelope())
+	assert.NoError(t, err)
+	var sizes []int
+	for _, token := range tokens[4 : len(tokens)-1] {
+		sizes = append(sizes, len(token.data))
+	}
+	assert.Equal(t, []int{520, 520, 1}, sizes)
+
+	envelopes, err := ParseTapscriptEnvelopes((&Inscription{Body: body}).Envelope(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, body, envelopes[0].Body)
+}
+
+func TestInscriptionRevealVsize(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	assert.NoError(t, err)
+	ins := &Inscription{ContentType: "image/png", Body: bytes.Repeat([]byte{1}, 5000)}
+	receiver, err := getP2TRAddress(key.PubKey(), &chaincfg.RegressionNetParams)
+	assert.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(receiver)
+	assert.NoError(t, err)
+	out := wire.NewTxOut(defaultRevealOutValue, pkScript)
+
+	script := ins.Script(key.PubKey())
+	leaf := txscript.NewBaseTapLeaf(script)
+	tree := txscript.AssembleTaprootScriptTree(leaf)
+	proof := tree.LeafMerkleProofs[0].ToControlBlock(key.PubKey())
+	controlBlock, err := proof.ToBytes()
+	assert.NoError(t, err)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	tx.AddTxOut(out)
+	prevOuts := txscript.NewCannedPrevOutputFetcher(out.PkScript, 10000)
+	sig, err := txscript.RawTxInTapscriptSignature(tx, txscript.NewTxSigHashes(tx, prevOuts), 0, 10000, out.PkScript, leaf, txscript.SigHashDefault, key)
+	assert.NoError(t, err)
+	assert.Len(t, sig, schnorr.SignatureSize)
+	tx.TxIn[0].Witness = wire.TxWitness{sig, script, controlBlock}
+
+	weight := blockchain.GetTransactionWeight(btcutil.NewTx(tx))
+	assert.Equal(t, (weight+3)/4, ins.RevealVsize(out))
+}
+
+func TestRevealFeeFromSignedSize(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	assert.NoError(t, err)
+	receiver, err := getP2TRAddress(key.PubKey(), net)
+	assert.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(receiver)
+	assert.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 1000000, PkScript: pkScript}}
+	ins := &Inscription{ContentType: "text/plain", Body: bytes.Repeat([]byte{1}, 3000)}
+	opReturn := []byte{txscript.OP_RETURN, txscript.OP_13, txscript.OP_DATA_2, 0, 1}
+
+	for _, feeRate := range []int64{1, 7, 33} {
+		txs, err := buildInscriptionRevealTxs(key.PubKey(), utxo, ins, feeRate, defaultRevealOutValue, net, opReturn, nil)
+		assert.NoError(t, err)
+		_, reveal, err := txs.sign(key, singleKey{key}, utxo)
+		assert.NoError(t, err)
+		revealTx := &wire.MsgTx{}
+		assert.NoError(t, revealTx.Deserialize(bytes.NewReader(reveal)))
+		vsize := (blockchain.GetTransactionWeight(btcutil.NewTx(revealTx)) + 3) / 4
+		// a schnorr signature has one size, so the estimate is exact
+		assert.Equal(t, &revealFee{Vsize: vsize, Fee: vsize * feeRate, Required: vsize * feeRate}, txs.fee)
+		assert.Zero(t, txs.fee.Overpaid())
+	}
+
+	// a commit output short of the fee is caught once signed
+	txs, err := buildInscriptionRevealTxs(key.PubKey(), utxo, ins, 10, defaultRevealOutValue, net, nil, nil)
+	assert.NoError(t, err)
+	txs.commitTx.TxOut[0].Value--
+	_, _, err = txs.sign(key, singleKey{key}, utxo)
+	assert.ErrorContains(t, err, "1 short of 10 sat/vB")
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// runKey manages the keystore: key import|export|list.
+func runKey(args []string) {
+	if len(args) == 0 {
+		p.Printf("Usage: key import|export|list\n")
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "import":
+		err = runKeyImport(args[1:])
+	case "export":
+		err = runKeyExport(args[1:])
+	case "list":
+		err = runKeyList()
+	default:
+		p.Printf("Unknown command: %s\n", "key "+args[0])
+		os.Exit(2)
+	}
+	if err != nil {
+		p.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+func runKeyImport(args []string) error {
+	fs := flag.NewFlagSet("key import", flag.ExitOnError)
+	fromConfig := fs.Bool("from-config", false, "import the plaintext PrivateKey and Wallets keys of config.yaml; wallet i is named <name>-<i>")
+	hd := fs.Bool("hd", false, "import an extended private key or BIP39 mnemonic as a BIP86 account")
+	fs.IntVar(&passphraseFd, "passphrase-fd", -1, "read the keystore passphrase from this file descriptor")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: key import [--from-config|--hd] <name>")
+	}
+	name := fs.Arg(0)
+
+	ks, err := config.GetKeystore()
+	if err != nil {
+		return err
+	}
+	if *hd {
+		return importHDKey(ks, name)
+	}
+	secrets := map[string]string{}
+	var names []string
+	if *fromConfig {
+		if config.PrivateKey != "" {
+			names = append(names, name)
+			secrets[name] = config.PrivateKey
+		}
+		for i, w := range config.Wallets {
+			if w.PrivateKey != "" {
+				walletName := fmt.Sprintf("%s-%d", name, i)
+				names = append(names, walletName)
+				secrets[walletName] = w.PrivateKey
+			}
+		}
+		if len(names) == 0 {
+			return errors.New("no PrivateKey in config.yaml")
+		}
+	} else {
+		secret, err := promptSecret(i18n("Private key (hex or WIF)"))
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		secrets[name] = secret
+	}
+
+	passphrase, err := keystorePassphrase(ks)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		privKey, err := parsePrivateKey(secrets[n])
+		if err != nil {
+			return fmt.Errorf("key %q: %w", n, err)
+		}
+		if err := ks.Add(n, privKey, passphrase); err != nil {
+			return err
+		}
+	}
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	for _, n := range names {
+		p.Printf("Imported key %s into %s\n", n, config.GetKeystorePath())
+	}
+	if *fromConfig {
+		p.Printf("Remove PrivateKey from config.yaml and set Key (and Wallets[].Key) to the names above\n")
+	}
+	return nil
+}
+
+func importHDKey(ks *Keystore, name string) error {
+	secret, err := promptSecret(i18n("Extended private key or mnemonic"))
+	if err != nil {
+		return err
+	}
+	var bip39Passphrase string
+	if len(strings.Fields(secret)) > 1 {
+		if bip39Passphrase, err = promptSecret(i18n("BIP39 passphrase (empty for none)")); err != nil {
+			return err
+		}
+	}
+	account, err := parseHDAccount(secret, bip39Passphrase, config.GetNetwork())
+	if err != nil {
+		return err
+	}
+	passphrase, err := keystorePassphrase(ks)
+	if err != nil {
+		return err
+	}
+	if err := ks.AddHD(name, account, passphrase); err != nil {
+		return err
+	}
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	p.Printf("Imported key %s into %s\n", name, config.GetKeystorePath())
+	return nil
+}
+
+// keystorePassphrase asks for the passphrase of ks. A new keystore asks twice;
+// otherwise the passphrase must open the existing keys, so that one passphrase
+// unlocks every mint wallet.
+func keystorePassphrase(ks *Keystore) ([]byte, error) {
+	if len(ks.Keys) == 0 {
+		return getPassphrase(true)
+	}
+	passphrase, err := getPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Keys[0].Unlock(passphrase); err != nil {
+		return nil, err
+	}
+	return passphrase, nil
+}
+
+func runKeyExport(args []string) error {
+	fs := flag.NewFlagSet("key export", flag.ExitOnError)
+	fs.IntVar(&passphraseFd, "passphrase-fd", -1, "read the keystore passphrase from this file descriptor")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: key export <name>")
+	}
+	ks, err := config.GetKeystore()
+	if err != nil {
+		return err
+	}
+	key, err := ks.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	passphrase, err := getPassphrase(false)
+	if err != nil {
+		return err
+	}
+	if key.Type == keyTypeHD {
+		account, err := key.DecryptHD(passphrase)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, i18n("Anyone with this key can spend the coins of its address"))
+		fmt.Println(account.String())
+		return nil
+	}
+	privKey, err := key.Decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, i18n("Anyone with this key can spend the coins of its address"))
+	fmt.Println(hex.EncodeToString(privKey.Serialize()))
+	return nil
+}
+
+func runKeyList() error {
+	ks, err := config.GetKeystore()
+	if err != nil {
+		return err
+	}
+	state, err := config.GetHDState()
+	if err != nil {
+		return err
+	}
+	for _, key := range ks.Keys {
+		if key.Type == keyTypeHD {
+			// list the recorded addresses of the account with their paths
+			fmt.Printf("%s\t%s\n", key.Name, key.XPub)
+			xpub, err := key.AccountXPub()
+			if err != nil {
+				return fmt.Errorf("key %q: %w", key.Name, err)
+			}
+			hd, err := newHDWallet(key.Name, xpub, config.GetNetwork(), state)
+			if err != nil {
+				fmt.Printf("\t%s\n", err)
+				continue
+			}
+			for _, a := range hd.Addresses() {
+				fmt.Printf("\t%s\t%s\n", a.Path, a.Address)
+			}
+			continue
+		}
+		pubKey, err := key.PublicKey()
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.Name, err)
+		}
+		address, err := config.taprootAddress(pubKey)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%s\n", key.Name, address)
+	}
+	return nil
+}
+
+// parsePrivateKey accepts a hex private key, as exported by unisat, or WIF.
+func parsePrivateKey(s string) (*btcec.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+	if b, err := hex.DecodeString(s); err == nil {
+		defer zero(b)
+		if len(b) != btcec.PrivKeyBytesLen {
+			return nil, fmt.Errorf("private key must be %d bytes", btcec.PrivKeyBytesLen)
+		}
+		privKey, _ := btcec.PrivKeyFromBytes(b)
+		return privKey, nil
+	}
+	wif, err := btcutil.DecodeWIF(s)
+	if err != nil {
+		return nil, errors.New("private key is neither hex nor WIF")
+	}
+	return wif.PrivKey, nil
+}
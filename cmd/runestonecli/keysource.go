@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// KeySource finds the private key that spends an output, given its script.
+type KeySource interface {
+	KeyForScript(pkScript []byte) (*btcec.PrivateKey, error)
+}
+
+// PubKeySource finds the public key of an output, given its script. It is all
+// a watch-only machine needs to export PSBTs for an offline signer.
+type PubKeySource interface {
+	PubKeyForScript(pkScript []byte) (*btcec.PublicKey, error)
+}
+
+// singlePubKey owns every output type of one key that signInput supports.
+type singlePubKey struct {
+	*btcec.PublicKey
+}
+
+func (k singlePubKey) PubKeyForScript(pkScript []byte) (*btcec.PublicKey, error) {
+	// the network only changes the address encoding, not the script
+	addresses, err := keyAddresses(k.PublicKey, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addresses {
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(script, pkScript) {
+			return k.PublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("no key for script %x", pkScript)
+}
+
+// singleKey spends every output type of one key that signInput supports.
+type singleKey struct {
+	*btcec.PrivateKey
+}
+
+func (k singleKey) KeyForScript(pkScript []byte) (*btcec.PrivateKey, error) {
+	if _, err := k.PubKeyForScript(pkScript); err != nil {
+		return nil, err
+	}
+	return k.PrivateKey, nil
+}
+
+func (k singleKey) PubKeyForScript(pkScript []byte) (*btcec.PublicKey, error) {
+	return singlePubKey{k.PubKey()}.PubKeyForScript(pkScript)
+}
+
+// keyAddresses returns the key-path-only taproot address of pubKey followed
+// by its p2wpkh, p2sh-p2wpkh and p2pkh addresses.
+func keyAddresses(pubKey *btcec.PublicKey, net *chaincfg.Params) ([]btcutil.Address, error) {
+	p2tr, err := getP2TRAddress(pubKey, net)
+	if err != nil {
+		return nil, err
+	}
+	keyHash := btcutil.Hash160(pubKey.SerializeCompressed())
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(keyHash, net)
+	if err != nil {
+		return nil, err
+	}
+	redeemScript, err := p2wpkhScript(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	p2sh, err := btcutil.NewAddressScriptHash(redeemScript, net)
+	if err != nil {
+		return nil, err
+	}
+	p2pkh, err := btcutil.NewAddressPubKeyHash(keyHash, net)
+	if err != nil {
+		return nil, err
+	}
+	return []btcutil.Address{p2tr, p2wpkh, p2sh, p2pkh}, nil
+}
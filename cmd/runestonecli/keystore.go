@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/manifoldco/promptui"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Keystore is a JSON file of private keys, each sealed with AES-256-GCM under
+// a key derived from the passphrase with scrypt. Public keys are stored in the
+// clear so that addresses can be listed and imported without the passphrase.
+type Keystore struct {
+	path string
+	Keys []*KeystoreKey `json:"keys"`
+}
+
+type KeystoreKey struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type,omitempty"`   // "" for a single key, "hd" for a BIP86 account
+	PubKey     string      `json:"pubkey,omitempty"` // compressed, hex
+	XPub       string      `json:"xpub,omitempty"`   // account key m/86'/coin'/account' of an hd key
+	KDF        keystoreKDF `json:"kdf"`
+	Nonce      string      `json:"nonce"`
+	Ciphertext string      `json:"ciphertext"`
+}
+
+type keystoreKDF struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+const keyTypeHD = "hd"
+
+const (
+	scryptN = 1 << 18
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// LoadKeystore reads the keystore at path. A missing file is an empty keystore.
+func LoadKeystore(path string) (*Keystore, error) {
+	ks := &Keystore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, fmt.Errorf("keystore %s: %w", path, err)
+	}
+	return ks, nil
+}
+
+// Save writes the keystore readable by the owner only.
+func (ks *Keystore) Save() error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ks.path)
+}
+
+func (ks *Keystore) Get(name string) (*KeystoreKey, error) {
+	for _, k := range ks.Keys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q not found in keystore %s", name, ks.path)
+}
+
+// Add encrypts privKey with passphrase and stores it as name.
+func (ks *Keystore) Add(name string, privKey *btcec.PrivateKey, passphrase []byte) error {
+	secret := privKey.Serialize()
+	defer zero(secret)
+	return ks.add(&KeystoreKey{
+		Name:   name,
+		PubKey: hex.EncodeToString(privKey.PubKey().SerializeCompressed()),
+	}, secret, passphrase)
+}
+
+// AddHD encrypts the private BIP86 account key and stores it as name.
+func (ks *Keystore) AddHD(name string, account *hdkeychain.ExtendedKey, passphrase []byte) error {
+	if !account.IsPrivate() {
+		return errors.New("account key is not private")
+	}
+	xpub, err := account.Neuter()
+	if err != nil {
+		return err
+	}
+	secret := []byte(account.String())
+	defer zero(secret)
+	return ks.add(&KeystoreKey{Name: name, Type: keyTypeHD, XPub: xpub.String()}, secret, passphrase)
+}
+
+func (ks *Keystore) add(key *KeystoreKey, secret, passphrase []byte) error {
+	if key.Name == "" {
+		return errors.New("key name is required")
+	}
+	if _, err := ks.Get(key.Name); err == nil {
+		return fmt.Errorf("key %q already exists", key.Name)
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key.KDF = keystoreKDF{Name: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: hex.EncodeToString(salt)}
+	aead, err := key.cipher(passphrase)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key.Nonce = hex.EncodeToString(nonce)
+	key.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, secret, key.additionalData()))
+	ks.Keys = append(ks.Keys, key)
+	return nil
+}
+
+// PublicKey returns the public key without decrypting.
+func (k *KeystoreKey) PublicKey() (*btcec.PublicKey, error) {
+	if k.Type != "" {
+		return nil, fmt.Errorf("key %q is an %s key", k.Name, k.Type)
+	}
+	b, err := hex.DecodeString(k.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	return btcec.ParsePubKey(b)
+}
+
+// AccountXPub returns the public account key of an hd key without decrypting.
+func (k *KeystoreKey) AccountXPub() (*hdkeychain.ExtendedKey, error) {
+	if k.Type != keyTypeHD {
+		return nil, fmt.Errorf("key %q is not an hd key", k.Name)
+	}
+	return hdkeychain.NewKeyFromString(k.XPub)
+}
+
+// Decrypt returns the private key, or ErrWrongPassphrase.
+func (k *KeystoreKey) Decrypt(passphrase []byte) (*btcec.PrivateKey, error) {
+	if k.Type != "" {
+		return nil, fmt.Errorf("key %q is an %s key", k.Name, k.Type)
+	}
+	secret, err := k.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(secret)
+	privKey, pubKey := btcec.PrivKeyFromBytes(secret)
+	if hex.EncodeToString(pubKey.SerializeCompressed()) != k.PubKey {
+		return nil, fmt.Errorf("key %q: public key mismatch", k.Name)
+	}
+	return privKey, nil
+}
+
+// DecryptHD returns the private account key of an hd key, or
+// ErrWrongPassphrase.
+func (k *KeystoreKey) DecryptHD(passphrase []byte) (*hdkeychain.ExtendedKey, error) {
+	if k.Type != keyTypeHD {
+		return nil, fmt.Errorf("key %q is not an hd key", k.Name)
+	}
+	secret, err := k.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(secret)
+	account, err := hdkeychain.NewKeyFromString(string(secret))
+	if err != nil {
+		return nil, err
+	}
+	xpub, err := account.Neuter()
+	if err != nil {
+		return nil, err
+	}
+	if xpub.String() != k.XPub {
+		return nil, fmt.Errorf("key %q: account key mismatch", k.Name)
+	}
+	return account, nil
+}
+
+// Unlock checks passphrase against the key, whatever its type.
+func (k *KeystoreKey) Unlock(passphrase []byte) error {
+	secret, err := k.open(passphrase)
+	if err != nil {
+		return err
+	}
+	zero(secret)
+	return nil
+}
+
+func (k *KeystoreKey) open(passphrase []byte) ([]byte, error) {
+	aead, err := k.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(k.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(k.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("key %q: bad nonce", k.Name)
+	}
+	secret, err := aead.Open(nil, nonce, ciphertext, k.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return secret, nil
+}
+
+// additionalData binds the ciphertext to the public part of the key.
+func (k *KeystoreKey) additionalData() []byte {
+	return []byte(k.PubKey + k.XPub)
+}
+
+func (k *KeystoreKey) cipher(passphrase []byte) (cipher.AEAD, error) {
+	if k.KDF.Name != "scrypt" {
+		return nil, fmt.Errorf("key %q: unsupported kdf %q", k.Name, k.KDF.Name)
+	}
+	salt, err := hex.DecodeString(k.KDF.Salt)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key(passphrase, salt, k.KDF.N, k.KDF.R, k.KDF.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(derived)
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// passphraseFd is set by --passphrase-fd; -1 means not given.
+var passphraseFd = -1
+
+var cachedPassphrase []byte
+
+// getPassphrase returns the keystore passphrase, read once per run from
+// RUNESTONE_PASSPHRASE, from the file descriptor given by --passphrase-fd or
+// RUNESTONE_PASSPHRASE_FD, or from a prompt. confirm asks twice when prompting
+// for a new passphrase.
+func getPassphrase(confirm bool) ([]byte, error) {
+	if cachedPassphrase != nil {
+		return cachedPassphrase, nil
+	}
+	passphrase, err := readPassphrase(confirm)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	cachedPassphrase = passphrase
+	return passphrase, nil
+}
+
+func readPassphrase(confirm bool) ([]byte, error) {
+	if env := os.Getenv("RUNESTONE_PASSPHRASE"); env != "" {
+		return []byte(env), nil
+	}
+	fd := passphraseFd
+	if env := os.Getenv("RUNESTONE_PASSPHRASE_FD"); fd < 0 && env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil {
+			return nil, fmt.Errorf("RUNESTONE_PASSPHRASE_FD: %w", err)
+		}
+		fd = n
+	}
+	if fd >= 0 {
+		f := os.NewFile(uintptr(fd), "passphrase")
+		if f == nil {
+			return nil, fmt.Errorf("bad passphrase fd %d", fd)
+		}
+		defer f.Close()
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("read passphrase from fd %d: %w", fd, err)
+		}
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+
+	passphrase, err := promptSecret(i18n("Keystore passphrase"))
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := promptSecret(i18n("Repeat passphrase"))
+		if err != nil {
+			return nil, err
+		}
+		if again != passphrase {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+	return []byte(passphrase), nil
+}
+
+func promptSecret(label string) (string, error) {
+	prompt := promptui.Prompt{Label: label, Mask: '*'}
+	return prompt.Run()
+}
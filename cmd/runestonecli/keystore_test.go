@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	ks, err := LoadKeystore(path)
+	require.NoError(t, err)
+	assert.Empty(t, ks.Keys)
+
+	privKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	passphrase := []byte("correct horse")
+	require.NoError(t, ks.Add("mint", privKey, passphrase))
+	assert.ErrorContains(t, ks.Add("mint", privKey, passphrase), "already exists")
+	require.NoError(t, ks.Save())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), privKey.Key.String())
+
+	ks, err = LoadKeystore(path)
+	require.NoError(t, err)
+	key, err := ks.Get("mint")
+	require.NoError(t, err)
+	pubKey, err := key.PublicKey()
+	require.NoError(t, err)
+	assert.True(t, pubKey.IsEqual(privKey.PubKey()), "without the passphrase")
+	decrypted, err := key.Decrypt(passphrase)
+	require.NoError(t, err)
+	assert.Equal(t, privKey.Serialize(), decrypted.Serialize())
+
+	_, err = key.Decrypt([]byte("wrong horse"))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	_, err = ks.Get("other")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestKeystoreHD(t *testing.T) {
+	ks, err := LoadKeystore(filepath.Join(t.TempDir(), "keystore.json"))
+	require.NoError(t, err)
+	master, err := hdkeychain.NewMaster(make([]byte, 32), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	passphrase := []byte("correct horse")
+	xpub, err := master.Neuter()
+	require.NoError(t, err)
+	assert.ErrorContains(t, ks.AddHD("hd", xpub, passphrase), "not private")
+	require.NoError(t, ks.AddHD("hd", master, passphrase))
+
+	key, err := ks.Get("hd")
+	require.NoError(t, err)
+	account, err := key.DecryptHD(passphrase)
+	require.NoError(t, err)
+	assert.Equal(t, master.String(), account.String())
+	_, err = key.Decrypt(passphrase)
+	assert.ErrorContains(t, err, "is an hd key")
+	public, err := key.AccountXPub()
+	require.NoError(t, err)
+	assert.Equal(t, xpub.String(), public.String())
+}
+
+func TestKeystoreCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [`), 0600))
+	_, err := LoadKeystore(path)
+	assert.ErrorContains(t, err, "keystore "+path)
+
+	ks := &Keystore{path: path}
+	privKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	passphrase := []byte("correct horse")
+	require.NoError(t, ks.Add("mint", privKey, passphrase))
+	sealed := *ks.Keys[0]
+
+	// any change to the sealed key or to what it is bound to fails to open
+	key := sealed
+	key.Ciphertext = "00" + key.Ciphertext[2:]
+	_, err = key.Decrypt(passphrase)
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	other, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	key = sealed
+	key.PubKey = hex.EncodeToString(other.PubKey().SerializeCompressed())
+	_, err = key.Decrypt(passphrase)
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	key = sealed
+	key.Nonce = key.Nonce[2:]
+	_, err = key.Decrypt(passphrase)
+	assert.ErrorContains(t, err, "bad nonce")
+	key = sealed
+	key.KDF.Name = "pbkdf2"
+	_, err = key.Decrypt(passphrase)
+	assert.ErrorContains(t, err, "unsupported kdf")
+}
+
+func TestConfigRefusesPrivateKey(t *testing.T) {
+	c := Config{Key: "mint", PrivateKey: "cVpF924EspNh8KjYsfhgY96mmxvT6DgdWiTYMtMjuM74hJaU5psW"}
+	_, err := c.GetKeyNames()
+	assert.ErrorContains(t, err, "key import --from-config")
+
+	c.PrivateKey = ""
+	c.Wallets = append(c.Wallets, struct {
+		Key        string
+		PrivateKey string
+	}{PrivateKey: "cVpF924EspNh8KjYsfhgY96mmxvT6DgdWiTYMtMjuM74hJaU5psW"})
+	_, err = c.GetKeyNames()
+	assert.ErrorContains(t, err, "wallet 0: PrivateKey")
+
+	c.Wallets[0] = struct {
+		Key        string
+		PrivateKey string
+	}{Key: "mint"}
+	names, err := c.GetKeyNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mint"}, names)
+}
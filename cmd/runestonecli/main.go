@@ -5,31 +5,18 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"io"
-	"math"
+	"os"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"fmt"
 	"net/http"
 
 	"github.com/btcsuite/btcd/wire"
-	"github.com/bxelab/runestone"
 	"github.com/spf13/viper"
 	"golang.org/x/text/message"
 )
 
-var (
-	lastRequestTime time.Time
-	sharedAvgFee10  int64
-	mu              sync.Mutex
-)
-
-type FeeData struct {
-	AvgFee10 int64 `json:"avgFee_90"` //avgFee_10 avgFee_25 avgFee_50 avgFee_75 avgFee_90
-}
-
 var config = DefaultConfig()
 var p *message.Printer
 var walletName = ""
@@ -38,16 +25,76 @@ func main() {
 	p = message.NewPrinter(lang)
 	loadConfig()
 
-	//获取并导入钱包
+	command, args := "mint", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "mint":
+		runMint(args)
+	case "key":
+		runKey(args)
+	case "finalize":
+		runFinalize(args)
+	case "rescan":
+		runRescan(args)
+	case "decode":
+		runDecode(args)
+	case "etch":
+		runEtch(args)
+	case "inscribe":
+		runInscribe(args)
+	case "recover":
+		runRecover(args)
+	case "balance":
+		runBalance(args)
+	default:
+		p.Printf("Unknown command: %s\n", command)
+		os.Exit(2)
+	}
+}
+
+// loadWallet 获取并导入钱包
+func loadWallet() bool {
 	var err error
 	walletName, err = config.GetWalletName()
 	if err != nil {
 		fmt.Println("获取钱包时候失败：", err)
-		return
+		return false
 	}
 
 	checkAndPrintConfig()
-	BuildMintTxs()
+	return true
+}
+
+func getblockcount() (uint64, error) {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "getblockcount",
+		"method":  "getblockcount",
+		"params":  []interface{}{},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := http.Post(config.GetLocalRpcUrl(), "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result uint64      `json:"result"`
+		Error  interface{} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	if result.Error != nil {
+		return 0, fmt.Errorf("RPC error: %v", result.Error)
+	}
+	return result.Result, nil
 }
 
 func getrawtransaction(txhash string) (map[string]interface{}, error) {
@@ -178,14 +225,20 @@ func returnReplaceTxUtxos(txhash string) ([]*Utxo, error) {
 	return inputUtxos, nil
 }
 
-func getUtxos(address string) ([]*Utxo, error) {
+func getUtxos(addresses ...string) ([]*Utxo, error) {
+	return listUnspent(minUtxoValue, addresses...)
+}
+
+// listUnspent returns the outputs of addresses in the wallet worth more than
+// minValue.
+func listUnspent(minValue int64, addresses ...string) ([]*Utxo, error) {
 	localrpc := config.GetLocalRpcUrl()
 	url := fmt.Sprintf(localrpc+"/wallet/%s", walletName)
 	reqBody, err := json.Marshal(map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      "getUtxos",
 		"method":  "listunspent",
-		"params":  []interface{}{0, 9999999, []string{address}},
+		"params":  []interface{}{0, 9999999, addresses},
 	})
 	if err != nil {
 		return nil, err
@@ -295,7 +348,7 @@ func getUtxos(address string) ([]*Utxo, error) {
 
 		processedAmount := floatToSatoshis(amount)
 
-		if processedAmount > 10001 {
+		if processedAmount > minValue {
 			// p.Println("input Txid: ", h, "; vout:", vout, "; amount: ", amount, ";  处理后的金额:  ", processedAmount)
 
 			newUtxo := &Utxo{
@@ -372,49 +425,6 @@ func sendRawTransaction(txHex string) (string, error) {
 	return txID, nil
 }
 
-func fetchAvgFee() (int64, error) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	currentTime := time.Now()
-
-	if currentTime.Sub(lastRequestTime) >= 90*time.Second {
-		url := "https://mempool.fractalbitcoin.io/api/v1/mining/blocks/fee-rates/100m"
-		resp, err := http.Get(url)
-		if err != nil {
-			return 0, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return 0, fmt.Errorf("failed to fetch data: %s", resp.Status)
-		}
-
-		var data []FeeData
-		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-			return 0, err
-		}
-
-		// 获取最后一个元素
-		if len(data) > 0 {
-			lastItem := data[len(data)-1]
-
-			// 更新共享变量
-			if lastItem.AvgFee10 != 0 {
-				lastRequestTime = currentTime
-				sharedAvgFee10 = lastItem.AvgFee10
-				return sharedAvgFee10, nil
-			}
-		}
-		return 0, nil
-	} else {
-		if sharedAvgFee10 != 0 {
-			return sharedAvgFee10, nil
-		}
-		return 0, nil
-	}
-}
-
 func loadConfig() {
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
@@ -430,14 +440,18 @@ func loadConfig() {
 }
 func checkAndPrintConfig() {
 	//check privatekey and print address
-	_, addr, err := config.GetPrivateKeyAddr()
+	addresses, err := config.GetMintAddresses()
 	if err != nil {
 		p.Println("Private key error:", err.Error())
 		return
 	}
 
-	p.Println("你的钱包: ", walletName)
-	p.Println("你的地址 : ", addr)
+	if walletName != "" {
+		p.Println("你的钱包: ", walletName)
+	}
+	for _, address := range addresses {
+		p.Println("你的地址 : ", address)
+	}
 }
 
 func SendTx(ctx []byte) (string, error) {
@@ -458,141 +472,3 @@ func SendTx(ctx []byte) (string, error) {
 
 	return ctxHash, nil
 }
-
-func BuildMintTxs() {
-	runeId, mintNum, err := config.GetMint()
-	unconfirmednum := config.GetUnconfirmeds()
-
-	if err != nil {
-		p.Println(err.Error())
-		return
-
-	}
-	r := runestone.Runestone{Mint: runeId}
-	runeData, err := r.Encipher()
-	if err != nil {
-		p.Println(err)
-	}
-	p.Printf("Mint Rune[%s] data: 0x%x\n", config.Mint.RuneId, runeData)
-	//dataString, _ := txscript.DisasmString(data)
-	//p.Printf("Mint Script: %s\n", dataString)
-
-	init_gas_fee := config.GetFeePerByte()
-	speed_gas_fee := config.GetSpeedFee()
-	prvKey, address, _ := config.GetPrivateKeyAddr()
-
-	IsAutoSpeed := config.GetIsAutoSpeed() //是否开启自动加速
-	count := int64(0)                      //记录mint了多少张
-	speedStatus := int64(0)                //记录mint了多少张
-
-	for {
-		if count >= mintNum {
-			p.Println("MINT完成, 共: ", count, "张")
-			return
-		}
-
-		gas_fee := int64(0)
-
-		if init_gas_fee == 0 {
-			gas_fee, err = fetchAvgFee()
-			if err != nil {
-				p.Println("获取gas失败")
-				return
-			}
-		} else {
-			gas_fee = init_gas_fee
-		}
-
-		utxos, err := getUtxos(address)
-
-		if len(utxos) == 0 {
-			p.Println("utxos: 没有可用余额")
-			return
-		}
-
-		if err != nil {
-			p.Println("getUtxos error:", err.Error())
-			return
-		}
-
-		for _, utxo := range utxos {
-			var inputUtxos []*Utxo
-			tx := []byte{}
-			if utxo.Ancestorcount >= unconfirmednum && IsAutoSpeed == 1 { //需要加速快速过快
-				time.Sleep(3 * time.Second)
-				p.Println("检测是否需要加速......")
-
-				//计算最近这笔交易
-				currentTransaction, err := gettransaction(utxo.TxHash.String())
-				if err != nil {
-					p.Println(err)
-					break
-				}
-				if confirmations, ok := currentTransaction["confirmations"].(float64); ok {
-					if confirmations != 0 {
-						p.Println("交易已确认")
-						break
-					}
-				}
-				lastTransactionTtotalFee := int64(math.Abs(currentTransaction["fee"].(float64) * 1e8))
-				inputUtxos, err = returnReplaceTxUtxos(utxo.TxHash.String())
-				if err != nil {
-					p.Println("获取替换utxo报错: ", err)
-					break
-				}
-
-				//获取当前区块gas
-				var linshi_gas_fee = int64(0)
-				if speed_gas_fee > 0 {
-					linshi_gas_fee = speed_gas_fee
-				} else {
-					linshi_gas_fee, err = fetchAvgFee()
-					if err != nil {
-						p.Println("获取gas报错", err)
-						break
-					}
-				}
-
-				perfee := utxo.Ancestorfees / utxo.Ancestorsize
-				if perfee >= linshi_gas_fee { //判断当前给的gas大于当前区块gas，则退出
-					break
-				}
-
-				lastfee := int64(math.Ceil(float64(lastTransactionTtotalFee) / (float64(utxo.Ancestorsize) / float64(utxo.Ancestorcount))))
-				speed_gas_fee := utxo.Ancestorcount*(linshi_gas_fee-perfee) + lastfee
-
-				speedStatus = 1
-				p.Println("被卡交易笔数: ", utxo.Ancestorcount, ";  要被替换的交易的gas: ", lastfee, ";  当前平均每笔交易gas为: ", perfee, ";  为了加速到 ", linshi_gas_fee, ";  加速这笔交易给的gas: ", speed_gas_fee)
-				tx, err = BuildTransferBTCTx(prvKey, inputUtxos, address, config.GetUtxoAmount(), speed_gas_fee, config.GetNetwork(), runeData, false)
-				if err != nil {
-					p.Println("广播错误:", err.Error())
-					break
-				}
-
-			} else {
-				inputUtxos = append(inputUtxos, utxo)
-				tx, err = BuildTransferBTCTx(prvKey, inputUtxos, address, config.GetUtxoAmount(), gas_fee, config.GetNetwork(), runeData, false)
-				if err != nil {
-					p.Println("广播错误:", err.Error())
-					break
-				}
-			}
-
-			txid, err := SendTx(tx)
-			if err != nil {
-				p.Println("广播失败: ", err.Error())
-				break
-			} else {
-				if speedStatus == 0 {
-					count++
-				} else {
-					speedStatus = 0
-				}
-
-				p.Println("第", count, "张， txhash是: ", txid, "  ,gas费是:", gas_fee)
-			}
-		}
-
-		time.Sleep(1 * time.Second)
-	}
-}
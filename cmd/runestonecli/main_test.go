@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+func TestMain(m *testing.M) {
+	// the commands print their progress through p
+	p = message.NewPrinter(language.English)
+	os.Exit(m.Run())
+}
@@ -150,6 +150,8 @@ func (m MempoolConnector) SendRawTransaction(tx *wire.MsgTx, allowHighFees bool)
 	return txHash, nil
 }
 
+// GetUtxos returns the unspent outputs of address. Confirmations is set for
+// confirmed outputs; the ancestors of unconfirmed ones are left to the caller.
 func (m MempoolConnector) GetUtxos(address string) ([]*Utxo, error) {
 	res, err := m.request(http.MethodGet, fmt.Sprintf("/address/%s/utxo", address), nil)
 	if err != nil {
@@ -166,18 +168,26 @@ func (m MempoolConnector) GetUtxos(address string) ([]*Utxo, error) {
 		return nil, err
 	}
 	pkScript, _ := txscript.PayToAddrScript(addr)
+	var tip uint64
 	utxos := make([]*Utxo, len(mutxos))
 	for i, mutxo := range mutxos {
-		txHash, err := chainhash.NewHashFromStr(mutxo.Txid)
-		if err != nil {
+		if _, err := chainhash.NewHashFromStr(mutxo.Txid); err != nil {
 			return nil, err
 		}
 		utxos[i] = &Utxo{
-			TxHash:   BytesToHash(txHash.CloneBytes()),
+			TxHash:   HexToHash(mutxo.Txid),
 			Index:    uint32(mutxo.Vout),
 			Value:    mutxo.Value,
 			PkScript: pkScript,
 		}
+		if mutxo.Status.Confirmed {
+			if tip == 0 {
+				if tip, err = m.GetBlockHeight(); err != nil {
+					return nil, err
+				}
+			}
+			utxos[i].Confirmations = int64(tip) - int64(mutxo.Status.BlockHeight) + 1
+		}
 	}
 	log.Printf("found %d unspent outputs for address %s", len(utxos), address)
 	return utxos, nil
@@ -194,10 +204,34 @@ type txResponse struct {
 	Version  int      `json:"version"`
 	Locktime int      `json:"locktime"`
 	Size     int      `json:"size"`
+	Weight   int      `json:"weight"`
 	Fee      int      `json:"fee"`
+	Vin      []txVin  `json:"vin"`
 	Status   txStatus `json:"status"`
 }
 
+type txVin struct {
+	Txid    string `json:"txid"`
+	Vout    uint32 `json:"vout"`
+	Prevout *struct {
+		ScriptPubKey string `json:"scriptpubkey"`
+		Value        int64  `json:"value"`
+	} `json:"prevout"`
+}
+
+// GetTx returns /tx/:txid, with the spent outputs and the fee.
+func (m MempoolConnector) GetTx(hash string) (*txResponse, error) {
+	res, err := m.request(http.MethodGet, fmt.Sprintf("/tx/%s", hash), nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp txResponse
+	if err := json.Unmarshal(res, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 func (m MempoolConnector) GetTxByHash(hash string) (*BtcTxInfo, error) {
 	res, err := m.request(http.MethodGet, fmt.Sprintf("/tx/%s", hash), nil)
 	if err != nil {
@@ -272,10 +306,40 @@ func (m MempoolConnector) request(method, subPath string, requestBody io.Reader)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read response body")
 	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s %s", method, subPath, resp.Status, strings.TrimSpace(string(body)))
+	}
 
 	return body, nil
 }
 
+// GetRecommendedFees returns /v1/fees/recommended keyed by level, e.g. fastestFee.
+func (m MempoolConnector) GetRecommendedFees() (map[string]json.Number, error) {
+	res, err := m.request(http.MethodGet, "/v1/fees/recommended", nil)
+	if err != nil {
+		return nil, err
+	}
+	var fees map[string]json.Number
+	if err := json.Unmarshal(res, &fees); err != nil {
+		return nil, err
+	}
+	return fees, nil
+}
+
+// GetBlockFeeRates returns the fee rate percentiles of recent blocks, oldest
+// first, keyed like avgFee_90.
+func (m MempoolConnector) GetBlockFeeRates(period string) ([]map[string]json.Number, error) {
+	res, err := m.request(http.MethodGet, "/v1/mining/blocks/fee-rates/"+period, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rates []map[string]json.Number
+	if err := json.Unmarshal(res, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
 func (m MempoolConnector) GetBalance(address string) (uint64, error) {
 	res, err := m.request(http.MethodGet, fmt.Sprintf("/address/%s", address), nil)
 	if err != nil {
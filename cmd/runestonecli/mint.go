@@ -0,0 +1,758 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"lukechampine.com/uint128"
+)
+
+// mintBudget is the global MintNum shared by all workers. A worker reserves a
+// slot before broadcasting and either commits it or releases it on failure, so
+// the workers together never mint more than the configured total.
+type mintBudget struct {
+	mu       sync.Mutex
+	total    int64
+	reserved int64
+	minted   int64
+}
+
+func (b *mintBudget) reserve() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.minted+b.reserved >= b.total {
+		return false
+	}
+	b.reserved++
+	return true
+}
+
+func (b *mintBudget) commit() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reserved--
+	b.minted++
+	return b.minted
+}
+
+func (b *mintBudget) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reserved--
+}
+
+func (b *mintBudget) done() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.minted >= b.total
+}
+
+func (b *mintBudget) count() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.minted
+}
+
+// mintStats is the progress of a single worker.
+type mintStats struct {
+	minted   atomic.Int64
+	speedups atomic.Int64
+	failures atomic.Int64
+	depth    atomic.Int64 //当前最长的未确认链深度
+}
+
+type mintWorker struct {
+	id        int
+	wallet    *MintWallet
+	runeData  []byte
+	budget    *mintBudget
+	source    UtxoSource
+	assets    *assetFilter // nil不检查utxo上的铭文和符文
+	fees      FeeEstimator // 所有worker共享
+	speedFees FeeEstimator // 加速时使用
+	stats     mintStats
+}
+
+// mempoolChainLimit is the default ancestor limit of bitcoind's mempool.
+const mempoolChainLimit = 25
+
+type mintOptions struct {
+	atHeight   uint64        // 首批交易要进入的区块高度, 0表示立即开始
+	waitOpen   bool          // 从符文条款中取开放mint的高度
+	notifier   BlockNotifier // 新区块通知
+	blockCount func() (uint64, error)
+	psbtDir    string // 只导出PSBT, 不签名不广播
+	outDir     string // dry run: 签名后写入文件, 不广播
+}
+
+func (o mintOptions) scheduled() bool {
+	return o.atHeight > 0 || o.waitOpen
+}
+
+func runMint(args []string) {
+	fs := flag.NewFlagSet("mint", flag.ExitOnError)
+	atHeight := fs.Uint64("at-height", 0, "pre-sign the first batch and broadcast it so that it can be mined in this block")
+	waitOpen := fs.Bool("wait-open", false, "like --at-height, with the height the rune's mint terms open taken from RuneSource")
+	notify := fs.String("notify", config.BlockNotify, "new block source for --at-height/--wait-open: poll, zmq or stdin (one line per block)")
+	interval := fs.Duration("poll-interval", 2*time.Second, "interval of the poll block source")
+	psbtDir := fs.String("psbt", "", "write one pre-built batch per wallet as unsigned PSBTs to this directory and exit; sign them offline and send them with finalize --broadcast")
+	dryRun := fs.Bool("dry-run", false, "write one signed batch per wallet with JSON summaries to --out instead of broadcasting, and exit")
+	outDir := fs.String("out", "", "directory of --dry-run, default dryrun; setting it implies --dry-run")
+	fs.IntVar(&passphraseFd, "passphrase-fd", -1, "read the keystore passphrase from this file descriptor")
+	fs.Parse(args)
+	if *dryRun && *outDir == "" {
+		*outDir = "dryrun"
+	}
+
+	notifier, err := newBlockNotifier(*notify, config.ZmqBlockUrl, *interval)
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	source, err := config.GetUtxoSource()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	if config.usesNodeWallet() {
+		if !loadWallet() {
+			return
+		}
+	} else {
+		checkAndPrintConfig()
+	}
+	BuildMintTxs(source, mintOptions{
+		atHeight:   *atHeight,
+		waitOpen:   *waitOpen,
+		notifier:   notifier,
+		blockCount: source.GetBlockHeight,
+		psbtDir:    *psbtDir,
+		outDir:     *outDir,
+	})
+}
+
+// BuildMintTxs 为每个配置的钱包启动一个mint worker, 共享gas获取和MintNum总数,
+// 收到SIGINT/SIGTERM后等待正在广播的交易完成再退出
+func BuildMintTxs(source UtxoSource, opts mintOptions) {
+	runeId, mintNum, err := config.GetMint()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	getWallets := config.GetMintWallets
+	if opts.psbtDir != "" {
+		getWallets = config.GetWatchWallets
+	}
+	wallets, err := getWallets()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	// runes of the inputs, e.g. of the earlier mints of a chain, go to the
+	// first output that is not the OP_RETURN, the mint output, without a
+	// pointer
+	r := runestone.Runestone{Mint: runeId}
+	runeData, err := r.Encipher()
+	if err != nil {
+		p.Println(err)
+		return
+	}
+	p.Printf("Mint Rune[%s] data: 0x%x\n", config.Mint.RuneId, runeData)
+
+	runeSource, err := config.GetRuneSource()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	var guard *mintGuard
+	var assets *assetFilter
+	if runeSource == nil {
+		p.Printf("No RuneSource configured, mint cap and height window are not checked\n")
+		p.Printf("No RuneSource configured, inscriptions on utxos are not checked\n")
+	} else {
+		guard = &mintGuard{source: runeSource, runeId: *runeId}
+		if checker, ok := runeSource.(AssetChecker); ok {
+			assets = newAssetFilter(checker, true)
+		}
+	}
+
+	openHeight := opts.atHeight
+	if opts.waitOpen {
+		if guard == nil {
+			p.Println("--wait-open requires RuneSource")
+			return
+		}
+		openHeight, err = guard.openHeight()
+		if err != nil {
+			p.Println("RuneSource error:", err.Error())
+			return
+		}
+	}
+	if guard != nil {
+		var open bool
+		if opts.scheduled() {
+			open, err = guard.checkAt(openHeight, mintNum)
+		} else {
+			open, err = guard.check(mintNum)
+		}
+		if err != nil {
+			p.Println("RuneSource error:", err.Error())
+			return
+		}
+		if !open {
+			return
+		}
+	}
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(signalCtx)
+	defer cancel()
+
+	fees, err := config.GetFeeEstimator()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	speedFees, err := config.GetSpeedFeeEstimator(fees)
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+
+	budget := &mintBudget{total: mintNum}
+	workers := make([]*mintWorker, len(wallets))
+	for i, w := range wallets {
+		workers[i] = &mintWorker{id: i + 1, wallet: w, runeData: runeData, budget: budget, source: source, assets: assets, fees: fees, speedFees: speedFees}
+	}
+
+	if opts.psbtDir != "" || opts.outDir != "" {
+		dir := opts.outDir
+		if opts.psbtDir != "" {
+			dir = opts.psbtDir
+		}
+		if err := exportBatches(dir, workers, opts.psbtDir != ""); err != nil {
+			p.Println(err.Error())
+		}
+		return
+	}
+
+	if opts.scheduled() {
+		if !startScheduledMint(ctx, opts, openHeight, workers) {
+			printMintReport(budget, workers)
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func(worker *mintWorker) {
+			defer wg.Done()
+			worker.run(ctx)
+		}(workers[i])
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	guardTicker := time.NewTicker(mintGuardInterval)
+	defer guardTicker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			printMintProgress(budget, workers)
+		case <-guardTicker.C:
+			if guard == nil {
+				continue
+			}
+			open, err := guard.check(pendingMints(budget, workers))
+			if err != nil {
+				p.Println("RuneSource error:", err.Error())
+				continue
+			}
+			if !open {
+				cancel()
+			}
+		case <-signalCtx.Done():
+			p.Printf("Interrupted, waiting for mint workers to stop...\n")
+			<-finished
+			printMintReport(budget, workers)
+			return
+		case <-finished:
+			printMintReport(budget, workers)
+			return
+		}
+	}
+}
+
+// startScheduledMint pre-signs a first batch for every worker, waits until the
+// tip is one block below openHeight and broadcasts the batch, so that the mints
+// compete for the first block in which the rune can be minted.
+func startScheduledMint(ctx context.Context, opts mintOptions, openHeight uint64, workers []*mintWorker) bool {
+	gas_fee, err := workers[0].fees.EstimateFee()
+	if err != nil {
+		p.Println("获取gas失败:", err.Error())
+		return false
+	}
+
+	batches := make([][]*chainedTx, len(workers))
+	for i, w := range workers {
+		batch, err := w.presign(gas_fee)
+		if err != nil {
+			p.Println("worker", w.id, "pre-sign error:", err.Error())
+		}
+		batches[i] = batch
+		p.Printf("worker %d pre-signed %d mint transactions\n", w.id, len(batch))
+	}
+
+	target := openHeight
+	if target > 0 {
+		target--
+	}
+	p.Printf("Waiting for block %d to broadcast, mints can be mined from block %d\n", target, openHeight)
+	if _, err := waitForHeight(ctx, opts.notifier, opts.blockCount, target); err != nil {
+		for i := range workers {
+			for range batches[i] {
+				workers[i].budget.release()
+			}
+		}
+		p.Println("wait for block error:", err.Error())
+		return false
+	}
+
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		wg.Add(1)
+		go func(w *mintWorker, batch []*chainedTx) {
+			defer wg.Done()
+			w.broadcast(batch)
+		}(w, batches[i])
+	}
+	wg.Wait()
+	return true
+}
+
+// chainedTx is a transaction of a pre-built chain and the utxo it spends.
+type chainedTx struct {
+	data  []byte // signed transaction or PSBT
+	tx    *wire.MsgTx
+	spent *Utxo
+}
+
+// presign builds chains of mint transactions on top of each utxo, as deep as
+// the mempool ancestor limit and the budget allow. Every transaction returned
+// holds a reservation in the budget.
+func (w *mintWorker) presign(gas_fee int64) ([]*chainedTx, error) {
+	return w.chain(func(utxo *Utxo, receive, change string) ([]byte, *wire.MsgTx, error) {
+		tx, err := BuildTransferBTCTx(w.wallet.Keys, []*Utxo{utxo}, receive, config.GetUtxoAmount(), gas_fee, config.GetNetwork(), w.runeData, false, change)
+		if err != nil {
+			return nil, nil, err
+		}
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		if err := msgTx.Deserialize(bytes.NewReader(tx)); err != nil {
+			return nil, nil, err
+		}
+		if err := VerifyTx(msgTx, VerifyOptions{PrevOuts: UtxoList{utxo}, FeeRate: gas_fee, Runestone: w.runeData}); err != nil {
+			return nil, nil, err
+		}
+		return tx, msgTx, nil
+	})
+}
+
+// presignPsbts is presign for an offline signer: it returns unsigned PSBTs,
+// chained on the hashes of the unsigned transactions.
+func (w *mintWorker) presignPsbts(gas_fee int64) ([]*chainedTx, error) {
+	return w.chain(func(utxo *Utxo, receive, change string) ([]byte, *wire.MsgTx, error) {
+		return BuildTransferBTCPsbt(w.wallet.PubKeys, []*Utxo{utxo}, receive, config.GetUtxoAmount(), gas_fee, config.GetNetwork(), w.runeData, false, change, w.source.GetRawTx)
+	})
+}
+
+// chain calls build for every transaction of the chains built by presign. The
+// last output of a transaction funds the next one. A transaction that cannot
+// be built or fails verification ends its chain and counts as a failure; the
+// first such error is returned if no transaction was built at all.
+func (w *mintWorker) chain(build func(utxo *Utxo, receive, change string) ([]byte, *wire.MsgTx, error)) ([]*chainedTx, error) {
+	utxos, err := w.source.GetUtxos(w.wallet.Addresses()...)
+	if err != nil {
+		return nil, err
+	}
+	if utxos, err = w.assets.spendable(utxos); err != nil {
+		return nil, err
+	}
+	var batch []*chainedTx
+	var failed error
+	for _, utxo := range utxos {
+		next := utxo
+		for depth := utxo.Ancestorcount; depth < mempoolChainLimit; depth++ {
+			if !w.budget.reserve() {
+				return batch, nil
+			}
+			receive, change, err := w.outputs(len(batch) == 0)
+			if err != nil {
+				w.budget.release()
+				return batch, err
+			}
+			data, msgTx, err := build(next, receive, change)
+			if err != nil {
+				w.budget.release()
+				w.stats.failures.Add(1)
+				if isVerifyError(err) {
+					p.Println("worker", w.id, "交易验证失败:", err.Error())
+				} else {
+					p.Println("worker", w.id, "构建交易失败:", err.Error())
+				}
+				if failed == nil {
+					failed = err
+				}
+				break
+			}
+			batch = append(batch, &chainedTx{data: data, tx: msgTx, spent: next})
+			if classifyInput(next.PkScript) == inputP2PKH {
+				// the hash of an unsigned legacy spend is not final
+				break
+			}
+			last := uint32(len(msgTx.TxOut) - 1)
+			txHash := msgTx.TxHash()
+			next = &Utxo{
+				TxHash:   HexToHash(txHash.String()),
+				Index:    last,
+				Value:    msgTx.TxOut[last].Value,
+				PkScript: msgTx.TxOut[last].PkScript,
+			}
+		}
+	}
+	if len(batch) == 0 && failed != nil {
+		return nil, failed
+	}
+	return batch, nil
+}
+
+// exportBatches writes a pre-built batch of every worker to dir instead of
+// broadcasting it, as mint-<wallet>-<n>.psbt if psbt, else .hex, numbered in
+// broadcast order and each with a JSON summary.
+func exportBatches(dir string, workers []*mintWorker, psbt bool) error {
+	gas_fee, err := workers[0].fees.EstimateFee()
+	if err != nil {
+		return err
+	}
+	for _, w := range workers {
+		presign := w.presign
+		if psbt {
+			presign = w.presignPsbts
+		}
+		batch, err := presign(gas_fee)
+		if err != nil {
+			return fmt.Errorf("worker %d: %w", w.id, err)
+		}
+		for n, c := range batch {
+			name := fmt.Sprintf("mint-%s-%03d", w.wallet.Name, n)
+			if err := writeTxFiles(dir, name, c.data, psbt, c.tx, UtxoList{c.spent}); err != nil {
+				return err
+			}
+			w.budget.release()
+		}
+		if psbt {
+			p.Printf("worker %d exported %d mint PSBTs to %s\n", w.id, len(batch), dir)
+		} else {
+			p.Printf("worker %d wrote %d mint transactions to %s\n", w.id, len(batch), dir)
+		}
+	}
+	return nil
+}
+
+// outputs returns the mint output and change addresses of the next
+// transaction. HDRotate "tx" rotates them for every transaction, "batch" for
+// the first transaction of a batch.
+func (w *mintWorker) outputs(firstOfBatch bool) (string, string, error) {
+	return w.wallet.Outputs(config.HDRotate == "tx" || (firstOfBatch && config.HDRotate == "batch"))
+}
+
+// broadcast sends pre-signed transactions in order, settling their budget
+// reservations.
+func (w *mintWorker) broadcast(batch []*chainedTx) {
+	for _, tx := range batch {
+		txid, err := w.source.SendTx(tx.data)
+		if err != nil {
+			w.budget.release()
+			w.stats.failures.Add(1)
+			p.Println("worker", w.id, "广播失败: ", err.Error())
+			continue
+		}
+		w.keepChange(tx.data)
+		count := w.budget.commit()
+		w.stats.minted.Add(1)
+		p.Println("worker", w.id, "第", count, "张， txhash是: ", txid)
+	}
+}
+
+const mintGuardInterval = 30 * time.Second
+
+// mintGuard checks the rune's terms and global mint count so that no fee is
+// spent on mints that can no longer succeed.
+type mintGuard struct {
+	source RuneSource
+	runeId runestone.RuneId
+	warned uint128.Uint128
+}
+
+// check reports whether a mint broadcast now can still be included in the next
+// block. It warns when fewer mints remain under the cap than we have pending.
+func (g *mintGuard) check(pending int64) (bool, error) {
+	height, err := g.source.GetBlockHeight()
+	if err != nil {
+		return false, err
+	}
+	return g.checkAt(height+1, pending)
+}
+
+// checkAt is check for a mint included in the block at height.
+func (g *mintGuard) checkAt(height uint64, pending int64) (bool, error) {
+	entry, err := g.source.GetRuneEntry(g.runeId)
+	if err != nil {
+		return false, err
+	}
+	if _, err := entry.Mintable(height); err != nil {
+		p.Printf("Minting %s is closed at block %d: %s\n", entry.SpacedRune.String(), height, err)
+		return false, nil
+	}
+	if entry.Terms.Cap != nil {
+		remaining := entry.Remaining()
+		if remaining.Cmp64(uint64(pending)) < 0 && remaining != g.warned {
+			g.warned = remaining
+			p.Printf("Warning: only %s mints of %s remain, fewer than our %d pending mints\n", remaining, entry.SpacedRune.String(), pending)
+		}
+	}
+	return true, nil
+}
+
+// openHeight is the first block in which the rune can be minted, or the next
+// block if its terms have no start.
+func (g *mintGuard) openHeight() (uint64, error) {
+	entry, err := g.source.GetRuneEntry(g.runeId)
+	if err != nil {
+		return 0, err
+	}
+	if entry.Terms == nil {
+		return 0, fmt.Errorf("rune %s has no mint terms", entry.SpacedRune.String())
+	}
+	if start := entry.Start(); start != nil {
+		return *start, nil
+	}
+	height, err := g.source.GetBlockHeight()
+	if err != nil {
+		return 0, err
+	}
+	return height + 1, nil
+}
+
+// pendingMints is what is left of the budget plus the unconfirmed mints the
+// workers have in flight.
+func pendingMints(budget *mintBudget, workers []*mintWorker) int64 {
+	pending := budget.total - budget.count()
+	for _, w := range workers {
+		pending += w.stats.depth.Load()
+	}
+	return pending
+}
+
+func printMintProgress(budget *mintBudget, workers []*mintWorker) {
+	p.Printf("Mint progress: %d/%d\n", budget.count(), budget.total)
+	for _, w := range workers {
+		p.Printf("  worker %d [%s]: minted %d, speedups %d, failures %d, unconfirmed depth %d\n",
+			w.id, w.wallet.Address, w.stats.minted.Load(), w.stats.speedups.Load(), w.stats.failures.Load(), w.stats.depth.Load())
+	}
+}
+
+func printMintReport(budget *mintBudget, workers []*mintWorker) {
+	printMintProgress(budget, workers)
+	p.Println("MINT完成, 共: ", budget.count(), "张")
+}
+
+func (w *mintWorker) run(ctx context.Context) {
+	unconfirmednum := config.GetUnconfirmeds()
+	IsAutoSpeed := config.GetIsAutoSpeed() //是否开启自动加速
+	for {
+		if ctx.Err() != nil || w.budget.done() {
+			return
+		}
+
+		gas_fee, err := w.fees.EstimateFee()
+		if err != nil {
+			p.Println("worker", w.id, "获取gas失败:", err.Error())
+			return
+		}
+
+		utxos, err := w.source.GetUtxos(w.wallet.Addresses()...)
+		if err == nil {
+			utxos, err = w.assets.spendable(utxos)
+		}
+		if err != nil {
+			p.Println("worker", w.id, "getUtxos error:", err.Error())
+			return
+		}
+		if len(utxos) == 0 {
+			p.Println("worker", w.id, "utxos: 没有可用余额")
+			return
+		}
+		depth := int64(0)
+		for _, utxo := range utxos {
+			if utxo.Ancestorcount > depth {
+				depth = utxo.Ancestorcount
+			}
+		}
+		w.stats.depth.Store(depth)
+
+		first := true
+		for _, utxo := range utxos {
+			if ctx.Err() != nil {
+				return
+			}
+			if utxo.Ancestorcount >= unconfirmednum && IsAutoSpeed == 1 { //需要加速快速过快
+				if !w.speedUp(ctx, utxo) {
+					break
+				}
+				continue
+			}
+
+			if !w.budget.reserve() {
+				return
+			}
+			receive, change, err := w.outputs(first)
+			if err != nil {
+				w.budget.release()
+				p.Println("worker", w.id, "derive address error:", err.Error())
+				return
+			}
+			first = false
+			tx, err := BuildTransferBTCTx(w.wallet.Keys, []*Utxo{utxo}, receive, config.GetUtxoAmount(), gas_fee, config.GetNetwork(), w.runeData, false, change)
+			if err != nil {
+				w.budget.release()
+				w.stats.failures.Add(1)
+				p.Println("worker", w.id, "广播错误:", err.Error())
+				break
+			}
+			if err := VerifyRawTx(tx, VerifyOptions{PrevOuts: UtxoList{utxo}, FeeRate: gas_fee, Runestone: w.runeData}); err != nil {
+				w.budget.release()
+				w.stats.failures.Add(1)
+				p.Println("worker", w.id, "交易验证失败:", err.Error())
+				break
+			}
+			txid, err := w.source.SendTx(tx)
+			if err != nil {
+				w.budget.release()
+				w.stats.failures.Add(1)
+				p.Println("worker", w.id, "广播失败: ", err.Error())
+				break
+			}
+			w.keepChange(tx)
+			count := w.budget.commit()
+			w.stats.minted.Add(1)
+			p.Println("worker", w.id, "第", count, "张， txhash是: ", txid, "  ,gas费是:", gas_fee)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// speedUp 用更高的gas替换卡住的交易, 返回false表示本轮不再处理后续utxo
+func (w *mintWorker) speedUp(ctx context.Context, utxo *Utxo) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(3 * time.Second):
+	}
+	p.Println("worker", w.id, "检测是否需要加速......")
+
+	//计算最近这笔交易
+	lastTransactionTtotalFee, confirmed, err := w.source.GetTxFee(utxo.TxHash.String())
+	if err != nil {
+		p.Println(err)
+		return false
+	}
+	if confirmed {
+		p.Println("交易已确认")
+		return false
+	}
+	inputUtxos, err := w.source.GetTxInputs(utxo.TxHash.String())
+	if err != nil {
+		p.Println("获取替换utxo报错: ", err)
+		return false
+	}
+
+	//获取当前区块gas
+	linshi_gas_fee, err := w.speedFees.EstimateFee()
+	if err != nil {
+		p.Println("获取gas报错", err)
+		return false
+	}
+
+	perfee := utxo.Ancestorfees / utxo.Ancestorsize
+	if perfee >= linshi_gas_fee { //判断当前给的gas大于当前区块gas，则退出
+		return false
+	}
+
+	lastfee := int64(math.Ceil(float64(lastTransactionTtotalFee) / (float64(utxo.Ancestorsize) / float64(utxo.Ancestorcount))))
+	replace_gas_fee := utxo.Ancestorcount*(linshi_gas_fee-perfee) + lastfee
+
+	p.Println("worker", w.id, "被卡交易笔数: ", utxo.Ancestorcount, ";  要被替换的交易的gas: ", lastfee, ";  当前平均每笔交易gas为: ", perfee, ";  为了加速到 ", linshi_gas_fee, ";  加速这笔交易给的gas: ", replace_gas_fee)
+	receive, change, err := w.outputs(false)
+	if err != nil {
+		p.Println("worker", w.id, "derive address error:", err.Error())
+		return false
+	}
+	tx, err := BuildTransferBTCTx(w.wallet.Keys, inputUtxos, receive, config.GetUtxoAmount(), replace_gas_fee, config.GetNetwork(), w.runeData, false, change)
+	if err != nil {
+		w.stats.failures.Add(1)
+		p.Println("广播错误:", err.Error())
+		return false
+	}
+	if err := VerifyRawTx(tx, VerifyOptions{PrevOuts: UtxoList(inputUtxos), FeeRate: replace_gas_fee, Runestone: w.runeData}); err != nil {
+		w.stats.failures.Add(1)
+		p.Println("交易验证失败:", err.Error())
+		return false
+	}
+	txid, err := w.source.SendTx(tx)
+	if err != nil {
+		w.stats.failures.Add(1)
+		p.Println("广播失败: ", err.Error())
+		return false
+	}
+	w.keepChange(tx)
+	w.stats.speedups.Add(1)
+	p.Println("worker", w.id, "加速交易 txhash是: ", txid, "  ,gas费是:", replace_gas_fee)
+	return true
+}
+
+// keepChange lets the asset filter spend the change of a mint w sent, its
+// last output, before it confirms.
+func (w *mintWorker) keepChange(raw []byte) {
+	if w.assets == nil {
+		return
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return
+	}
+	w.assets.keep(wire.OutPoint{Hash: tx.TxHash(), Index: uint32(len(tx.TxOut) - 1)})
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"lukechampine.com/uint128"
+)
+
+// testUtxoSource sends transactions into a list, failing every fail-th send.
+type testUtxoSource struct {
+	mu    sync.Mutex
+	utxos []*Utxo
+	sent  [][]byte
+	sends int
+	fail  int
+	tip   uint64
+}
+
+func (s *testUtxoSource) GetUtxos(addresses ...string) ([]*Utxo, error) {
+	return s.utxos, nil
+}
+
+func (s *testUtxoSource) GetTxFee(txid string) (int64, bool, error) {
+	return 0, false, errors.New("not implemented")
+}
+
+func (s *testUtxoSource) GetTxInputs(txid string) ([]*Utxo, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *testUtxoSource) GetRawTx(hash chainhash.Hash) (*wire.MsgTx, error) {
+	return nil, fmt.Errorf("transaction %s not found", hash)
+}
+
+func (s *testUtxoSource) SendTx(tx []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sends++
+	if s.fail > 0 && s.sends%s.fail == 0 {
+		return "", errors.New("rejected")
+	}
+	s.sent = append(s.sent, tx)
+	return fmt.Sprintf("%064x", len(s.sent)), nil
+}
+
+func (s *testUtxoSource) GetBlockHeight() (uint64, error) {
+	return s.tip, nil
+}
+
+func TestMintBudget(t *testing.T) {
+	budget := &mintBudget{total: 2}
+	require.True(t, budget.reserve())
+	require.True(t, budget.reserve())
+	// both slots are reserved, though none is minted yet
+	assert.False(t, budget.reserve())
+	budget.release()
+	assert.Equal(t, int64(1), budget.commit())
+	assert.False(t, budget.done())
+	require.True(t, budget.reserve())
+	assert.Equal(t, int64(2), budget.commit())
+	assert.True(t, budget.done())
+	assert.False(t, budget.reserve())
+}
+
+// TestMintBudgetConcurrent is meant to be run with -race.
+func TestMintBudgetConcurrent(t *testing.T) {
+	budget := &mintBudget{total: 100}
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for n := 0; budget.reserve(); n++ {
+				// every third broadcast fails and gives its slot back
+				if (worker+n)%3 == 0 {
+					budget.release()
+				} else {
+					budget.commit()
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), budget.count())
+	assert.Zero(t, budget.reserved)
+	assert.True(t, budget.done())
+}
+
+func TestMintWorkersShareBudget(t *testing.T) {
+	budget := &mintBudget{total: 10}
+	source := &testUtxoSource{fail: 4}
+	workers := make([]*mintWorker, 3)
+	for i := range workers {
+		workers[i] = &mintWorker{id: i + 1, budget: budget, source: source}
+	}
+
+	// every worker has more pre-signed mints than the budget allows
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		var batch []*chainedTx
+		for len(batch) < 5 && budget.reserve() {
+			batch = append(batch, &chainedTx{data: []byte{byte(w.id)}})
+		}
+		wg.Add(1)
+		go func(w *mintWorker, batch []*chainedTx) {
+			defer wg.Done()
+			w.broadcast(batch)
+		}(w, batch)
+	}
+	wg.Wait()
+
+	var minted, failures int64
+	for _, w := range workers {
+		minted += w.stats.minted.Load()
+		failures += w.stats.failures.Load()
+	}
+	assert.Equal(t, budget.count(), minted)
+	assert.Len(t, source.sent, int(minted))
+	assert.Equal(t, int64(10), minted+failures)
+	assert.Zero(t, budget.reserved)
+	assert.Equal(t, 10-minted, pendingMints(budget, workers))
+}
+
+func TestMintWorkerStopsOnShutdown(t *testing.T) {
+	budget := &mintBudget{total: 10}
+	source := &testUtxoSource{utxos: []*Utxo{{Value: 100000}}}
+	w := &mintWorker{id: 1, budget: budget, source: source}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.run(ctx)
+	assert.Empty(t, source.sent)
+	assert.Zero(t, budget.reserved)
+	assert.Zero(t, budget.count())
+}
+
+// ordRune is the /rune response of an ord stand-in for a rune etched at block
+// 840000 with mints of its cap minted, mintable in blocks [840000, 840100).
+func ordRune(mints, cap int) string {
+	return fmt.Sprintf(`{"entry":{"block":840000,"burned":0,"divisibility":0,"etching":"2bb85f4b004be6da54f766c17c1e855187327112c231ef2ff35ebad0ea67c69e","mints":%d,"number":0,"premine":0,"spaced_rune":"UNCOMMON•GOODS","symbol":"⧉","terms":{"amount":1,"cap":%d,"height":[840000,840100],"offset":[null,null]},"timestamp":1713571767,"turbo":false},"id":"840000:1","mintable":true,"parent":null}`, mints, cap)
+}
+
+func TestMintGuard(t *testing.T) {
+	id := runestone.RuneId{Block: 840000, Tx: 1}
+	guard := &mintGuard{runeId: id, source: ordResponses(t, map[string]string{
+		"/rune/840000:1": ordRune(3, 5),
+		"/blockheight":   "840050",
+	})}
+	open, err := guard.check(1)
+	require.NoError(t, err)
+	assert.True(t, open)
+	assert.Equal(t, uint128.Zero, guard.warned)
+
+	// more pending mints than remain under the cap still mint, with a warning
+	open, err = guard.check(4)
+	require.NoError(t, err)
+	assert.True(t, open)
+	assert.Equal(t, uint128.From64(2), guard.warned)
+
+	// the mint window is [start, end)
+	for height, want := range map[uint64]bool{839999: false, 840000: true, 840099: true, 840100: false} {
+		open, err = guard.checkAt(height, 1)
+		require.NoError(t, err)
+		assert.Equal(t, want, open, "block %d", height)
+	}
+	start, err := guard.openHeight()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(840000), start)
+
+	guard.source = ordResponses(t, map[string]string{
+		"/rune/840000:1": ordRune(5, 5),
+		"/blockheight":   "840050",
+	})
+	open, err = guard.check(1)
+	require.NoError(t, err)
+	assert.False(t, open, "capped")
+
+	// ord has indexed the block before the end
+	guard.source = ordResponses(t, map[string]string{
+		"/rune/840000:1": ordRune(3, 5),
+		"/blockheight":   "840099",
+	})
+	open, err = guard.check(1)
+	require.NoError(t, err)
+	assert.False(t, open, "ended")
+
+	guard.source = ordResponses(t, map[string]string{})
+	_, err = guard.check(1)
+	assert.ErrorContains(t, err, "ord stand-in")
+}
+
+func TestMintGuardOpenHeight(t *testing.T) {
+	id := runestone.RuneId{Block: 840000, Tx: 1}
+	noStart := `{"entry":{"block":840000,"burned":0,"divisibility":0,"etching":"2bb85f4b004be6da54f766c17c1e855187327112c231ef2ff35ebad0ea67c69e","mints":0,"number":0,"premine":0,"spaced_rune":"UNCOMMON•GOODS","symbol":null,"terms":{"amount":1,"cap":5,"height":[null,null],"offset":[null,null]},"timestamp":1713571767,"turbo":false}}`
+	guard := &mintGuard{runeId: id, source: ordResponses(t, map[string]string{
+		"/rune/840000:1": noStart,
+		"/blockheight":   "840050",
+	})}
+	start, err := guard.openHeight()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(840051), start)
+
+	noTerms := `{"entry":{"block":840000,"burned":0,"divisibility":0,"etching":"2bb85f4b004be6da54f766c17c1e855187327112c231ef2ff35ebad0ea67c69e","mints":0,"number":0,"premine":21000000,"spaced_rune":"UNCOMMON•GOODS","symbol":null,"terms":null,"timestamp":1713571767,"turbo":false}}`
+	guard.source = ordResponses(t, map[string]string{"/rune/840000:1": noTerms})
+	_, err = guard.openHeight()
+	assert.ErrorContains(t, err, "has no mint terms")
+	open, err := guard.checkAt(840001, 1)
+	require.NoError(t, err)
+	assert.False(t, open)
+}
+
+func TestMintChainBuildErrors(t *testing.T) {
+	budget := &mintBudget{total: 2}
+	worker, source := scheduledMintWorker(t, budget)
+	// too little for the mint output and the fee
+	poor := &Utxo{TxHash: Hash{2}, Value: 300, PkScript: source.utxos[0].PkScript, Confirmations: 1}
+	source.utxos = append([]*Utxo{poor}, source.utxos...)
+
+	batch, err := worker.presign(2)
+	require.NoError(t, err)
+	assert.Len(t, batch, 2)
+	assert.Equal(t, int64(1), worker.stats.failures.Load())
+	assert.Equal(t, int64(2), budget.reserved)
+
+	// the error is returned when nothing could be built
+	budget = &mintBudget{total: 2}
+	worker.budget = budget
+	source.utxos = []*Utxo{poor}
+	batch, err = worker.presign(2)
+	assert.Error(t, err)
+	assert.Empty(t, batch)
+	assert.Equal(t, int64(2), worker.stats.failures.Load())
+	assert.Zero(t, budget.reserved)
+}
+
+func TestMintChainVerifyErrors(t *testing.T) {
+	budget := &mintBudget{total: 2}
+	worker, _ := scheduledMintWorker(t, budget)
+	// the edict sends to an output the mint does not have
+	data, err := (&runestone.Runestone{Edicts: []runestone.Edict{{ID: runestone.RuneId{Block: 840000, Tx: 1}, Output: 5}}}).Encipher()
+	require.NoError(t, err)
+	worker.runeData = data
+
+	batch, err := worker.presign(2)
+	var artifactErr *ArtifactError
+	require.ErrorAs(t, err, &artifactErr)
+	require.NotNil(t, artifactErr.Got.Cenotaph)
+	assert.Equal(t, runestone.EdictOutput, *artifactErr.Got.Cenotaph.Flaw)
+	assert.Empty(t, batch)
+	assert.Equal(t, int64(1), worker.stats.failures.Load())
+	assert.Zero(t, budget.reserved)
+}
+
+func TestMintKeepsOwnChange(t *testing.T) {
+	worker, _ := scheduledMintWorker(t, &mintBudget{total: 1})
+	worker.assets = newAssetFilter(&testAssetChecker{}, true)
+	batch, err := worker.presign(2)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	tx := batch[0].tx
+	last := uint32(len(tx.TxOut) - 1)
+	change := &Utxo{TxHash: HexToHash(tx.TxHash().String()), Index: last, Value: tx.TxOut[last].Value}
+	// the mint output of the same transaction is not ours to spend as fee
+	mint := &Utxo{TxHash: change.TxHash, Index: last - 1}
+
+	kept, err := worker.assets.spendable([]*Utxo{change, mint})
+	require.NoError(t, err)
+	assert.Empty(t, kept, "not sent yet")
+	worker.keepChange(batch[0].data)
+	kept, err = worker.assets.spendable([]*Utxo{change, mint})
+	require.NoError(t, err)
+	assert.Equal(t, []*Utxo{change}, kept)
+}
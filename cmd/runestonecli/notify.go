@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// BlockNotifier signals new blocks. Wait returns after the next notification,
+// or right away for the first call so that the caller can check the current tip.
+type BlockNotifier interface {
+	Wait(ctx context.Context) error
+}
+
+// waitForHeight blocks until the chain tip reported by height reaches target.
+func waitForHeight(ctx context.Context, notifier BlockNotifier, height func() (uint64, error), target uint64) (uint64, error) {
+	for {
+		if err := notifier.Wait(ctx); err != nil {
+			return 0, err
+		}
+		tip, err := height()
+		if err != nil {
+			return 0, err
+		}
+		if tip >= target {
+			return tip, nil
+		}
+		p.Printf("Current block %d, waiting for block %d...\n", tip, target)
+	}
+}
+
+// pollNotifier treats every tick as a possible new block.
+type pollNotifier struct {
+	interval time.Duration
+	started  bool
+}
+
+func (n *pollNotifier) Wait(ctx context.Context) error {
+	if !n.started {
+		n.started = true
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(n.interval):
+		return nil
+	}
+}
+
+// lineNotifier is a local stand-in for a block notification feed: every line
+// read from r, e.g. typed on stdin, counts as a new block.
+type lineNotifier struct {
+	lines   chan error
+	started bool
+}
+
+func newLineNotifier(r io.Reader) *lineNotifier {
+	n := &lineNotifier{lines: make(chan error)}
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			n.lines <- nil
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		n.lines <- err
+	}()
+	return n
+}
+
+func (n *lineNotifier) Wait(ctx context.Context) error {
+	if !n.started {
+		n.started = true
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-n.lines:
+		return err
+	}
+}
+
+// zmqNotifier subscribes to the hashblock topic of a node started with
+// -zmqpubhashblock. It speaks just enough ZMTP 3.0 (NULL mechanism, SUB
+// socket) to receive the notifications.
+type zmqNotifier struct {
+	endpoint string
+	conn     net.Conn
+	started  bool
+}
+
+const zmqTopicHashBlock = "hashblock"
+
+func (n *zmqNotifier) Wait(ctx context.Context) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if !n.started {
+		n.started = true
+		return nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		n.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	for {
+		parts, err := n.readMessage()
+		if err != nil {
+			n.conn.Close()
+			n.conn = nil
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if len(parts) > 0 && string(parts[0]) == zmqTopicHashBlock {
+			return nil
+		}
+	}
+}
+
+func (n *zmqNotifier) connect(ctx context.Context) error {
+	address := strings.TrimPrefix(n.endpoint, "tcp://")
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	if err := zmqHandshake(conn); err != nil {
+		conn.Close()
+		return fmt.Errorf("zmq handshake with %s: %w", n.endpoint, err)
+	}
+	// a SUB socket subscribes by sending a message starting with 0x01
+	if err := zmqWriteFrame(conn, 0, append([]byte{1}, zmqTopicHashBlock...)); err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn = conn
+	return nil
+}
+
+func zmqHandshake(conn net.Conn) error {
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3 // version 3.0
+	copy(greeting[12:32], "NULL")
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(conn, peer); err != nil {
+		return err
+	}
+	if peer[0] != 0xff || peer[9] != 0x7f || peer[10] < 3 {
+		return errors.New("peer is not a ZMTP 3 endpoint")
+	}
+
+	var ready []byte
+	ready = append(ready, 5)
+	ready = append(ready, "READY"...)
+	ready = append(ready, byte(len("Socket-Type")))
+	ready = append(ready, "Socket-Type"...)
+	ready = binary.BigEndian.AppendUint32(ready, 3)
+	ready = append(ready, "SUB"...)
+	if err := zmqWriteFrame(conn, zmqFlagCommand, ready); err != nil {
+		return err
+	}
+	flags, body, err := zmqReadFrame(conn)
+	if err != nil {
+		return err
+	}
+	if flags&zmqFlagCommand == 0 || len(body) < 6 || string(body[1:6]) != "READY" {
+		return errors.New("peer did not send READY")
+	}
+	return nil
+}
+
+const (
+	zmqFlagMore    = 0x01
+	zmqFlagLong    = 0x02
+	zmqFlagCommand = 0x04
+)
+
+func zmqWriteFrame(w io.Writer, flags byte, body []byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = binary.BigEndian.AppendUint64([]byte{flags | zmqFlagLong}, uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+	_, err := w.Write(append(header, body...))
+	return err
+}
+
+func zmqReadFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return 0, nil, err
+	}
+	flags := header[0]
+	size := uint64(header[1])
+	if flags&zmqFlagLong != 0 {
+		if _, err := io.ReadFull(r, header[2:9]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(header[1:9])
+	}
+	if size > 1<<20 {
+		return 0, nil, fmt.Errorf("zmq frame too large: %d", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+func (n *zmqNotifier) readMessage() ([][]byte, error) {
+	var parts [][]byte
+	for {
+		flags, body, err := zmqReadFrame(n.conn)
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmqFlagCommand != 0 {
+			continue
+		}
+		parts = append(parts, body)
+		if flags&zmqFlagMore == 0 {
+			return parts, nil
+		}
+	}
+}
+
+// newBlockNotifier builds the notifier selected by kind: "poll", "zmq" or
+// "stdin".
+func newBlockNotifier(kind, zmqEndpoint string, interval time.Duration) (BlockNotifier, error) {
+	switch kind {
+	case "", "poll":
+		return &pollNotifier{interval: interval}, nil
+	case "zmq":
+		if zmqEndpoint == "" {
+			return nil, errors.New("ZmqBlockUrl is required")
+		}
+		return &zmqNotifier{endpoint: zmqEndpoint}, nil
+	case "stdin":
+		return newLineNotifier(os.Stdin), nil
+	}
+	return nil, fmt.Errorf("unknown block notifier: %s", kind)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZmqFrames(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, zmqWriteFrame(&buf, zmqFlagMore, []byte("hashblock")))
+	assert.Equal(t, append([]byte{zmqFlagMore, 9}, "hashblock"...), buf.Bytes())
+
+	long := bytes.Repeat([]byte{7}, 300)
+	buf.Reset()
+	require.NoError(t, zmqWriteFrame(&buf, 0, long))
+	assert.Equal(t, []byte{zmqFlagLong, 0, 0, 0, 0, 0, 0, 1, 44}, buf.Bytes()[:9])
+	flags, body, err := zmqReadFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, byte(zmqFlagLong), flags)
+	assert.Equal(t, long, body)
+
+	_, _, err = zmqReadFrame(bytes.NewReader([]byte{zmqFlagLong, 0, 0, 0, 0, 1, 0, 0, 0}))
+	assert.ErrorContains(t, err, "too large")
+	_, _, err = zmqReadFrame(bytes.NewReader([]byte{0, 5, 1}))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+// zmqPublisher is the publishing side of a node's -zmqpubhashblock: it
+// answers the handshake, checks the subscription and sends messages.
+func zmqPublisher(t *testing.T, messages chan [][]byte) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		greeting := make([]byte, 64)
+		if _, err := io.ReadFull(conn, greeting); err != nil {
+			return
+		}
+		greeting[10], greeting[11] = 3, 1
+		conn.Write(greeting)
+		if flags, body, err := zmqReadFrame(conn); err != nil || flags&zmqFlagCommand == 0 || !bytes.Contains(body, []byte("SUB")) {
+			return
+		}
+		zmqWriteFrame(conn, zmqFlagCommand, append([]byte{5}, "READY\x0bSocket-Type\x00\x00\x00\x03PUB"...))
+		if _, body, err := zmqReadFrame(conn); err != nil || string(body) != "\x01hashblock" {
+			return
+		}
+		for parts := range messages {
+			for i, part := range parts {
+				flags := byte(0)
+				if i < len(parts)-1 {
+					flags = zmqFlagMore
+				}
+				zmqWriteFrame(conn, flags, part)
+			}
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func TestZmqNotifier(t *testing.T) {
+	messages := make(chan [][]byte, 4)
+	n := &zmqNotifier{endpoint: zmqPublisher(t, messages)}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the first call only connects
+	require.NoError(t, n.Wait(ctx))
+	messages <- [][]byte{[]byte("rawtx"), {1}, {0, 0, 0, 0}}
+	messages <- [][]byte{[]byte(zmqTopicHashBlock), bytes.Repeat([]byte{2}, 32), {1, 0, 0, 0}}
+	require.NoError(t, n.Wait(ctx))
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer waitCancel()
+	assert.ErrorIs(t, n.Wait(waitCtx), context.DeadlineExceeded)
+	assert.Nil(t, n.conn)
+}
+
+func TestZmqNotifierNotZmtp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write(append([]byte("HTTP/1.1 400 Bad Request\r\n"), make([]byte, 64)...))
+	}()
+	n := &zmqNotifier{endpoint: listener.Addr().String()}
+	assert.ErrorContains(t, n.Wait(context.Background()), "not a ZMTP 3 endpoint")
+}
+
+// testTips returns the next of tips on every call, then the last one.
+func testTips(tips ...uint64) func() (uint64, error) {
+	var n atomic.Int64
+	return func() (uint64, error) {
+		i := int(n.Add(1)) - 1
+		if i >= len(tips) {
+			i = len(tips) - 1
+		}
+		return tips[i], nil
+	}
+}
+
+func TestWaitForHeight(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	height := testTips(98, 99, 101)
+
+	done := make(chan uint64)
+	go func() {
+		reached, err := waitForHeight(context.Background(), newLineNotifier(r), height, 100)
+		assert.NoError(t, err)
+		done <- reached
+	}()
+	w.Write([]byte("\n"))
+	w.Write([]byte("\n"))
+	assert.Equal(t, uint64(101), <-done)
+
+	// the notifier ending stops the wait
+	r, w = io.Pipe()
+	w.Close()
+	_, err := waitForHeight(context.Background(), newLineNotifier(r), height, 200)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// scheduledMintWorker is a worker with a single P2TR utxo of 100000 sat.
+func scheduledMintWorker(t *testing.T, budget *mintBudget) (*mintWorker, *testUtxoSource) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config.Network = "regtest"
+
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), config.GetNetwork())
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	runeData, err := (&runestone.Runestone{Mint: &runestone.RuneId{Block: 840000, Tx: 1}}).Encipher()
+	require.NoError(t, err)
+
+	source := &testUtxoSource{utxos: []*Utxo{{TxHash: Hash{1}, Value: 100000, PkScript: pkScript, Confirmations: 1}}}
+	wallet := &MintWallet{Name: "test", Keys: singleKey{key}, Address: address.EncodeAddress(), watch: []string{address.EncodeAddress()}}
+	return &mintWorker{id: 1, wallet: wallet, runeData: runeData, budget: budget, source: source, fees: staticFee(2)}, source
+}
+
+func TestScheduledMint(t *testing.T) {
+	budget := &mintBudget{total: 3}
+	worker, source := scheduledMintWorker(t, budget)
+	r, w := io.Pipe()
+	defer w.Close()
+	opts := mintOptions{atHeight: 100, notifier: newLineNotifier(r), blockCount: testTips(97, 98, 99)}
+
+	started := make(chan bool)
+	go func() {
+		started <- startScheduledMint(context.Background(), opts, opts.atHeight, []*mintWorker{worker})
+	}()
+	w.Write([]byte("\n"))
+	// the batch is pre-signed and held back until the block before
+	source.mu.Lock()
+	assert.Empty(t, source.sent)
+	source.mu.Unlock()
+	w.Write([]byte("\n"))
+	require.True(t, <-started)
+
+	// the budget stops the chain of mints
+	require.Len(t, source.sent, 3)
+	assert.Equal(t, int64(3), budget.count())
+	assert.Zero(t, budget.reserved)
+	var prev *wire.MsgTx
+	for _, raw := range source.sent {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		require.NoError(t, tx.Deserialize(bytes.NewReader(raw)))
+		if prev != nil {
+			assert.Equal(t, prev.TxHash(), tx.TxIn[0].PreviousOutPoint.Hash)
+			assert.Equal(t, uint32(len(prev.TxOut)-1), tx.TxIn[0].PreviousOutPoint.Index)
+		}
+		prev = tx
+	}
+}
+
+func TestScheduledMintShutdown(t *testing.T) {
+	budget := &mintBudget{total: 3}
+	worker, source := scheduledMintWorker(t, budget)
+	r, w := io.Pipe()
+	defer w.Close()
+	opts := mintOptions{atHeight: 100, notifier: newLineNotifier(r), blockCount: testTips(50)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan bool)
+	go func() {
+		started <- startScheduledMint(ctx, opts, opts.atHeight, []*mintWorker{worker})
+	}()
+	w.Write([]byte("\n"))
+	cancel()
+	assert.False(t, <-started)
+	// the reservations of the pre-signed batch are given back
+	assert.Empty(t, source.sent)
+	assert.Zero(t, budget.reserved)
+	assert.Zero(t, budget.count())
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/bxelab/runestone"
+	"github.com/pkg/errors"
+	"lukechampine.com/uint128"
+)
+
+// OrdConnector talks to the JSON API of an ord server. A base url of the form
+// file://<dir> turns it into a local stand-in that serves every request path
+// from <dir>/<path>, e.g. file://./ord/rune/840000:1 for /rune/840000:1, so the
+// same responses can be saved once and replayed without a running ord.
+type OrdConnector struct {
+	baseUrl string
+}
+
+func NewOrdConnector(config Config) *OrdConnector {
+	return &OrdConnector{baseUrl: strings.TrimSuffix(config.OrdUrl, "/")}
+}
+
+type ordTerms struct {
+	Amount *json.Number    `json:"amount"`
+	Cap    *json.Number    `json:"cap"`
+	Height [2]*json.Number `json:"height"`
+	Offset [2]*json.Number `json:"offset"`
+}
+
+type ordRuneEntry struct {
+	Block        uint64      `json:"block"`
+	Burned       json.Number `json:"burned"`
+	Divisibility uint8       `json:"divisibility"`
+	Etching      string      `json:"etching"`
+	Mints        json.Number `json:"mints"`
+	Number       uint64      `json:"number"`
+	Premine      json.Number `json:"premine"`
+	SpacedRune   string      `json:"spaced_rune"`
+	Symbol       *string     `json:"symbol"`
+	Terms        *ordTerms   `json:"terms"`
+	Timestamp    uint64      `json:"timestamp"`
+	Turbo        bool        `json:"turbo"`
+}
+
+// GetRuneEntry returns the entry of /rune/<id>.
+func (o OrdConnector) GetRuneEntry(id runestone.RuneId) (*runestone.RuneEntry, error) {
+	res, err := o.request("/rune/" + id.String())
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Entry *ordRuneEntry `json:"entry"`
+	}
+	if err := json.Unmarshal(res, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to decode ord rune")
+	}
+	if resp.Entry == nil {
+		return nil, fmt.Errorf("rune %s not found", id)
+	}
+	return resp.Entry.toRuneEntry()
+}
+
+// GetBlockHeight returns the height of the latest block indexed by ord.
+func (o OrdConnector) GetBlockHeight() (uint64, error) {
+	res, err := o.request("/blockheight")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(res)), 10, 64)
+}
+
+func (o OrdConnector) request(subPath string) ([]byte, error) {
+	if dir, ok := strings.CutPrefix(o.baseUrl, "file://"); ok {
+		body, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(subPath)))
+		if err != nil {
+			return nil, errors.Wrap(err, "ord stand-in")
+		}
+		return body, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, o.baseUrl+subPath, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Add("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ord %s: %s %s", subPath, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func (e *ordRuneEntry) toRuneEntry() (*runestone.RuneEntry, error) {
+	spacedRune, err := runestone.SpacedRuneFromString(e.SpacedRune)
+	if err != nil {
+		return nil, err
+	}
+	etching, err := chainhash.NewHashFromStr(e.Etching)
+	if err != nil {
+		return nil, err
+	}
+	entry := &runestone.RuneEntry{
+		Block:        e.Block,
+		Divisibility: e.Divisibility,
+		Etching:      *etching,
+		Number:       e.Number,
+		SpacedRune:   *spacedRune,
+		Timestamp:    e.Timestamp,
+		Turbo:        e.Turbo,
+	}
+	for _, f := range []struct {
+		n *json.Number
+		v *uint128.Uint128
+	}{{&e.Burned, &entry.Burned}, {&e.Mints, &entry.Mints}, {&e.Premine, &entry.Premine}} {
+		if *f.v, err = parseUint128(f.n); err != nil {
+			return nil, err
+		}
+	}
+	if e.Symbol != nil {
+		if r := []rune(*e.Symbol); len(r) > 0 {
+			entry.Symbol = &r[0]
+		}
+	}
+	if e.Terms != nil {
+		terms := &runestone.Terms{}
+		if terms.Amount, err = parseUint128P(e.Terms.Amount); err != nil {
+			return nil, err
+		}
+		if terms.Cap, err = parseUint128P(e.Terms.Cap); err != nil {
+			return nil, err
+		}
+		for i := 0; i < 2; i++ {
+			if terms.Height[i], err = parseUint64P(e.Terms.Height[i]); err != nil {
+				return nil, err
+			}
+			if terms.Offset[i], err = parseUint64P(e.Terms.Offset[i]); err != nil {
+				return nil, err
+			}
+		}
+		entry.Terms = terms
+	}
+	return entry, nil
+}
+
+func parseUint128(n *json.Number) (uint128.Uint128, error) {
+	if n == nil || *n == "" {
+		return uint128.Zero, nil
+	}
+	return uint128.FromString(n.String())
+}
+
+func parseUint128P(n *json.Number) (*uint128.Uint128, error) {
+	if n == nil {
+		return nil, nil
+	}
+	v, err := parseUint128(n)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func parseUint64P(n *json.Number) (*uint64, error) {
+	if n == nil {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(n.String(), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -2,10 +2,9 @@ package main
 
 import (
 	"bytes"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"sort"
+	"math"
  
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/btcec/v2"
@@ -15,6 +14,7 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
 )
 
 const (
@@ -24,97 +24,115 @@ const (
 	MaxStandardTxWeight = blockchain.MaxBlockWeight / 10
 )
 
-func BuildInscriptionTxs(privateKey *btcec.PrivateKey, utxo []*Utxo, mime string, content []byte, feeRate int64, revealValue int64, net *chaincfg.Params, inscriptionAddData []byte, opReturnData []byte) ([]byte, []byte, error) {
+func buildInscriptionRevealTxs(pubKey *btcec.PublicKey, utxo []*Utxo, ins *Inscription, feeRate int64, revealValue int64, net *chaincfg.Params, opReturnData []byte, recovery []byte) (*revealTxs, error) {
 	//build 2 tx, 1 transfer BTC to taproot address, 2 inscription transfer taproot address to another address
-	pubKey := privateKey.PubKey()
 	receiver, err := getP2TRAddress(pubKey, net)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	// 1. build inscription script
-	inscriptionScript, err := CreateInscriptionScript(pubKey, mime, content, inscriptionAddData)
-	if err != nil {
-		return nil, nil, err
-	}
-	inscriptionAddress, err := GetTapScriptAddress(pubKey, inscriptionScript, net)
-	if err != nil {
-		return nil, nil, err
-	}
-	inscriptionPkScript, _ := txscript.PayToAddrScript(inscriptionAddress)
-	// 2. build reveal tx
-	revealTx, totalPrevOutput, err := buildEmptyRevealTx(receiver, inscriptionScript, revealValue, feeRate, opReturnData)
+	return buildRevealTxs(pubKey, utxo, ins.Script(pubKey), receiver, revealValue, feeRate, net, opReturnData, recovery)
+}
+
+// buildRuneEtchingRevealTxs etches the rune of runeOpReturnData in a reveal
+// that commits to r, with logo inscribed in the same script if it is not nil.
+func buildRuneEtchingRevealTxs(pubKey *btcec.PublicKey, utxo []*Utxo, runeOpReturnData []byte, r runestone.Rune, logo *Inscription,
+	feeRate int64, revealValue int64, net *chaincfg.Params, toAddr string, recovery []byte) (*revealTxs, error) {
+	//build 2 tx, 1 transfer BTC to taproot address, 2 inscription transfer taproot address to another address
+	receiver, err := btcutil.DecodeAddress(toAddr, net)
 	if err != nil {
-		return nil, nil, err
-	}
-	// 3. build commit tx
-	out := &wire.TxOut{
-		Value:    totalPrevOutput,
-		PkScript: inscriptionPkScript,
+		return nil, err
 	}
-	commitTx, err := buildCommitTx(utxo, out, feeRate, nil, true)
+	// 1. build inscription script
+	inscriptionScript, err := CreateEtchingScript(pubKey, r, logo)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	// 4. completeRevealTx
-	revealTx, err = completeRevealTx(privateKey, commitTx, revealTx, inscriptionScript)
+	txs, err := buildRevealTxs(pubKey, utxo, inscriptionScript, receiver, revealValue, feeRate, net, runeOpReturnData, recovery)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	// 5. sign commit tx
-	commitTx, err = signCommitTx(privateKey, utxo, commitTx)
-	if err != nil {
-		return nil, nil, err
+	// the etching is only valid once the commitment has matured, ord keeps the
+	// reveal from being mined earlier
+	txs.revealTx.Version = 2
+	txs.revealTx.TxIn[0].Sequence = runestone.COMMIT_CONFIRMATIONS - 1
+	return txs, nil
+}
+
+// revealTxs is an unsigned commit transaction and the reveal transaction that
+// spends one of its outputs, the first unless in a batch, through the
+// tapscript leaf script.
+type revealTxs struct {
+	commitTx *wire.MsgTx
+	revealTx *wire.MsgTx
+	pubKey   *btcec.PublicKey
+	script   []byte
+	input    int        // the input spending the commit, after the parents
+	parents  []*Utxo    // the other inputs, spent with the keys of the wallet
+	feeRate  int64      // sat/vB the commit output pays the reveal for
+	fee      *revealFee // what the reveal pays, once signed
+	recovery []byte     // the recovery leaf of the commit output, if any
+}
+
+// tree is the script tree of the commit output: script, then the recovery
+// leaf.
+func (r *revealTxs) tree() (*TapTree, error) {
+	if r.recovery == nil {
+		return NewTapTree(r.pubKey, r.script)
 	}
-	// 6. serialize
-	commitTxBytes, err := serializeTx(commitTx)
+	return NewTapTree(r.pubKey, r.script, r.recovery)
+}
+
+func buildRevealTxs(pubKey *btcec.PublicKey, utxo []*Utxo, inscriptionScript []byte, receiver btcutil.Address, revealValue, feeRate int64, net *chaincfg.Params, opReturnData []byte, recovery []byte) (*revealTxs, error) {
+	// 2. build reveal tx
+	revealTx, err := buildEmptyRevealTx(receiver, revealValue, opReturnData)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	revealTxBytes, err := serializeTx(revealTx)
+	txs := &revealTxs{revealTx: revealTx, pubKey: pubKey, script: inscriptionScript, feeRate: feeRate, recovery: recovery}
+	tree, err := txs.tree()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return commitTxBytes, revealTxBytes, nil
-}
-func BuildRuneEtchingTxs(privateKey *btcec.PrivateKey, utxo []*Utxo, runeOpReturnData []byte, runeCommitment []byte,
-	feeRate int64, revealValue int64, net *chaincfg.Params, toAddr string) ([]byte, []byte, error) {
-	//build 2 tx, 1 transfer BTC to taproot address, 2 inscription transfer taproot address to another address
-	pubKey := privateKey.PubKey()
-	receiver, err := btcutil.DecodeAddress(toAddr, net)
+	inscriptionPkScript, err := tree.PkScript()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	// 1. build inscription script
-	inscriptionScript, err := CreateCommitmentScript(pubKey, runeCommitment)
+	vsize, err := txs.vsize()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	inscriptionAddress, err := GetTapScriptAddress(pubKey, inscriptionScript, net)
-	if err != nil {
-		return nil, nil, err
+	if vsize > MaxStandardTxWeight/4 {
+		return nil, fmt.Errorf("reveal of %d vB exceeds the standard transaction weight", vsize)
 	}
-	inscriptionPkScript, _ := txscript.PayToAddrScript(inscriptionAddress)
-	// 2. build reveal tx
-	revealTx, totalPrevOutput, err := buildEmptyRevealTx(receiver, inscriptionScript, revealValue, feeRate, runeOpReturnData)
-	if err != nil {
-		return nil, nil, err
+	// 3. build commit tx, paying the outputs of the reveal and its fee
+	totalPrevOutput := vsize * feeRate
+	for _, out := range revealTx.TxOut {
+		totalPrevOutput += out.Value
 	}
-	// 3. build commit tx
 	out := &wire.TxOut{
 		Value:    totalPrevOutput,
 		PkScript: inscriptionPkScript,
 	}
-	commitTx, err := buildCommitTx(utxo, out, feeRate, nil, true)
+	commitTx, err := buildCommitTx(utxo, []*wire.TxOut{out}, feeRate, nil, true, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	// 4. completeRevealTx
-	revealTx, err = completeRevealTx(privateKey, commitTx, revealTx, inscriptionScript)
+	revealTx.TxIn[0].PreviousOutPoint.Hash = commitTx.TxHash()
+	txs.commitTx = commitTx
+	return txs, nil
+}
+
+// sign signs the commit transaction with keys, then the reveal with
+// privateKey, and serializes both.
+func (r *revealTxs) sign(privateKey *btcec.PrivateKey, keys KeySource, utxo []*Utxo) ([]byte, []byte, error) {
+	// 4. sign commit tx, legacy inputs change its hash
+	commitTx, err := signCommitTx(keys, utxo, r.commitTx)
 	if err != nil {
 		return nil, nil, err
 	}
-	// 5. sign commit tx
-	commitTx, err = signCommitTx(privateKey, utxo, commitTx)
+	// 5. completeRevealTx
+	revealTx, err := completeRevealTx(privateKey, keys, commitTx, r)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -129,22 +147,42 @@ func BuildRuneEtchingTxs(privateKey *btcec.PrivateKey, utxo []*Utxo, runeOpRetur
 	}
 	return commitTxBytes, revealTxBytes, nil
 }
-func BuildTransferBTCTx(privateKey *btcec.PrivateKey, utxo []*Utxo, toAddr string, toAmount, feeRate int64, net *chaincfg.Params, runeData []byte, splitChangeOutput bool) ([]byte, error) {
-  	address, err := btcutil.DecodeAddress(toAddr, net)
+
+// psbts returns the commit and reveal PSBTs. The reveal spends the unsigned
+// commit hash, so the commit must not have legacy inputs.
+func (r *revealTxs) psbts(pubKeys PubKeySource, utxo []*Utxo, prevTx PrevTxFetcher) ([]byte, []byte, error) {
+	for _, in := range r.commitTx.TxIn {
+		prevOut := UtxoList(utxo).FetchPrevOutput(in.PreviousOutPoint)
+		if prevOut != nil && classifyInput(prevOut.PkScript) == inputP2PKH {
+			return nil, nil, errors.New("a commit PSBT with p2pkh inputs changes its txid when signed, fund it from segwit outputs")
+		}
+	}
+	commit, err := newFundingPsbt(r.commitTx, utxo, pubKeys, prevTx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	pkScript, err := txscript.PayToAddrScript(address)
+	commitBytes, err := serializePsbt(commit)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	revealBytes, err := r.revealPsbt(pubKeys, prevTx)
+	if err != nil {
+		return nil, nil, err
 	}
+	return commitBytes, revealBytes, nil
+}
+
+// BuildTransferBTCTx sends toAmount to toAddr. The change goes to changeAddr if
+// set, to the first input's address if splitChangeOutput, or else into the
+// toAddr output.
+func BuildTransferBTCTx(keys KeySource, utxo []*Utxo, toAddr string, toAmount, feeRate int64, net *chaincfg.Params, runeData []byte, splitChangeOutput bool, changeAddr string) ([]byte, error) {
 	// 1. build tx
-	transferTx, err := buildCommitTx(utxo, wire.NewTxOut(toAmount, pkScript), feeRate, runeData, splitChangeOutput)
+	transferTx, err := buildTransferTx(utxo, toAddr, toAmount, feeRate, net, runeData, splitChangeOutput, changeAddr)
 	if err != nil {
 		return nil, err
 	}
 	// 2.sign tx
-	transferTx, err = signCommitTx(privateKey, utxo, transferTx)
+	transferTx, err = signCommitTx(keys, utxo, transferTx)
 	if err != nil {
 		return nil, err
 	}
@@ -156,43 +194,49 @@ func BuildTransferBTCTx(privateKey *btcec.PrivateKey, utxo []*Utxo, toAddr strin
 	return commitTxBytes, nil
 }
 
-func VerifyTx(rawTx string, prevTxOutScript []byte, prevTxOutValue int64) error {
-	txBytes, err := hex.DecodeString(rawTx)
+// BuildTransferBTCPsbt is BuildTransferBTCTx for an offline signer. It also
+// returns the unsigned transaction, whose hash is final unless it has legacy
+// inputs.
+func BuildTransferBTCPsbt(pubKeys PubKeySource, utxo []*Utxo, toAddr string, toAmount, feeRate int64, net *chaincfg.Params, runeData []byte, splitChangeOutput bool, changeAddr string, prevTx PrevTxFetcher) ([]byte, *wire.MsgTx, error) {
+	transferTx, err := buildTransferTx(utxo, toAddr, toAmount, feeRate, net, runeData, splitChangeOutput, changeAddr)
 	if err != nil {
-		fmt.Println("Error decoding transaction:", err)
-		return err
+		return nil, nil, err
 	}
-
-	var tx wire.MsgTx
-	if err := tx.Deserialize(bytes.NewReader(txBytes)); err != nil {
-		fmt.Println("Error deserializing transaction:", err)
-		return err
+	packet, err := newFundingPsbt(transferTx, utxo, pubKeys, prevTx)
+	if err != nil {
+		return nil, nil, err
 	}
+	b, err := serializePsbt(packet)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, transferTx, nil
+}
 
-	for i, _ := range tx.TxIn {
-
-		outputFetcher := txscript.NewCannedPrevOutputFetcher(prevTxOutScript, prevTxOutValue)
-		sigHashes := txscript.NewTxSigHashes(&tx, outputFetcher)
-		vm, err := txscript.NewEngine(prevTxOutScript, &tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevTxOutValue, outputFetcher)
+func buildTransferTx(utxo []*Utxo, toAddr string, toAmount, feeRate int64, net *chaincfg.Params, runeData []byte, splitChangeOutput bool, changeAddr string) (*wire.MsgTx, error) {
+	address, err := btcutil.DecodeAddress(toAddr, net)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, err
+	}
+	var changePkScript []byte
+	if changeAddr != "" {
+		change, err := btcutil.DecodeAddress(changeAddr, net)
 		if err != nil {
-			fmt.Printf("Error creating script engine for input %d: %v\n", i, err)
-			return err
+			return nil, err
 		}
-
-		if err := vm.Execute(); err != nil {
-			fmt.Printf("Invalid signature for input %d: %v\n", i, err)
-			return err
-		} else {
-			fmt.Printf("Valid signature for input %d\n", i)
+		if changePkScript, err = txscript.PayToAddrScript(change); err != nil {
+			return nil, err
 		}
+		splitChangeOutput = true
 	}
-	fmt.Println("Transaction successfully verified")
-	return nil
+	return buildCommitTx(utxo, []*wire.TxOut{wire.NewTxOut(toAmount, pkScript)}, feeRate, runeData, splitChangeOutput, changePkScript)
 }
 
-func buildEmptyRevealTx(receiver btcutil.Address, inscriptionScript []byte, revealOutValue, feeRate int64, opReturnData []byte) (
-	*wire.MsgTx, int64, error) {
-	totalPrevOutput := int64(0)
+func buildEmptyRevealTx(receiver btcutil.Address, revealOutValue int64, opReturnData []byte) (*wire.MsgTx, error) {
 	tx := wire.NewMsgTx(wire.TxVersion)
 	// add 1 txin
 	in := wire.NewTxIn(&wire.OutPoint{Index: uint32(0)}, nil, nil)
@@ -204,122 +248,196 @@ func buildEmptyRevealTx(receiver btcutil.Address, inscriptionScript []byte, reve
 	// add 1 txout
 	scriptPubKey, err := txscript.PayToAddrScript(receiver)
 	if err != nil {
-		return nil, 0, err
-	}
-	out := wire.NewTxOut(revealOutValue, scriptPubKey)
-	tx.AddTxOut(out)
-	// calculate total prev output
-	revealBaseTxFee := int64(tx.SerializeSize()) * feeRate
-	totalPrevOutput += revealOutValue + revealBaseTxFee
-	// add witness
-	emptySignature := make([]byte, 64)
-	emptyControlBlockWitness := make([]byte, 33)
-	// calculate total prev output
-	fee := (int64(wire.TxWitness{emptySignature, inscriptionScript, emptyControlBlockWitness}.SerializeSize()+2+3) / 4) * feeRate
-	totalPrevOutput += fee
+		return nil, err
+	}
+	tx.AddTxOut(wire.NewTxOut(revealOutValue, scriptPubKey))
+	return tx, nil
+}
+
+// revealVsize is the vsize of revealTx once its input spends script with a
+// schnorr signature, through a tree of script alone.
+func revealVsize(revealTx *wire.MsgTx, script []byte) int64 {
+	vsize, _ := (&revealTxs{revealTx: revealTx, script: script}).vsize()
+	return vsize
+}
+
+// vsize is the virtual size of the reveal once signed, its parents included,
+// measured on a copy signed with dummy signatures of the final sizes.
+func (r *revealTxs) vsize() (int64, error) {
+	tree, err := r.tree()
+	if err != nil {
+		return 0, err
+	}
+	tx := r.revealTx.Copy()
+	for i, in := range tx.TxIn {
+		if i == r.input {
+			in.Witness = wire.TxWitness{make([]byte, schnorr.SignatureSize), r.script, make([]byte, tree.ControlBlockSize(0))}
+			continue
+		}
+		prevOut := UtxoList(r.parents).FetchPrevOutput(in.PreviousOutPoint)
+		if prevOut == nil {
+			return 0, fmt.Errorf("no utxo for input %d", i)
+		}
+		if err := mockSignInput(in, prevOut.PkScript); err != nil {
+			return 0, err
+		}
+	}
+	return mempool.GetTxVirtualSize(btcutil.NewTx(tx)), nil
+}
 
-	return tx, totalPrevOutput, nil
+// revealFee is the fee a signed reveal pays and the fee its vsize requires at
+// the fee rate it was built for.
+type revealFee struct {
+	Vsize    int64
+	Fee      int64
+	Required int64
 }
-func findBestUtxo(commitTxOutPointList []*Utxo, totalRevealPrevOutput, commitFeeRate int64) []*Utxo {
-	sort.Slice(commitTxOutPointList, func(i, j int) bool {
-		return commitTxOutPointList[i].Value > commitTxOutPointList[j].Value
-	})
-	best := make([]*Utxo, 0)
-	total := int64(0)
-	for _, utxo := range commitTxOutPointList {
-		if total >= totalRevealPrevOutput+commitFeeRate {
-			break
+
+func newRevealFee(tx *wire.MsgTx, prevOuts txscript.PrevOutputFetcher, feeRate int64) (*revealFee, error) {
+	f := &revealFee{Vsize: mempool.GetTxVirtualSize(btcutil.NewTx(tx))}
+	for i, in := range tx.TxIn {
+		prevOut := prevOuts.FetchPrevOutput(in.PreviousOutPoint)
+		if prevOut == nil {
+			return nil, fmt.Errorf("no utxo for input %d", i)
 		}
-		best = append(best, utxo)
-		total += utxo.Value
+		f.Fee += prevOut.Value
+	}
+	for _, out := range tx.TxOut {
+		f.Fee -= out.Value
 	}
-	return best
+	f.Required = f.Vsize * feeRate
+	return f, nil
+}
+
+// Overpaid is how much more than required the reveal pays, negative if it
+// pays less.
+func (f *revealFee) Overpaid() int64 {
+	return f.Fee - f.Required
 }
 
-func buildCommitTx(commitTxOutPointList []*Utxo, revealTxPrevOutput *wire.TxOut, commitFeeRate int64, runeData []byte, splitChangeOutput bool) (*wire.MsgTx, error) {
+func buildCommitTx(commitTxOutPointList []*Utxo, revealTxPrevOutputs []*wire.TxOut, commitFeeRate int64, runeData []byte, splitChangeOutput bool, splitChangePkScript []byte) (*wire.MsgTx, error) {
 	totalSenderAmount := btcutil.Amount(0)
-	totalRevealPrevOutput := revealTxPrevOutput.Value
+	totalRevealPrevOutput := int64(0)
 	tx := wire.NewMsgTx(wire.TxVersion)
-	var changePkScript *[]byte
-	bestUtxo := findBestUtxo(commitTxOutPointList, totalRevealPrevOutput, commitFeeRate)
+	if len(runeData) > 0 {
+		tx.AddTxOut(wire.NewTxOut(0, runeData))
+	}
+	// add reveal tx outputs
+	for _, out := range revealTxPrevOutputs {
+		tx.AddTxOut(out)
+		totalRevealPrevOutput += out.Value
+	}
 
- 
-	for _, utxo := range bestUtxo { 
-		txOut := utxo.TxOut()  
+	// select inputs for the outputs and the fee of the tx without inputs, the
+	// segwit marker and flag included. Without a split change output the
+	// change goes to the last output, so any overshoot is fine.
+	target := totalRevealPrevOutput + vbytesFee(int64(tx.SerializeSizeStripped())*4+2, commitFeeRate)
+	changeCost := int64(math.MaxInt64 / 4)
+	if splitChangeOutput {
+		changeScriptLen := len(splitChangePkScript)
+		if splitChangePkScript == nil {
+			for _, utxo := range commitTxOutPointList {
+				changeScriptLen = max(changeScriptLen, len(utxo.PkScript))
+			}
+		}
+		changeCost = vbytesFee(int64(wire.NewTxOut(0, make([]byte, changeScriptLen)).SerializeSize())*4, commitFeeRate) + dustLimit
+	}
+	bestUtxo, changeless, err := selectCoins(commitTxOutPointList, target, changeCost, commitFeeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	changePkScript := splitChangePkScript
+	for _, utxo := range bestUtxo {
+		txOut := utxo.TxOut()
 		outPoint := utxo.OutPoint()
-		   
 		if changePkScript == nil { // first sender as change address
-			changePkScript = &txOut.PkScript
+			changePkScript = txOut.PkScript
 		}
 		in := wire.NewTxIn(&outPoint, nil, nil)
 		in.Sequence = defaultSequenceNum
 		tx.AddTxIn(in)
 		totalSenderAmount += btcutil.Amount(txOut.Value)
 	}
-	if len(runeData) > 0 {
-
-		tx.AddTxOut(wire.NewTxOut(0, runeData))
-
-	}
-	// add reveal tx output
-	tx.AddTxOut(revealTxPrevOutput)
-	// || !bytes.Equal(*changePkScript, revealTxPrevOutput.PkScript)
-	if splitChangeOutput  {
+	if splitChangeOutput && !changeless {
 		// add change output
-		tx.AddTxOut(wire.NewTxOut(0, *changePkScript))
+		tx.AddTxOut(wire.NewTxOut(0, changePkScript))
 	}
 	//mock witness to calculate fee
-	emptySignature := make([]byte, 64)
-	for _, in := range tx.TxIn {
-		in.Witness = wire.TxWitness{emptySignature}
+	for i, in := range tx.TxIn {
+		if err := mockSignInput(in, bestUtxo[i].PkScript); err != nil {
+			return nil, err
+		}
 	}
 	fee := btcutil.Amount(mempool.GetTxVirtualSize(btcutil.NewTx(tx))) * btcutil.Amount(commitFeeRate)
 	changeAmount := totalSenderAmount - btcutil.Amount(totalRevealPrevOutput) - fee
-	if changeAmount > 0 {
-		tx.TxOut[len(tx.TxOut)-1].Value += int64(changeAmount)
-	} else {
-		tx.TxOut = tx.TxOut[:len(tx.TxOut)-1]
-		if changeAmount < 0 {
-			feeWithoutChange := btcutil.Amount(mempool.GetTxVirtualSize(btcutil.NewTx(tx))) * btcutil.Amount(commitFeeRate)
-			if totalSenderAmount-btcutil.Amount(totalRevealPrevOutput)-feeWithoutChange < 0 {
-				return nil, errors.New("insufficient balance")
-			}
+	switch {
+	case changeAmount < 0:
+		return nil, ErrInsufficientBalance
+	case splitChangeOutput && !changeless:
+		if changeAmount < dustLimit {
+			// the change output would be dust, leave it to the fee
+			tx.TxOut = tx.TxOut[:len(tx.TxOut)-1]
+		} else {
+			tx.TxOut[len(tx.TxOut)-1].Value = int64(changeAmount)
 		}
+	case !splitChangeOutput:
+		tx.TxOut[len(tx.TxOut)-1].Value += int64(changeAmount)
 	}
 	//clear mock witness
 	for _, in := range tx.TxIn {
 		in.Witness = nil
+		in.SignatureScript = nil
 	}
 	return tx, nil
 }
 
-func completeRevealTx(privateKey *btcec.PrivateKey, commitTx *wire.MsgTx, revealTx *wire.MsgTx, inscriptionScript []byte) (*wire.MsgTx, error) {
-	//set commit tx hash to reveal tx input
-	revealTx.TxIn[0].PreviousOutPoint.Hash = commitTx.TxHash()
-	// witness[0]. sign commit tx
-	revealTxPrevOutputFetcher := txscript.NewCannedPrevOutputFetcher(commitTx.TxOut[0].PkScript, commitTx.TxOut[0].Value)
-	tsHash, err := txscript.CalcTapscriptSignaturehash(txscript.NewTxSigHashes(revealTx, revealTxPrevOutputFetcher),
-		txscript.SigHashDefault, revealTx, 0, revealTxPrevOutputFetcher, txscript.NewBaseTapLeaf(inscriptionScript))
+// prevOuts returns the commit output and the parents spent by the reveal.
+func (r *revealTxs) prevOuts() *txscript.MultiPrevOutFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	commitOutPoint := r.revealTx.TxIn[r.input].PreviousOutPoint
+	fetcher.AddPrevOut(commitOutPoint, r.commitTx.TxOut[commitOutPoint.Index])
+	for _, parent := range r.parents {
+		fetcher.AddPrevOut(parent.OutPoint(), parent.TxOut())
+	}
+	return fetcher
+}
+
+// completeRevealTx signs the commit input of the reveal with privateKey and
+// its parents with keys.
+func completeRevealTx(privateKey *btcec.PrivateKey, keys KeySource, commitTx *wire.MsgTx, r *revealTxs) (*wire.MsgTx, error) {
+	revealTx := r.revealTx
+	tree, err := r.tree()
 	if err != nil {
 		return nil, err
 	}
-	signature, err := schnorr.Sign(privateKey, tsHash)
+	//set commit tx hash to reveal tx input
+	revealTx.TxIn[r.input].PreviousOutPoint.Hash = commitTx.TxHash()
+	revealTxPrevOutputFetcher := r.prevOuts()
+	sigHashes := txscript.NewTxSigHashes(revealTx, revealTxPrevOutputFetcher)
+	// sign the commit input through the leaf script
+	witness, err := tapscriptWitness(privateKey, revealTx, r.input, revealTxPrevOutputFetcher, sigHashes, tree, 0)
 	if err != nil {
 		return nil, err
 	}
-	//witness[2]. build control block
-	leafNode := txscript.NewBaseTapLeaf(inscriptionScript)
-	proof := &txscript.TapscriptProof{
-		TapLeaf:  leafNode,
-		RootNode: leafNode,
-	}
-	controlBlock := proof.ToControlBlock(privateKey.PubKey())
-	controlBlockWitness, err := controlBlock.ToBytes()
-	if err != nil {
-		return nil, err
+	revealTx.TxIn[r.input].Witness = witness
+	// 4. sign the parents
+	for i, in := range revealTx.TxIn {
+		if i == r.input {
+			continue
+		}
+		prevOut := revealTxPrevOutputFetcher.FetchPrevOutput(in.PreviousOutPoint)
+		if prevOut == nil {
+			return nil, fmt.Errorf("no utxo for input %d", i)
+		}
+		prvKey, err := keys.KeyForScript(prevOut.PkScript)
+		if err != nil {
+			return nil, err
+		}
+		if err := signInput(revealTx, i, prevOut, sigHashes, prvKey); err != nil {
+			return nil, err
+		}
 	}
-	// 3. set full witness
-	revealTx.TxIn[0].Witness = wire.TxWitness{signature.Serialize(), inscriptionScript, controlBlockWitness}
 
 	// check tx max tx weight
 
@@ -327,21 +445,77 @@ func completeRevealTx(privateKey *btcec.PrivateKey, commitTx *wire.MsgTx, reveal
 	if revealWeight > MaxStandardTxWeight {
 		return nil, errors.New(fmt.Sprintf("reveal(index %d) transaction weight greater than %d (MAX_STANDARD_TX_WEIGHT): %d", 0, MaxStandardTxWeight, revealWeight))
 	}
+	// check the fee rate on the signed size
+	fee, err := newRevealFee(revealTx, revealTxPrevOutputFetcher, r.feeRate)
+	if err != nil {
+		return nil, err
+	}
+	if fee.Overpaid() < 0 {
+		return nil, fmt.Errorf("reveal of %d vB pays %d sat, %d short of %d sat/vB", fee.Vsize, fee.Fee, -fee.Overpaid(), r.feeRate)
+	}
+	r.fee = fee
 
 	return revealTx, nil
 }
 
-func signCommitTx(prvKey *btcec.PrivateKey, utxos []*Utxo, commitTx *wire.MsgTx) (*wire.MsgTx, error) {
+// tapscriptWitness signs input i of tx, which spends an output of tree,
+// through leaf with privateKey.
+func tapscriptWitness(privateKey *btcec.PrivateKey, tx *wire.MsgTx, i int, prevOuts txscript.PrevOutputFetcher, sigHashes *txscript.TxSigHashes, tree *TapTree, leaf int) (wire.TxWitness, error) {
+	// witness[0]. sign commit tx
+	script := tree.Leaves[leaf]
+	tsHash, err := txscript.CalcTapscriptSignaturehash(sigHashes,
+		txscript.SigHashDefault, tx, i, prevOuts, txscript.NewBaseTapLeaf(script))
+	if err != nil {
+		return nil, err
+	}
+	// schnorr.Sign negates an odd key in place, sign with a copy so the
+	// key stays usable for the inputs signed after this one
+	key := *privateKey
+	signature, err := schnorr.Sign(&key, tsHash)
+	if err != nil {
+		return nil, err
+	}
+	//witness[2]. build control block
+	controlBlockWitness, err := tree.ControlBlock(leaf)
+	if err != nil {
+		return nil, err
+	}
+	return wire.TxWitness{signature.Serialize(), script, controlBlockWitness}, nil
+}
+
+// keyPathWitness signs input i of tx, which spends an output of tree, by the
+// key path with the internal key privateKey.
+func keyPathWitness(privateKey *btcec.PrivateKey, tx *wire.MsgTx, i int, prevOuts txscript.PrevOutputFetcher, sigHashes *txscript.TxSigHashes, tree *TapTree) (wire.TxWitness, error) {
+	prevOut := prevOuts.FetchPrevOutput(tx.TxIn[i].PreviousOutPoint)
+	if prevOut == nil {
+		return nil, fmt.Errorf("no utxo for input %d", i)
+	}
+	signature, err := txscript.RawTxInTaprootSignature(tx, sigHashes, i, prevOut.Value, prevOut.PkScript,
+		tree.RootHash(), txscript.SigHashDefault, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return wire.TxWitness{signature}, nil
+}
+
+// signCommitTx signs every input with the key keys has for the spent script.
+// Inputs may be of any type signInput supports.
+func signCommitTx(keys KeySource, utxos []*Utxo, commitTx *wire.MsgTx) (*wire.MsgTx, error) {
 	// build utxoList for FetchPrevOutput
 	utxoList := UtxoList(utxos)
-	for i, txIn := range commitTx.TxIn {
+	sigHashes := txscript.NewTxSigHashes(commitTx, utxoList)
+	for i := range commitTx.TxIn {
 		txOut := utxoList.FetchPrevOutput(commitTx.TxIn[i].PreviousOutPoint)
-		witness, err := txscript.TaprootWitnessSignature(commitTx, txscript.NewTxSigHashes(commitTx, utxoList),
-			i, txOut.Value, txOut.PkScript, txscript.SigHashDefault, prvKey)
+		if txOut == nil {
+			return nil, fmt.Errorf("no utxo for input %d", i)
+		}
+		prvKey, err := keys.KeyForScript(txOut.PkScript)
 		if err != nil {
 			return nil, err
 		}
-		txIn.Witness = witness
+		if err := signInput(commitTx, i, txOut, sigHashes, prvKey); err != nil {
+			return nil, err
+		}
 	}
 
 	return commitTx, nil
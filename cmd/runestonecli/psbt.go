@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+// PrevTxFetcher returns a whole previous transaction. PSBTs need them for
+// legacy inputs, whose signature does not commit to the spent amount.
+type PrevTxFetcher func(hash chainhash.Hash) (*wire.MsgTx, error)
+
+// newFundingPsbt wraps an unsigned transaction spending utxos in a PSBT,
+// adding to every input what a signer needs for its script type.
+func newFundingPsbt(tx *wire.MsgTx, utxos []*Utxo, pubKeys PubKeySource, prevTx PrevTxFetcher) (*psbt.Packet, error) {
+	packet, err := psbt.NewFromUnsignedTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	utxoList := UtxoList(utxos)
+	for i, txIn := range tx.TxIn {
+		prevOut := utxoList.FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut == nil {
+			return nil, fmt.Errorf("no utxo for input %d", i)
+		}
+		if err := addPsbtInputInfo(&packet.Inputs[i], i, txIn, prevOut, pubKeys, prevTx); err != nil {
+			return nil, err
+		}
+	}
+	return packet, nil
+}
+
+// addPsbtInputInfo adds to in, input i spending prevOut, what a signer needs
+// for its script type.
+func addPsbtInputInfo(in *psbt.PInput, i int, txIn *wire.TxIn, prevOut *wire.TxOut, pubKeys PubKeySource, prevTx PrevTxFetcher) error {
+	var err error
+	switch t := classifyInput(prevOut.PkScript); t {
+	case inputP2TR:
+		in.WitnessUtxo = prevOut
+		if pubKey, err := pubKeys.PubKeyForScript(prevOut.PkScript); err == nil {
+			in.TaprootInternalKey = schnorr.SerializePubKey(pubKey)
+		}
+	case inputP2WPKH:
+		in.WitnessUtxo = prevOut
+		in.SighashType = txscript.SigHashAll
+	case inputP2SHP2WPKH:
+		pubKey, err := pubKeys.PubKeyForScript(prevOut.PkScript)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		if in.RedeemScript, err = p2wpkhScript(pubKey); err != nil {
+			return err
+		}
+		in.WitnessUtxo = prevOut
+		in.SighashType = txscript.SigHashAll
+	case inputP2PKH:
+		if prevTx == nil {
+			return fmt.Errorf("input %d: p2pkh inputs need the previous transaction", i)
+		}
+		if in.NonWitnessUtxo, err = prevTx(txIn.PreviousOutPoint.Hash); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		in.SighashType = txscript.SigHashAll
+	default:
+		return fmt.Errorf("input %d: unsupported input script %x", i, prevOut.PkScript)
+	}
+	return nil
+}
+
+// revealPsbt wraps the reveal transaction, spending its commit output through
+// the single leaf script of internal key r.pubKey, and its parents.
+func (r *revealTxs) revealPsbt(pubKeys PubKeySource, prevTx PrevTxFetcher) ([]byte, error) {
+	packet, err := psbt.NewFromUnsignedTx(r.revealTx)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := r.tree()
+	if err != nil {
+		return nil, err
+	}
+	controlBlock, err := tree.ControlBlock(0)
+	if err != nil {
+		return nil, err
+	}
+	commitOutPoint := r.revealTx.TxIn[r.input].PreviousOutPoint
+	in := &packet.Inputs[r.input]
+	in.WitnessUtxo = r.commitTx.TxOut[commitOutPoint.Index]
+	in.TaprootInternalKey = schnorr.SerializePubKey(r.pubKey)
+	in.TaprootMerkleRoot = tree.RootHash()
+	in.TaprootLeafScript = []*psbt.TaprootTapLeafScript{{
+		ControlBlock: controlBlock,
+		Script:       r.script,
+		LeafVersion:  txscript.BaseLeafVersion,
+	}}
+	for i, txIn := range r.revealTx.TxIn {
+		if i == r.input {
+			continue
+		}
+		prevOut := UtxoList(r.parents).FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut == nil {
+			return nil, fmt.Errorf("no utxo for input %d", i)
+		}
+		if err := addPsbtInputInfo(&packet.Inputs[i], i, txIn, prevOut, pubKeys, prevTx); err != nil {
+			return nil, err
+		}
+	}
+	return serializePsbt(packet)
+}
+
+func serializePsbt(packet *psbt.Packet) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := packet.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parsePsbt accepts a binary or base64 PSBT.
+func parsePsbt(data []byte) (*psbt.Packet, error) {
+	b64 := !bytes.HasPrefix(data, []byte("psbt\xff"))
+	if b64 {
+		data = bytes.TrimSpace(data)
+	}
+	return psbt.NewFromRawBytes(bytes.NewReader(data), b64)
+}
+
+// finalizePsbt completes the scripts of a signed PSBT and extracts the
+// transaction.
+func finalizePsbt(packet *psbt.Packet) (*wire.MsgTx, error) {
+	if err := psbt.MaybeFinalizeAll(packet); err != nil {
+		return nil, err
+	}
+	return psbt.Extract(packet)
+}
+
+// runFinalize extracts the transactions of signed PSBT files, in the given
+// order, and prints, writes or broadcasts them.
+func runFinalize(args []string) {
+	fs := flag.NewFlagSet("finalize", flag.ExitOnError)
+	broadcast := fs.Bool("broadcast", false, "send the transactions to LocalRpcUrl in the given order")
+	outDir := fs.String("out", "", "write the transactions with JSON summaries to this directory instead of printing them")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		p.Printf("Usage: finalize [--broadcast|--out <dir>] <signed.psbt>...\n")
+		os.Exit(2)
+	}
+	if err := finalizeFiles(fs.Args(), *broadcast, *outDir); err != nil {
+		p.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+func finalizeFiles(files []string, broadcast bool, outDir string) error {
+	source, err := config.GetUtxoSource()
+	if err != nil {
+		return err
+	}
+	var txs []*wire.MsgTx
+	var prevOuts []txscript.PrevOutputFetcher
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		packet, err := parsePsbt(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		tx, err := finalizePsbt(packet)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		txs = append(txs, tx)
+		prevOuts = append(prevOuts, psbtPrevOuts(packet))
+	}
+	for i, tx := range txs {
+		// whatever runestone the PSBT carries, it must not be a cenotaph
+		if err := VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts[i], Runestone: runestone.RunestoneScript(tx)}); err != nil {
+			return fmt.Errorf("%s: %w", files[i], err)
+		}
+		raw, err := serializeTx(tx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case broadcast:
+			txid, err := source.SendTx(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", files[i], err)
+			}
+			p.Printf("Broadcast %s: %s\n", files[i], txid)
+		case outDir != "":
+			name := strings.TrimSuffix(filepath.Base(files[i]), filepath.Ext(files[i]))
+			if err := writeTxFiles(outDir, name, raw, false, tx, prevOuts[i]); err != nil {
+				return err
+			}
+		default:
+			fmt.Printf("%s\t%s\n", tx.TxHash(), hex.EncodeToString(raw))
+		}
+	}
+	return nil
+}
+
+// psbtPrevOuts returns the outputs spent by the inputs of packet.
+func psbtPrevOuts(packet *psbt.Packet) *txscript.MultiPrevOutFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, txIn := range packet.UnsignedTx.TxIn {
+		in := packet.Inputs[i]
+		switch {
+		case in.WitnessUtxo != nil:
+			fetcher.AddPrevOut(txIn.PreviousOutPoint, in.WitnessUtxo)
+		case in.NonWitnessUtxo != nil && int(txIn.PreviousOutPoint.Index) < len(in.NonWitnessUtxo.TxOut):
+			fetcher.AddPrevOut(txIn.PreviousOutPoint, in.NonWitnessUtxo.TxOut[txIn.PreviousOutPoint.Index])
+		}
+	}
+	return fetcher
+}
+
+// rpcPrevTx fetches previous transactions from the local node.
+func rpcPrevTx(hash chainhash.Hash) (*wire.MsgTx, error) {
+	result, err := getrawtransaction(hash.String())
+	if err != nil {
+		return nil, err
+	}
+	rawHex, ok := result["hex"].(string)
+	if !ok {
+		return nil, errors.New("getrawtransaction returned no hex")
+	}
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
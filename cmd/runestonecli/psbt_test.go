@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signPsbt is an offline signer holding key: it signs every input it has the
+// information for, key path and script path alike.
+func signPsbt(t *testing.T, data []byte, key *btcec.PrivateKey) []byte {
+	packet, err := parsePsbt(data)
+	require.NoError(t, err)
+	tx := packet.UnsignedTx
+	prevOuts := psbtPrevOuts(packet)
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+	for i := range packet.Inputs {
+		in := &packet.Inputs[i]
+		prevOut := prevOuts.FetchPrevOutput(tx.TxIn[i].PreviousOutPoint)
+		require.NotNil(t, prevOut, "input %d", i)
+		switch {
+		case len(in.TaprootLeafScript) > 0:
+			leaf := in.TaprootLeafScript[0]
+			tapLeaf := txscript.NewTapLeaf(leaf.LeafVersion, leaf.Script)
+			// schnorr.Sign negates an odd key in place
+			leafKey := *key
+			sig, err := txscript.RawTxInTapscriptSignature(tx, sigHashes, i, prevOut.Value, prevOut.PkScript, tapLeaf, txscript.SigHashDefault, &leafKey)
+			require.NoError(t, err)
+			leafHash := tapLeaf.TapHash()
+			in.TaprootScriptSpendSig = []*psbt.TaprootScriptSpendSig{{
+				XOnlyPubKey: schnorr.SerializePubKey(key.PubKey()),
+				LeafHash:    leafHash[:],
+				Signature:   sig,
+				SigHash:     txscript.SigHashDefault,
+			}}
+		case in.TaprootInternalKey != nil:
+			sig, err := txscript.RawTxInTaprootSignature(tx, sigHashes, i, prevOut.Value, prevOut.PkScript, []byte{}, txscript.SigHashDefault, key)
+			require.NoError(t, err)
+			in.TaprootKeySpendSig = sig
+		default:
+			sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, i, prevOut.Value, prevOut.PkScript, txscript.SigHashAll, key)
+			require.NoError(t, err)
+			in.PartialSigs = []*psbt.PartialSig{{PubKey: key.PubKey().SerializeCompressed(), Signature: sig}}
+		}
+	}
+	signed, err := serializePsbt(packet)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestEtchingPsbtsFinalize(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	// a p2tr and a p2wpkh output fund the commit
+	utxos := keyUtxos(t, key)[:2]
+	spaced, err := runestone.SpacedRuneFromString("OFFLINE•SIGNED•RUNE")
+	require.NoError(t, err)
+	runeData := testMintData(t, runestone.Runestone{Etching: &runestone.Etching{Rune: &spaced.Rune, Spacers: &spaced.Spacers}})
+	receiver, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	recovery, err := CreateRecoveryScript(key.PubKey(), 144)
+	require.NoError(t, err)
+
+	for _, recovery := range [][]byte{nil, recovery} {
+		txs, err := buildRuneEtchingRevealTxs(key.PubKey(), utxos, runeData, spaced.Rune, nil, 3, defaultRevealOutValue, net, receiver.EncodeAddress(), recovery)
+		require.NoError(t, err)
+		commit, reveal, err := txs.psbts(singlePubKey{key.PubKey()}, utxos, nil)
+		require.NoError(t, err)
+
+		// the reveal input carries the leaf script and a control block that
+		// commits to the commit output
+		packet, err := parsePsbt(reveal)
+		require.NoError(t, err)
+		in := packet.Inputs[0]
+		assert.Equal(t, txs.commitTx.TxOut[0], in.WitnessUtxo)
+		assert.Equal(t, schnorr.SerializePubKey(key.PubKey()), in.TaprootInternalKey)
+		require.Len(t, in.TaprootLeafScript, 1)
+		assert.Equal(t, txs.script, in.TaprootLeafScript[0].Script)
+		assert.Equal(t, txscript.BaseLeafVersion, in.TaprootLeafScript[0].LeafVersion)
+		controlBlock, err := txscript.ParseControlBlock(in.TaprootLeafScript[0].ControlBlock)
+		require.NoError(t, err)
+		tree, err := txs.tree()
+		require.NoError(t, err)
+		assert.Len(t, in.TaprootLeafScript[0].ControlBlock, tree.ControlBlockSize(0))
+		root := controlBlock.RootHash(txs.script)
+		assert.Equal(t, root, in.TaprootMerkleRoot)
+		outputKey := txscript.ComputeTaprootOutputKey(key.PubKey(), root)
+		assert.Equal(t, schnorr.SerializePubKey(outputKey), in.WitnessUtxo.PkScript[2:])
+		if recovery != nil {
+			assert.Len(t, controlBlock.InclusionProof, 32)
+		} else {
+			assert.Empty(t, controlBlock.InclusionProof)
+		}
+
+		dir := t.TempDir()
+		files := []string{filepath.Join(dir, "commit.psbt"), filepath.Join(dir, "reveal.psbt")}
+		require.NoError(t, os.WriteFile(files[0], signPsbt(t, commit, key), 0600))
+		require.NoError(t, os.WriteFile(files[1], signPsbt(t, reveal, key), 0600))
+		out := filepath.Join(dir, "out")
+		require.NoError(t, finalizeFiles(files, false, out))
+
+		for _, name := range []string{"commit", "reveal"} {
+			_, err := os.Stat(filepath.Join(out, name+".hex"))
+			assert.NoError(t, err)
+			_, err = os.Stat(filepath.Join(out, name+".json"))
+			assert.NoError(t, err)
+		}
+		data, err := os.ReadFile(files[1])
+		require.NoError(t, err)
+		packet, err = parsePsbt(data)
+		require.NoError(t, err)
+		revealTx, err := finalizePsbt(packet)
+		require.NoError(t, err)
+		assert.Equal(t, txs.script, []byte(revealTx.TxIn[0].Witness[1]))
+		assert.Equal(t, in.TaprootLeafScript[0].ControlBlock, []byte(revealTx.TxIn[0].Witness[2]))
+	}
+}
+
+func TestFinalizeUnsignedPsbt(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	utxos := keyUtxos(t, key)
+	tx := wire.NewMsgTx(2)
+	outpoint := utxos[0].OutPoint()
+	tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, utxos[0].PkScript))
+	packet, err := newFundingPsbt(tx, utxos, singlePubKey{key.PubKey()}, nil)
+	require.NoError(t, err)
+	_, err = finalizePsbt(packet)
+	assert.Error(t, err)
+
+	// p2pkh inputs need the previous transaction
+	outpoint = utxos[3].OutPoint()
+	tx.TxIn[0] = wire.NewTxIn(&outpoint, nil, nil)
+	_, err = newFundingPsbt(tx, utxos, singlePubKey{key.PubKey()}, nil)
+	assert.ErrorContains(t, err, "need the previous transaction")
+
+	// base64 PSBTs are accepted as well
+	outpoint = utxos[0].OutPoint()
+	tx.TxIn[0] = wire.NewTxIn(&outpoint, nil, nil)
+	packet, err = newFundingPsbt(tx, utxos, singlePubKey{key.PubKey()}, nil)
+	require.NoError(t, err)
+	b64, err := packet.B64Encode()
+	require.NoError(t, err)
+	parsed, err := parsePsbt([]byte(b64 + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, tx.TxHash(), parsed.UnsignedTx.TxHash())
+	_, err = parsePsbt(bytes.Repeat([]byte{1}, 10))
+	assert.Error(t, err)
+}
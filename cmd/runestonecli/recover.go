@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+type recoverOptions struct {
+	stateFile   string        // inscribe的状态文件
+	etching     bool          // 用Etching配置重建脚本
+	file        string        // 用铭文文件重建脚本
+	contentType string        // 铭文文件的类型, 默认按文件检测
+	to          string        // 接收地址, 默认钱包地址
+	feeRate     int64         // 0: 用FeeEstimator
+	reveal      bool          // 重新etch或重新广播reveal交易, 而不是取回
+	path        spendPath     // 取回时花费commit输出的路径
+	notifier    BlockNotifier // 等待commit成熟时的新区块通知
+	outDir      string        // dry run: 签名后写入文件, 不广播
+}
+
+func runRecover(args []string) {
+	fs := flag.NewFlagSet("recover", flag.ExitOnError)
+	stateFile := fs.String("state", "", "rebuild the reveal scripts from this inscribe state file; the commit txid is optional")
+	etching := fs.Bool("etching", false, "rebuild the reveal script from the Etching config")
+	file := fs.String("file", "", "rebuild the reveal script of an inscription of this file")
+	contentType := fs.String("content-type", "", "content type of --file, default detected from the file")
+	to := fs.String("to", "", "address the output goes to, default the wallet address")
+	feeRate := fs.Int64("fee-rate", 0, "fee rate in sat/vB, default the FeeEstimator")
+	reveal := fs.Bool("reveal", false, "etch the rune again with --etching, or broadcast the saved reveals with --state, instead of sweeping")
+	path := fs.String("path", "", "spend the commit outputs through the key path (key), which reveals nothing, the reveal leaf (script), which reveals the inscription or rune, or the recovery leaf once its delay has passed (recovery); default key, or script with --reveal")
+	notify := fs.String("notify", config.BlockNotify, "new block source while the commit matures: poll, zmq or stdin (one line per block)")
+	interval := fs.Duration("poll-interval", 10*time.Second, "interval of the poll block source")
+	dryRun := fs.Bool("dry-run", false, "write the signed transaction with a JSON summary to --out instead of broadcasting, and exit")
+	outDir := fs.String("out", "", "directory of --dry-run, default dryrun; setting it implies --dry-run")
+	fs.IntVar(&passphraseFd, "passphrase-fd", -1, "read the keystore passphrase from this file descriptor")
+	fs.Parse(args)
+	if *dryRun && *outDir == "" {
+		*outDir = "dryrun"
+	}
+	if *path == "" {
+		*path = string(spendKey)
+		if *reveal {
+			*path = string(spendScript)
+		}
+	}
+	commitTxid := fs.Arg(0)
+	sources := 0
+	for _, set := range []bool{*stateFile != "", *etching, *file != ""} {
+		if set {
+			sources++
+		}
+	}
+	if fs.NArg() > 1 || sources != 1 || (commitTxid == "" && *stateFile == "") ||
+		(*path != string(spendScript) && *path != string(spendKey) && *path != string(spendRecovery)) {
+		p.Printf("Usage: recover [flags] <commit txid> --etching | --file <file> | --state <state file>\n")
+		os.Exit(2)
+	}
+
+	notifier, err := newBlockNotifier(*notify, config.ZmqBlockUrl, *interval)
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	source, err := config.GetUtxoSource()
+	if err != nil {
+		p.Println(err.Error())
+		return
+	}
+	if config.usesNodeWallet() {
+		if !loadWallet() {
+			return
+		}
+	} else {
+		checkAndPrintConfig()
+	}
+	opts := recoverOptions{
+		stateFile:   *stateFile,
+		etching:     *etching,
+		file:        *file,
+		contentType: *contentType,
+		to:          *to,
+		feeRate:     *feeRate,
+		reveal:      *reveal,
+		path:        spendPath(*path),
+		notifier:    notifier,
+		outDir:      *outDir,
+	}
+	if err := RecoverCommit(source, commitTxid, opts); err != nil {
+		p.Println(err.Error())
+	}
+}
+
+// RecoverCommit spends the outputs of a commit whose reveal did not confirm.
+// The reveal scripts are rebuilt from the parameters of opts with the key of
+// the first wallet, and the outputs paying to them are swept by opts.path to
+// opts.to; only the script path reveals the content. With opts.reveal an
+// etching is revealed again, its runestone included, and the reveals of a
+// state file are broadcast again.
+func RecoverCommit(source UtxoSource, commitTxid string, opts recoverOptions) error {
+	wallets, err := config.GetMintWallets()
+	if err != nil {
+		return err
+	}
+	wallet := wallets[0]
+	walletScript, err := addressScript(wallet.Address)
+	if err != nil {
+		return err
+	}
+	privateKey, err := wallet.Keys.KeyForScript(walletScript)
+	if err != nil {
+		return err
+	}
+	pubKey := privateKey.PubKey()
+	to := opts.to
+	if to == "" {
+		to = wallet.Address
+	}
+	toScript, err := addressScript(to)
+	if err != nil {
+		return err
+	}
+
+	if opts.reveal && opts.path != spendScript {
+		return errors.New("only the reveal leaf reveals")
+	}
+	recovery, err := config.GetRecoveryScript(pubKey)
+	if err != nil {
+		return err
+	}
+	var trees []*TapTree
+	var runeData []byte // the runestone of an etching revealed again
+	newTree := func(script []byte) error {
+		leaves := [][]byte{script}
+		if recovery != nil {
+			leaves = append(leaves, recovery)
+		}
+		tree, err := NewTapTree(pubKey, leaves...)
+		if err != nil {
+			return err
+		}
+		trees = append(trees, tree)
+		return nil
+	}
+	switch {
+	case opts.stateFile != "":
+		state, err := readBatchState(opts.stateFile)
+		if err != nil {
+			return err
+		}
+		if commitTxid == "" {
+			commitTxid = state.Commit
+		} else if commitTxid != state.Commit {
+			return fmt.Errorf("%s is the state of commit %s, not %s", opts.stateFile, state.Commit, commitTxid)
+		}
+		if opts.reveal {
+			return resendReveals(source, state)
+		}
+		if trees, err = state.trees(pubKey); err != nil {
+			return err
+		}
+	case opts.etching:
+		etching, err := config.GetEtching()
+		if err != nil {
+			return err
+		}
+		var logo *Inscription
+		mime, data, err := config.GetRuneLogo()
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			logo = &Inscription{ContentType: mime, Body: data}
+		}
+		script, err := CreateEtchingScript(pubKey, *etching.Rune, logo)
+		if err != nil {
+			return err
+		}
+		if err := newTree(script); err != nil {
+			return err
+		}
+		if opts.reveal {
+			if runeData, err = (&runestone.Runestone{Etching: etching}).Encipher(); err != nil {
+				return err
+			}
+		}
+	case opts.file != "":
+		body, err := getFileBytes(opts.file)
+		if err != nil {
+			return err
+		}
+		contentType := opts.contentType
+		if contentType == "" {
+			if contentType, err = getContentType(opts.file); err != nil {
+				return err
+			}
+		}
+		if err := newTree((&Inscription{ContentType: contentType, Body: body}).Script(pubKey)); err != nil {
+			return err
+		}
+	default:
+		return errors.New("nothing to rebuild the reveal scripts from")
+	}
+
+	hash, err := chainhash.NewHashFromStr(commitTxid)
+	if err != nil {
+		return err
+	}
+	commitTx, err := source.GetRawTx(*hash)
+	if err != nil {
+		return err
+	}
+	outputs, err := findStrandedOutputs(commitTx, trees, config.GetNetwork())
+	if err != nil {
+		return err
+	}
+	feeRate := opts.feeRate
+	if feeRate == 0 {
+		fees, err := config.GetFeeEstimator()
+		if err != nil {
+			return err
+		}
+		if feeRate, err = fees.EstimateFee(); err != nil {
+			return err
+		}
+	}
+	tx, err := buildRecoveryTx(outputs, runeData, toScript, feeRate, opts.path)
+	if err != nil {
+		return err
+	}
+	if err := signRecoveryTx(tx, outputs, privateKey, opts.path); err != nil {
+		return err
+	}
+	if err := VerifyTx(tx, VerifyOptions{PrevOuts: strandedPrevOuts(outputs), FeeRate: feeRate, Runestone: runeData}); err != nil {
+		return err
+	}
+	raw, err := serializeTx(tx)
+	if err != nil {
+		return err
+	}
+	p.Printf("Recovering %d outputs of commit %s to %s: %d sat at %d sat/vB\n",
+		len(outputs), commitTxid, to, tx.TxOut[len(tx.TxOut)-1].Value, feeRate)
+
+	if opts.outDir != "" {
+		return writeTxFiles(opts.outDir, "recover", raw, false, tx, strandedPrevOuts(outputs))
+	}
+	if runeData == nil {
+		txid, err := source.SendTx(raw)
+		if err != nil {
+			return err
+		}
+		p.Printf("Recovery transaction broadcast: %s\n", txid)
+		return nil
+	}
+	// an etching can only be revealed once its commitment has matured
+	p.Printf("Reveal transaction: %s\n", hex.EncodeToString(raw))
+	if txid, err := source.SendTx(raw); err == nil {
+		p.Printf("Reveal transaction broadcast: %s\n", txid)
+		return nil
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return broadcastReveal(ctx, source, opts.notifier, commitTxid, raw)
+}
+
+// resendReveals broadcasts again the signed reveals of a state file.
+func resendReveals(source UtxoSource, state *batchState) error {
+	for _, reveal := range state.Reveals {
+		if reveal.Tx == "" {
+			return errors.New("the state has no signed reveals, its batch was exported as PSBTs")
+		}
+		raw, err := hex.DecodeString(reveal.Tx)
+		if err != nil {
+			return err
+		}
+		txid, err := source.SendTx(raw)
+		if err != nil {
+			p.Printf("Reveal %s broadcast failed: %s\n", reveal.Txid, err)
+			continue
+		}
+		p.Printf("Reveal transaction broadcast: %s\n", txid)
+	}
+	return nil
+}
+
+// spendPath is how recover spends a commit output.
+type spendPath string
+
+const (
+	spendScript   spendPath = "script"   // the reveal leaf
+	spendKey      spendPath = "key"      // the key path
+	spendRecovery spendPath = "recovery" // the recovery leaf
+)
+
+// leaf is the leaf of the tree path spends through, -1 for the key path.
+func (path spendPath) leaf(tree *TapTree) (int, error) {
+	switch path {
+	case spendKey:
+		return -1, nil
+	case spendRecovery:
+		if len(tree.Leaves) < 2 {
+			return 0, errors.New("the commit output has no recovery leaf")
+		}
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// strandedOutput is a commit output and the script tree it pays to.
+type strandedOutput struct {
+	outpoint wire.OutPoint
+	prevOut  *wire.TxOut
+	tree     *TapTree
+}
+
+// findStrandedOutputs returns the output of commitTx that pays to each tree.
+func findStrandedOutputs(commitTx *wire.MsgTx, trees []*TapTree, net *chaincfg.Params) ([]*strandedOutput, error) {
+	var outputs []*strandedOutput
+	for _, tree := range trees {
+		address, err := tree.Address(net)
+		if err != nil {
+			return nil, err
+		}
+		pkScript, err := txscript.PayToAddrScript(address)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for i, out := range commitTx.TxOut {
+			if bytes.Equal(out.PkScript, pkScript) {
+				outputs = append(outputs, &strandedOutput{
+					outpoint: wire.OutPoint{Hash: commitTx.TxHash(), Index: uint32(i)},
+					prevOut:  out,
+					tree:     tree,
+				})
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no output of commit %s pays to %s, check the parameters of the reveal", commitTx.TxHash(), address.EncodeAddress())
+		}
+	}
+	return outputs, nil
+}
+
+func strandedPrevOuts(outputs []*strandedOutput) *txscript.MultiPrevOutFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for _, o := range outputs {
+		fetcher.AddPrevOut(o.outpoint, o.prevOut)
+	}
+	return fetcher
+}
+
+// buildRecoveryTx spends outputs by path to pkScript, less the fee at feeRate.
+// With runeData the transaction reveals the etching: the runestone comes first
+// and the inputs wait for the commitment to mature. Through the recovery leaf
+// the inputs wait for its delay.
+func buildRecoveryTx(outputs []*strandedOutput, runeData, pkScript []byte, feeRate int64, path spendPath) (*wire.MsgTx, error) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	signed := wire.NewMsgTx(wire.TxVersion)
+	total := int64(0)
+	for _, o := range outputs {
+		in := wire.NewTxIn(&o.outpoint, nil, nil)
+		in.Sequence = defaultSequenceNum
+		if runeData != nil {
+			in.Sequence = runestone.COMMIT_CONFIRMATIONS - 1
+		}
+		// dummy witness of the final size
+		witness := wire.TxWitness{make([]byte, schnorr.SignatureSize)}
+		leaf, err := path.leaf(o.tree)
+		if err != nil {
+			return nil, err
+		}
+		if leaf >= 0 {
+			witness = append(witness, o.tree.Leaves[leaf], make([]byte, o.tree.ControlBlockSize(leaf)))
+		}
+		if path == spendRecovery {
+			delay, err := recoveryDelay(o.tree.Leaves[leaf])
+			if err != nil {
+				return nil, err
+			}
+			in.Sequence = delay
+		}
+		tx.AddTxIn(in)
+		signed.AddTxIn(wire.NewTxIn(&o.outpoint, nil, witness))
+		total += o.prevOut.Value
+	}
+	if runeData != nil || path == spendRecovery {
+		tx.Version = 2
+	}
+	if runeData != nil {
+		tx.AddTxOut(wire.NewTxOut(0, runeData))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, pkScript))
+	signed.TxOut = tx.TxOut
+
+	fee := mempool.GetTxVirtualSize(btcutil.NewTx(signed)) * feeRate
+	out := tx.TxOut[len(tx.TxOut)-1]
+	if out.Value = total - fee; mempool.IsDust(out, mempool.DefaultMinRelayTxFee) {
+		return nil, fmt.Errorf("the outputs hold %d sat, too little for a fee of %d sat", total, fee)
+	}
+	return tx, nil
+}
+
+// signRecoveryTx signs every input by path.
+func signRecoveryTx(tx *wire.MsgTx, outputs []*strandedOutput, privateKey *btcec.PrivateKey, path spendPath) error {
+	prevOuts := strandedPrevOuts(outputs)
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+	for i, o := range outputs {
+		leaf, err := path.leaf(o.tree)
+		if err != nil {
+			return err
+		}
+		var witness wire.TxWitness
+		if leaf < 0 {
+			witness, err = keyPathWitness(privateKey, tx, i, prevOuts, sigHashes, o.tree)
+		} else {
+			witness, err = tapscriptWitness(privateKey, tx, i, prevOuts, sigHashes, o.tree, leaf)
+		}
+		if err != nil {
+			return err
+		}
+		tx.TxIn[i].Witness = witness
+	}
+	return nil
+}
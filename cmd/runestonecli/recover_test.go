@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertRecoveryValid runs the script engine on every input and checks that
+// the fee is feeRate on the signed vsize.
+func assertRecoveryValid(t *testing.T, outputs []*strandedOutput, recovery *wire.MsgTx, feeRate int64) {
+	prevOuts := strandedPrevOuts(outputs)
+	sigHashes := txscript.NewTxSigHashes(recovery, prevOuts)
+	fee := int64(0)
+	for i, o := range outputs {
+		engine, err := txscript.NewEngine(o.prevOut.PkScript, recovery, i, txscript.StandardVerifyFlags, nil, sigHashes, o.prevOut.Value, prevOuts)
+		require.NoError(t, err)
+		assert.NoError(t, engine.Execute())
+		fee += o.prevOut.Value
+	}
+	for _, out := range recovery.TxOut {
+		fee -= out.Value
+	}
+	assert.Equal(t, mempool.GetTxVirtualSize(btcutil.NewTx(recovery))*feeRate, fee)
+}
+
+func TestRecoverInscription(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 100000, PkScript: pkScript}}
+	ins := &Inscription{ContentType: "text/plain", Body: []byte("stranded")}
+	txs, err := buildInscriptionRevealTxs(key.PubKey(), utxo, ins, 10, defaultRevealOutValue, net, nil, nil)
+	require.NoError(t, err)
+	commitTx, err := signCommitTx(singleKey{key}, utxo, txs.commitTx)
+	require.NoError(t, err)
+
+	// the script is rebuilt from the file alone
+	tree, err := NewTapTree(key.PubKey(), (&Inscription{ContentType: "text/plain", Body: []byte("stranded")}).Script(key.PubKey()))
+	require.NoError(t, err)
+	outputs, err := findStrandedOutputs(commitTx, []*TapTree{tree}, net)
+	require.NoError(t, err)
+	require.Len(t, outputs, 1)
+	assert.Equal(t, commitTx.TxOut[0], outputs[0].prevOut)
+
+	recovery, err := buildRecoveryTx(outputs, nil, pkScript, 3, spendScript)
+	require.NoError(t, err)
+	require.NoError(t, signRecoveryTx(recovery, outputs, key, spendScript))
+	assert.Len(t, recovery.TxOut, 1)
+	assertRecoveryValid(t, outputs, recovery, 3)
+	// spending the script reveals the inscription anyway
+	assert.Len(t, ParseEnvelopes(recovery), 1)
+
+	// the key path reveals nothing
+	recovery, err = buildRecoveryTx(outputs, nil, pkScript, 3, spendKey)
+	require.NoError(t, err)
+	require.NoError(t, signRecoveryTx(recovery, outputs, key, spendKey))
+	assertRecoveryValid(t, outputs, recovery, 3)
+	assert.Len(t, recovery.TxIn[0].Witness, 1)
+	assert.Empty(t, ParseEnvelopes(recovery))
+
+	_, err = buildRecoveryTx(outputs, nil, pkScript, 3, spendRecovery)
+	assert.ErrorContains(t, err, "no recovery leaf")
+	other, err := NewTapTree(key.PubKey(), (&Inscription{ContentType: "text/plain", Body: []byte("other")}).Script(key.PubKey()))
+	require.NoError(t, err)
+	_, err = findStrandedOutputs(commitTx, []*TapTree{other}, net)
+	assert.ErrorContains(t, err, "no output of commit")
+	_, err = buildRecoveryTx(outputs, nil, pkScript, 1000, spendScript)
+	assert.ErrorContains(t, err, "too little")
+}
+
+func TestRecoverBatchState(t *testing.T) {
+	batch, items, _ := signedTestBatch(t, BatchRevealPerItem)
+	state, err := newBatchState(batch, &batchManifest{Inscriptions: make([]batchManifestItem, len(items))}, items, nil, 10, nil, nil)
+	require.NoError(t, err)
+	path := t.TempDir() + "/state.json"
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	state, err = readBatchState(path)
+	require.NoError(t, err)
+
+	pubKey := batch.reveals[0].pubKey
+	trees, err := state.trees(pubKey)
+	require.NoError(t, err)
+	outputs, err := findStrandedOutputs(batch.commitTx, trees, &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	assert.Len(t, outputs, 3)
+
+	other, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	_, err = state.trees(other.PubKey())
+	assert.ErrorContains(t, err, "not to the wallet key")
+}
+
+func TestRecoverEtchingReveal(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 100000, PkScript: pkScript}}
+	spaced, err := runestone.SpacedRuneFromString("STRANDED•RUNE")
+	require.NoError(t, err)
+	etching := &runestone.Etching{Rune: &spaced.Rune}
+	runeData, err := (&runestone.Runestone{Etching: etching}).Encipher()
+	require.NoError(t, err)
+	txs, err := buildRuneEtchingRevealTxs(key.PubKey(), utxo, runeData, spaced.Rune, nil, 2, defaultRevealOutValue, net, address.EncodeAddress(), nil)
+	require.NoError(t, err)
+
+	script, err := CreateEtchingScript(key.PubKey(), spaced.Rune, nil)
+	require.NoError(t, err)
+	tree, err := NewTapTree(key.PubKey(), script)
+	require.NoError(t, err)
+	outputs, err := findStrandedOutputs(txs.commitTx, []*TapTree{tree}, net)
+	require.NoError(t, err)
+	recovery, err := buildRecoveryTx(outputs, runeData, pkScript, 2, spendScript)
+	require.NoError(t, err)
+	require.NoError(t, signRecoveryTx(recovery, outputs, key, spendScript))
+	assertRecoveryValid(t, outputs, recovery, 2)
+
+	// the reveal etches as the original one would have
+	assert.EqualValues(t, 2, recovery.Version)
+	assert.EqualValues(t, runestone.COMMIT_CONFIRMATIONS-1, recovery.TxIn[0].Sequence)
+	assert.Equal(t, runeData, recovery.TxOut[0].PkScript)
+	assert.Equal(t, pkScript, recovery.TxOut[1].PkScript)
+}
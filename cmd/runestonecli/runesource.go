@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+// RuneSource provides the etching terms and current mint count of a rune,
+// together with the height its data is valid for.
+type RuneSource interface {
+	GetRuneEntry(id runestone.RuneId) (*runestone.RuneEntry, error)
+	GetBlockHeight() (uint64, error)
+}
+
+// indexRuneSource keeps a runestone.Index in memory, or in a file store in
+// dir, and fills it from the mempool api, starting at the block that etched
+// the requested rune.
+type indexRuneSource struct {
+	mu        sync.Mutex
+	connector *MempoolConnector
+	index     *runestone.Index
+	store     runestone.Store
+	network   wire.BitcoinNet
+	dir       string
+}
+
+func newIndexRuneSource(connector *MempoolConnector) *indexRuneSource {
+	return &indexRuneSource{
+		connector: connector,
+		network:   connector.network.Net,
+	}
+}
+
+func (s *indexRuneSource) GetRuneEntry(id runestone.RuneId) (*runestone.RuneEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		if err := s.newIndex(); err != nil {
+			return nil, err
+		}
+	}
+	if height, _, ok := s.index.Height(); ok && height >= id.Block {
+		if _, ok := s.index.RuneEntry(id); !ok {
+			// the index started after this rune was etched
+			if s.store != nil {
+				return nil, fmt.Errorf("the index in %s started after rune %s was etched, remove it to index from that block", s.dir, id)
+			}
+			if err := s.newIndex(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	tip, err := s.sync(id.Block)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := s.index.RuneEntry(id)
+	if !ok {
+		return nil, fmt.Errorf("rune %s not found up to block %d", id, tip)
+	}
+	copied := *entry
+	return &copied, nil
+}
+
+// startAt starts the index at height from unless it has started already.
+func (s *indexRuneSource) startAt(from uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		if err := s.newIndex(); err != nil {
+			return err
+		}
+	}
+	_, err := s.sync(from)
+	return err
+}
+
+// newIndex starts an empty index, or opens the one in dir.
+func (s *indexRuneSource) newIndex() error {
+	if s.dir == "" {
+		s.index = runestone.NewIndex(s.network)
+	} else {
+		store, err := runestone.OpenFileStore(s.dir)
+		if err != nil {
+			return err
+		}
+		index, err := runestone.OpenIndex(s.network, store)
+		if err != nil {
+			store.Close()
+			return err
+		}
+		s.index, s.store = index, store
+	}
+	s.index.Fetcher = mempoolTxOutFetcher{s.connector}
+	return nil
+}
+
+func (s *indexRuneSource) GetBlockHeight() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return s.connector.GetBlockHeight()
+	}
+	return s.sync(0)
+}
+
+// sync indexes every block up to the current tip, starting at from if the
+// index is still empty. Blocks no longer in the chain are rolled back first,
+// and again if the chain reorganizes during the sync.
+func (s *indexRuneSource) sync(from uint64) (uint64, error) {
+	tip, err := s.connector.GetBlockHeight()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.reorg(); err != nil {
+		return 0, err
+	}
+	next := from
+	if height, _, ok := s.index.Height(); ok {
+		next = height + 1
+	}
+	for ; next <= tip; next++ {
+		block, err := s.connector.GetBlockByHeight(next)
+		if err != nil {
+			return 0, err
+		}
+		err = s.index.IndexBlock(next, block)
+		if errors.Is(err, runestone.ErrBlockParent) {
+			// the chain reorganized since the blocks before were indexed
+			depth, err := s.reorg()
+			if err != nil {
+				return 0, err
+			}
+			if depth > 0 {
+				height, _, _ := s.index.Height()
+				next = height
+				continue
+			}
+		}
+		if err != nil {
+			s.drop()
+			return 0, err
+		}
+	}
+	return tip, nil
+}
+
+// reorg rolls back the indexed blocks that are no longer in the chain and
+// returns how many there were.
+func (s *indexRuneSource) reorg() (int, error) {
+	depth, err := s.index.Reorg(mempoolBlockHashFetcher{s.connector})
+	if err != nil {
+		if errors.Is(err, runestone.ErrReorgTooDeep) && s.store != nil {
+			return 0, fmt.Errorf("%w, remove %s to index again", err, s.dir)
+		}
+		s.drop()
+		return 0, err
+	}
+	if depth > 0 {
+		log.Printf("rolled back %d blocks of the rune index on a reorg", depth)
+	}
+	return depth, nil
+}
+
+// drop starts again from the store, or from scratch, next time.
+func (s *indexRuneSource) drop() {
+	s.index = nil
+	if s.store != nil {
+		s.store.Close()
+		s.store = nil
+	}
+}
+
+// mempoolTxOutFetcher resolves etching commitments through the mempool api.
+type mempoolTxOutFetcher struct {
+	connector *MempoolConnector
+}
+
+func (f mempoolTxOutFetcher) FetchTxOut(outpoint wire.OutPoint) (*wire.TxOut, uint64, error) {
+	info, err := f.connector.GetTxByHash(outpoint.Hash.String())
+	if err != nil {
+		return nil, 0, err
+	}
+	if int(outpoint.Index) >= len(info.Tx.TxOut) {
+		return nil, 0, fmt.Errorf("output %s does not exist", outpoint)
+	}
+	if info.Confirmations == 0 {
+		// not mature at any height
+		return info.Tx.TxOut[outpoint.Index], math.MaxUint64, nil
+	}
+	return info.Tx.TxOut[outpoint.Index], info.BlockHeight, nil
+}
+
+// mempoolBlockHashFetcher looks the blocks of the current chain up through the
+// mempool api.
+type mempoolBlockHashFetcher struct {
+	connector *MempoolConnector
+}
+
+func (f mempoolBlockHashFetcher) FetchBlockHash(height uint64) (chainhash.Hash, error) {
+	raw, err := f.connector.GetBlockHashByHeight(height)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	// the api gives the hash in display order
+	hash, err := chainhash.NewHashFromStr(hex.EncodeToString(raw))
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return *hash, nil
+}
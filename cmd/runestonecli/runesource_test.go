@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBlockChain serves the blocks of one of two forks through the esplora
+// api. switchAt is a height whose block request switches to the other fork
+// first, as a reorg in the middle of a sync would.
+type testBlockChain struct {
+	mu       sync.Mutex
+	forks    [2][]*wire.MsgBlock // from height 100
+	current  int
+	tip      uint64
+	switchAt uint64
+	raw      map[string][]byte
+}
+
+func newTestBlockChain(t *testing.T, shared, length int) *testBlockChain {
+	c := &testBlockChain{raw: map[string][]byte{}}
+	for fork := range c.forks {
+		for n := 0; n < length; n++ {
+			if n < shared && fork > 0 {
+				c.forks[fork] = append(c.forks[fork], c.forks[0][n])
+				continue
+			}
+			coinbase := wire.NewMsgTx(wire.TxVersion)
+			coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex}, []byte{byte(n)}, nil))
+			coinbase.AddTxOut(wire.NewTxOut(0, []byte{0x51}))
+			var prev chainhash.Hash
+			if n > 0 {
+				prev = c.forks[fork][n-1].BlockHash()
+			}
+			block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prev, &chainhash.Hash{}, 0, uint32(fork)))
+			block.Header.Timestamp = time.Unix(1700000000, 0)
+			block.AddTransaction(coinbase)
+			var buf bytes.Buffer
+			require.NoError(t, block.Serialize(&buf))
+			c.raw[block.BlockHash().String()] = buf.Bytes()
+			c.forks[fork] = append(c.forks[fork], block)
+		}
+	}
+	return c
+}
+
+func (c *testBlockChain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var height uint64
+	switch {
+	case r.URL.Path == "/blocks/tip/height":
+		fmt.Fprint(w, c.tip)
+	case strings.HasPrefix(r.URL.Path, "/block-height/"):
+		fmt.Sscan(strings.TrimPrefix(r.URL.Path, "/block-height/"), &height)
+		if height == c.switchAt {
+			c.current, c.switchAt = 1-c.current, 0
+		}
+		blocks := c.forks[c.current]
+		if height < 100 || height >= 100+uint64(len(blocks)) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, blocks[height-100].BlockHash().String())
+	case strings.HasPrefix(r.URL.Path, "/block/") && strings.HasSuffix(r.URL.Path, "/raw"):
+		raw, ok := c.raw[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/block/"), "/raw")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(raw)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestIndexRuneSourceReorgDuringSync(t *testing.T) {
+	chain := newTestBlockChain(t, 2, 4)
+	chain.tip = 102
+	server := httptest.NewServer(chain)
+	defer server.Close()
+	source := newIndexRuneSource(NewMempoolConnector(Config{Network: "regtest", RpcUrl: server.URL}))
+	require.NoError(t, source.startAt(100))
+	height, hash, _ := source.index.Height()
+	assert.Equal(t, uint64(102), height)
+	assert.Equal(t, chain.forks[0][2].BlockHash(), hash)
+
+	// the chain switches to the other fork, which replaced block 102, after
+	// the index checked its blocks against it
+	chain.mu.Lock()
+	chain.tip, chain.switchAt = 103, 103
+	chain.mu.Unlock()
+	tip, err := source.GetBlockHeight()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(103), tip)
+	height, hash, _ = source.index.Height()
+	assert.Equal(t, uint64(103), height)
+	assert.Equal(t, chain.forks[1][3].BlockHash(), hash)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// inputType is the kind of output a funding input spends.
+type inputType int
+
+const (
+	inputUnknown    inputType = iota
+	inputP2TR                 // taproot key path
+	inputP2WPKH               // segwit v0 key hash
+	inputP2SHP2WPKH           // segwit v0 key hash nested in p2sh
+	inputP2PKH                // legacy key hash
+)
+
+func (t inputType) String() string {
+	switch t {
+	case inputP2TR:
+		return "p2tr"
+	case inputP2WPKH:
+		return "p2wpkh"
+	case inputP2SHP2WPKH:
+		return "p2sh-p2wpkh"
+	case inputP2PKH:
+		return "p2pkh"
+	}
+	return "unknown"
+}
+
+// classifyInput detects the input type from the spent script. P2SH outputs
+// are assumed to wrap P2WPKH, the only kind of P2SH we sign for.
+func classifyInput(pkScript []byte) inputType {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.WitnessV1TaprootTy:
+		return inputP2TR
+	case txscript.WitnessV0PubKeyHashTy:
+		return inputP2WPKH
+	case txscript.ScriptHashTy:
+		return inputP2SHP2WPKH
+	case txscript.PubKeyHashTy:
+		return inputP2PKH
+	}
+	return inputUnknown
+}
+
+// ecdsaSigLen is the upper bound of a DER signature with its sighash byte.
+const ecdsaSigLen = 73
+
+// mockSignInput fills in placeholders as large as the real signature data, so
+// that the virtual size of the transaction can be computed before signing.
+func mockSignInput(in *wire.TxIn, pkScript []byte) error {
+	sig := make([]byte, ecdsaSigLen)
+	pubKey := make([]byte, btcec.PubKeyBytesLenCompressed)
+	switch t := classifyInput(pkScript); t {
+	case inputP2TR:
+		in.Witness = wire.TxWitness{make([]byte, 64)}
+	case inputP2WPKH:
+		in.Witness = wire.TxWitness{sig, pubKey}
+	case inputP2SHP2WPKH:
+		redeemScript := make([]byte, 22)
+		sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).Script()
+		if err != nil {
+			return err
+		}
+		in.SignatureScript = sigScript
+		in.Witness = wire.TxWitness{sig, pubKey}
+	case inputP2PKH:
+		sigScript, err := txscript.NewScriptBuilder().AddData(sig).AddData(pubKey).Script()
+		if err != nil {
+			return err
+		}
+		in.SignatureScript = sigScript
+	default:
+		return fmt.Errorf("unsupported input script %x", pkScript)
+	}
+	return nil
+}
+
+// signInput signs input i of tx, spending prevOut, with privKey.
+func signInput(tx *wire.MsgTx, i int, prevOut *wire.TxOut, sigHashes *txscript.TxSigHashes, privKey *btcec.PrivateKey) error {
+	in := tx.TxIn[i]
+	switch t := classifyInput(prevOut.PkScript); t {
+	case inputP2TR:
+		witness, err := txscript.TaprootWitnessSignature(tx, sigHashes, i, prevOut.Value, prevOut.PkScript, txscript.SigHashDefault, privKey)
+		if err != nil {
+			return err
+		}
+		in.Witness = witness
+	case inputP2WPKH:
+		witness, err := txscript.WitnessSignature(tx, sigHashes, i, prevOut.Value, prevOut.PkScript, txscript.SigHashAll, privKey, true)
+		if err != nil {
+			return err
+		}
+		in.Witness = witness
+	case inputP2SHP2WPKH:
+		redeemScript, err := p2wpkhScript(privKey.PubKey())
+		if err != nil {
+			return err
+		}
+		witness, err := txscript.WitnessSignature(tx, sigHashes, i, prevOut.Value, redeemScript, txscript.SigHashAll, privKey, true)
+		if err != nil {
+			return err
+		}
+		sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).Script()
+		if err != nil {
+			return err
+		}
+		in.SignatureScript = sigScript
+		in.Witness = witness
+	case inputP2PKH:
+		sigScript, err := txscript.SignatureScript(tx, i, prevOut.PkScript, txscript.SigHashAll, privKey, true)
+		if err != nil {
+			return err
+		}
+		in.SignatureScript = sigScript
+	default:
+		return fmt.Errorf("unsupported input script %x", prevOut.PkScript)
+	}
+	return nil
+}
+
+func p2wpkhScript(pubKey *btcec.PublicKey) ([]byte, error) {
+	return txscript.NewScriptBuilder().
+		AddOp(txscript.OP_0).
+		AddData(btcutil.Hash160(pubKey.SerializeCompressed())).
+		Script()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyUtxos returns an output of every type a single key can spend, in the
+// order of keyAddresses: p2tr, p2wpkh, p2sh-p2wpkh and p2pkh.
+func keyUtxos(t *testing.T, key *btcec.PrivateKey) []*Utxo {
+	addresses, err := keyAddresses(key.PubKey(), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	var utxos []*Utxo
+	for i, address := range addresses {
+		pkScript, err := txscript.PayToAddrScript(address)
+		require.NoError(t, err)
+		utxos = append(utxos, &Utxo{TxHash: Hash{byte(i + 1)}, Index: uint32(i), Value: 100000, PkScript: pkScript})
+	}
+	return utxos
+}
+
+func TestSignInputs(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	utxos := keyUtxos(t, key)
+	var types []inputType
+	for _, utxo := range utxos {
+		types = append(types, classifyInput(utxo.PkScript))
+	}
+	assert.Equal(t, []inputType{inputP2TR, inputP2WPKH, inputP2SHP2WPKH, inputP2PKH}, types)
+
+	tx := wire.NewMsgTx(2)
+	for _, utxo := range utxos {
+		outpoint := utxo.OutPoint()
+		tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(390000, utxos[0].PkScript))
+
+	mocked := tx.Copy()
+	for i, utxo := range utxos {
+		require.NoError(t, mockSignInput(mocked.TxIn[i], utxo.PkScript))
+	}
+	_, err = signCommitTx(singleKey{key}, utxos, tx)
+	require.NoError(t, err)
+
+	prevOuts := UtxoList(utxos)
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+	for i, utxo := range utxos {
+		engine, err := txscript.NewEngine(utxo.PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, utxo.Value, prevOuts)
+		require.NoError(t, err)
+		assert.NoError(t, engine.Execute(), "input %d %s", i, types[i])
+
+		// a DER signature can be a byte or two shorter than the placeholder
+		in, mock := tx.TxIn[i], mocked.TxIn[i]
+		assert.InDelta(t, len(mock.SignatureScript), len(in.SignatureScript), 2, "input %d %s", i, types[i])
+		assert.InDelta(t, mock.Witness.SerializeSize(), in.Witness.SerializeSize(), 2, "input %d %s", i, types[i])
+		assert.GreaterOrEqual(t, len(mock.SignatureScript), len(in.SignatureScript))
+		assert.GreaterOrEqual(t, mock.Witness.SerializeSize(), in.Witness.SerializeSize())
+	}
+	signed := mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+	estimate := mempool.GetTxVirtualSize(btcutil.NewTx(mocked))
+	assert.GreaterOrEqual(t, estimate, signed)
+	assert.LessOrEqual(t, estimate-signed, int64(3))
+}
+
+func TestSignInputOtherKey(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	other, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	utxos := keyUtxos(t, key)
+	tx := wire.NewMsgTx(2)
+	outpoint := utxos[1].OutPoint()
+	tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, utxos[1].PkScript))
+	_, err = signCommitTx(singleKey{other}, utxos[1:2], tx)
+	assert.ErrorContains(t, err, "no key for script")
+}
+
+func TestUtxoOutPoint(t *testing.T) {
+	utxo := &Utxo{TxHash: HexToHash("6fb976ab49dcec017f1e201e84395983204ae1a7c2abf7ced0a85d692e442799"), Index: 1, Value: 546}
+	before := utxo.TxHash
+	outpoint := utxo.OutPoint()
+	assert.Equal(t, "6fb976ab49dcec017f1e201e84395983204ae1a7c2abf7ced0a85d692e442799:1", outpoint.String())
+	// neither call reverses TxHash in place
+	assert.Equal(t, before, utxo.TxHash)
+	list := UtxoList{utxo}
+	assert.NotNil(t, list.FetchPrevOutput(outpoint))
+	assert.NotNil(t, list.FetchPrevOutput(outpoint))
+	assert.Equal(t, before, utxo.TxHash)
+}
+
+func TestTapscriptWitnessKeepsKey(t *testing.T) {
+	// only a key with an odd y is negated by schnorr.Sign
+	var key *btcec.PrivateKey
+	for key == nil || key.PubKey().SerializeCompressed()[0] != 3 {
+		var err error
+		key, err = btcec.NewPrivateKey()
+		require.NoError(t, err)
+	}
+	before := key.Serialize()
+	tree, err := NewTapTree(key.PubKey(), []byte{txscript.OP_TRUE})
+	require.NoError(t, err)
+	pkScript, err := tree.PkScript()
+	require.NoError(t, err)
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: [32]byte{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, pkScript))
+	prevOuts := txscript.NewCannedPrevOutputFetcher(pkScript, 100000)
+	_, err = tapscriptWitness(key, tx, 0, prevOuts, txscript.NewTxSigHashes(tx, prevOuts), tree, 0)
+	require.NoError(t, err)
+	assert.Equal(t, before, key.Serialize())
+}
@@ -1,64 +1,31 @@
 package main
 
 import (
-	"bytes"
-	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
-	"strings"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
 )
 
+// CreateInscriptionScript is the leaf script of an inscription of fileBytes,
+// with inscriptionAddData pushed and dropped before the envelope.
 func CreateInscriptionScript(pk *btcec.PublicKey, contentType string, fileBytes []byte, inscriptionAddData []byte) ([]byte, error) {
-	builder := txscript.NewScriptBuilder()
-	//push pubkey
+	ins := &Inscription{ContentType: contentType, Body: fileBytes}
+	if len(inscriptionAddData) == 0 {
+		return ins.Script(pk), nil
+	}
 	pk32 := schnorr.SerializePubKey(pk)
 	log.Printf("put pubkey:%x to tapScript", pk32)
-	builder.AddData(pk32)
-	builder.AddOp(txscript.OP_CHECKSIG)
-	//Ordinals script
-	if len(inscriptionAddData) > 0 {
-		builder.AddData(inscriptionAddData)
-		builder.AddOp(txscript.OP_DROP)
-	}
-	builder.AddOp(txscript.OP_FALSE)
-	builder.AddOp(txscript.OP_IF)
-	builder.AddData([]byte("ord"))
-	builder.AddOp(txscript.OP_DATA_1) //??
-	builder.AddOp(txscript.OP_DATA_1) //??
-	builder.AddData([]byte(contentType))
-	builder.AddOp(txscript.OP_0)
-	data, err := builder.Script()
-	if err != nil {
-		return nil, err
-	}
-	splitLen := 520
-	point := 0
-	for {
-		builder = txscript.NewScriptBuilder()
-		if point+splitLen > len(fileBytes) {
-			builder.AddData(fileBytes[point:])
-			data1, err1 := builder.Script()
-			if err1 != nil {
-				return nil, err1
-			}
-			data = append(data, data1...)
-			break
-		}
-		builder.AddData(fileBytes[point : point+splitLen])
-		data1, err1 := builder.Script()
-		if err1 != nil {
-			return nil, err1
-		}
-		data = append(data, data1...)
-		point += splitLen
-	}
-	data = append(data, txscript.OP_ENDIF)
-	return data, err
+	script := appendPush(nil, pk32)
+	script = append(script, txscript.OP_CHECKSIG)
+	script = appendPush(script, inscriptionAddData)
+	script = append(script, txscript.OP_DROP)
+	return append(script, ins.Envelope()...), nil
 }
 
 func CreateCommitmentScript(pk *btcec.PublicKey, commitment []byte) ([]byte, error) {
@@ -75,6 +42,56 @@ func CreateCommitmentScript(pk *btcec.PublicKey, commitment []byte) ([]byte, err
 	builder.AddOp(txscript.OP_ENDIF)
 	return builder.Script()
 }
+
+// CreateRecoveryScript is a leaf that pk can spend once the commit output is
+// delay blocks deep, to take the funds back without revealing.
+func CreateRecoveryScript(pk *btcec.PublicKey, delay uint32) ([]byte, error) {
+	if delay == 0 || delay > wire.SequenceLockTimeMask {
+		return nil, fmt.Errorf("recovery delay must be between 1 and %d blocks", wire.SequenceLockTimeMask)
+	}
+	builder := txscript.NewScriptBuilder()
+	builder.AddInt64(int64(delay))
+	builder.AddOp(txscript.OP_CHECKSEQUENCEVERIFY)
+	builder.AddOp(txscript.OP_DROP)
+	builder.AddData(schnorr.SerializePubKey(pk))
+	builder.AddOp(txscript.OP_CHECKSIG)
+	return builder.Script()
+}
+
+// recoveryDelay is the delay of a leaf of CreateRecoveryScript.
+func recoveryDelay(script []byte) (uint32, error) {
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	if !tokenizer.Next() {
+		return 0, errors.New("empty recovery script")
+	}
+	delay := uint32(0)
+	switch op, data := tokenizer.Opcode(), tokenizer.Data(); {
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		delay = uint32(op-txscript.OP_1) + 1
+	case len(data) > 0 && len(data) <= 4 && data[len(data)-1]&0x80 == 0:
+		for i, b := range data {
+			delay |= uint32(b) << (8 * i)
+		}
+	default:
+		return 0, errors.New("recovery script does not start with its delay")
+	}
+	if !tokenizer.Next() || tokenizer.Opcode() != txscript.OP_CHECKSEQUENCEVERIFY {
+		return 0, errors.New("recovery script does not check the sequence")
+	}
+	return delay, nil
+}
+
+// CreateEtchingScript commits to r: in the rune field of the envelope of logo,
+// as ord etches with an inscription, or else in a bare push.
+func CreateEtchingScript(pk *btcec.PublicKey, r runestone.Rune, logo *Inscription) ([]byte, error) {
+	if logo == nil {
+		return CreateCommitmentScript(pk, r.Commitment())
+	}
+	ins := *logo
+	ins.Rune = &r
+	return ins.Script(pk), nil
+}
+
 func IsTapScript(witness wire.TxWitness) bool {
 	if len(witness) != 3 {
 		return false
@@ -86,62 +103,30 @@ func IsTapScript(witness wire.TxWitness) bool {
 	return false
 }
 
+// GetOrdinalsContent returns the content type and body of the first envelope
+// in tapScript.
 func GetOrdinalsContent(tapScript []byte) (mime string, content []byte, err error) {
-	scriptStr, err := txscript.DisasmString(tapScript)
+	envelopes, err := ParseTapscriptEnvelopes(tapScript, 0)
 	if err != nil {
 		return "", nil, err
 	}
-	start := false
-	scriptStrArray := strings.Split(scriptStr, " ")
-	contentHex := ""
-	for i := 0; i < len(scriptStrArray); i++ {
-		if scriptStrArray[i] == "6f7264" { // 6f7264 ==ord
-			start = true
-			mimeBytes, _ := hex.DecodeString(scriptStrArray[i+2])
-			mime = string(mimeBytes)
-			i = i + 4
-		}
-		if i < len(scriptStrArray) {
-			if start {
-				contentHex = contentHex + scriptStrArray[i]
-			}
-			if scriptStrArray[i] == "OP_ENDIF" {
-				break
-			}
-		}
+	if len(envelopes) == 0 {
+		return "", nil, ErrNoInscription
 	}
-	contentBytes, _ := hex.DecodeString(contentHex)
-	return mime, contentBytes, nil
+	return string(envelopes[0].ContentType), envelopes[0].Body, nil
 }
 
-var ordiBytes []byte
-
-func init() {
-	builder := txscript.NewScriptBuilder()
-	builder.AddOp(txscript.OP_FALSE)
-	builder.AddOp(txscript.OP_IF)
-	builder.AddData([]byte("ord"))
-	builder.AddOp(txscript.OP_DATA_1)
-	ordiBytes, _ = builder.Script()
-}
 func IsOrdinalsScript(script []byte) bool {
-	if bytes.Contains(script, ordiBytes) && script[len(script)-1] == txscript.OP_ENDIF {
-		return true
-	}
-	return false
+	envelopes, err := ParseTapscriptEnvelopes(script, 0)
+	return err == nil && len(envelopes) > 0
 }
 
+var ErrNoInscription = errors.New("no ordinals script found")
+
 func GetInscriptionContent(tx *wire.MsgTx) (contentType string, content []byte, err error) {
-	for _, txIn := range tx.TxIn {
-		if IsTapScript(txIn.Witness) {
-			if IsOrdinalsScript(txIn.Witness[1]) {
-				contentType, data, err := GetOrdinalsContent(txIn.Witness[1])
-				if err != nil {
-					return "", nil, err
-				}
-				return contentType, data, nil
-			}
-		}
+	envelopes := ParseEnvelopes(tx)
+	if len(envelopes) == 0 {
+		return "", nil, ErrNoInscription
 	}
-	return "", nil, errors.New("no ordinals script found")
+	return string(envelopes[0].ContentType), envelopes[0].Body, nil
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -19,17 +18,14 @@ type Utxo struct {
 	Ancestorcount int64 //算上祖父共有多少笔未确认， 比如：25
 }
 
+// OutPoint converts TxHash, which is in display order, to the internal byte
+// order of wire.OutPoint. TxHash itself is left untouched.
 func (u *Utxo) OutPoint() wire.OutPoint {
-	hashBytes := reverseBytes(u.TxHash[:])
-
-	h, err := chainhash.NewHash(hashBytes)
-	if err != nil {
-		p.Println("Error converting TxHash:", err)
-		return wire.OutPoint{}
-	}
+	hash := u.TxHash
+	reverseBytes(hash[:])
 
 	return wire.OutPoint{
-		Hash:  *h,
+		Hash:  chainhash.Hash(hash),
 		Index: u.Index,
 	}
 }
@@ -52,7 +48,7 @@ func (l UtxoList) Add(utxo *Utxo) UtxoList {
 }
 func (l UtxoList) FetchPrevOutput(o wire.OutPoint) *wire.TxOut {
 	for _, utxo := range l {
-		if bytes.Equal(utxo.TxHash[:], o.Hash[:]) && utxo.Index == o.Index {
+		if utxo.OutPoint() == o {
 			return wire.NewTxOut(utxo.Value, utxo.PkScript)
 		}
 	}
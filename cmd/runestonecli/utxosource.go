@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// minUtxoValue is the largest output the mint leaves alone; smaller ones may
+// carry runes or inscriptions.
+const minUtxoValue = 10001
+
+// UtxoSource finds the spendable outputs of the mint addresses and sends
+// transactions, either through the watch-only wallet of the local node or
+// through an Esplora api alone.
+type UtxoSource interface {
+	// GetUtxos returns the outputs of addresses with their confirmations and,
+	// if unconfirmed, the fees, size and count of their unconfirmed ancestors
+	// including their own transaction.
+	GetUtxos(addresses ...string) ([]*Utxo, error)
+	// GetTxFee returns the fee of a transaction and whether it is confirmed.
+	GetTxFee(txid string) (int64, bool, error)
+	// GetTxInputs returns the outputs spent by a transaction, to replace it.
+	GetTxInputs(txid string) ([]*Utxo, error)
+	GetRawTx(hash chainhash.Hash) (*wire.MsgTx, error)
+	SendTx(tx []byte) (string, error)
+	GetBlockHeight() (uint64, error)
+}
+
+// AddressLister lists what an address holds: every unspent output, the small
+// ones GetUtxos leaves out included, and its confirmed balance in sats.
+type AddressLister interface {
+	ListOutputs(address string) ([]*Utxo, error)
+	GetBalance(address string) (uint64, error)
+}
+
+// nodeUtxoSource uses the watch-only wallet WalletName of the local node.
+type nodeUtxoSource struct{}
+
+func (nodeUtxoSource) GetUtxos(addresses ...string) ([]*Utxo, error) {
+	return getUtxos(addresses...)
+}
+
+func (nodeUtxoSource) GetTxFee(txid string) (int64, bool, error) {
+	tx, err := gettransaction(txid)
+	if err != nil {
+		return 0, false, err
+	}
+	confirmations, _ := tx["confirmations"].(float64)
+	fee, ok := tx["fee"].(float64)
+	if !ok {
+		return 0, false, errors.New("gettransaction returned no fee")
+	}
+	return int64(math.Abs(fee * 1e8)), confirmations != 0, nil
+}
+
+func (nodeUtxoSource) GetTxInputs(txid string) ([]*Utxo, error) {
+	return returnReplaceTxUtxos(txid)
+}
+
+func (nodeUtxoSource) GetRawTx(hash chainhash.Hash) (*wire.MsgTx, error) {
+	return rpcPrevTx(hash)
+}
+
+func (nodeUtxoSource) SendTx(tx []byte) (string, error) {
+	return SendTx(tx)
+}
+
+func (nodeUtxoSource) GetBlockHeight() (uint64, error) {
+	return getblockcount()
+}
+
+// ListOutputs only finds the outputs of addresses in the watch-only wallet.
+func (nodeUtxoSource) ListOutputs(address string) ([]*Utxo, error) {
+	return listUnspent(0, address)
+}
+
+func (s nodeUtxoSource) GetBalance(address string) (uint64, error) {
+	utxos, err := s.ListOutputs(address)
+	if err != nil {
+		return 0, err
+	}
+	balance := uint64(0)
+	for _, utxo := range utxos {
+		if utxo.Confirmations > 0 {
+			balance += uint64(utxo.Value)
+		}
+	}
+	return balance, nil
+}
+
+// esploraUtxoSource needs no node: it asks the Esplora api at RpcUrl and walks
+// the graph of unconfirmed transactions for the ancestor data the node's
+// listunspent would return.
+type esploraUtxoSource struct {
+	connector *MempoolConnector
+}
+
+func (s esploraUtxoSource) GetUtxos(addresses ...string) ([]*Utxo, error) {
+	txs := map[string]*txResponse{}
+	var utxos []*Utxo
+	for _, address := range addresses {
+		found, err := s.connector.GetUtxos(address)
+		if err != nil {
+			return nil, err
+		}
+		for _, utxo := range found {
+			if utxo.Value <= minUtxoValue {
+				continue
+			}
+			if utxo.Confirmations == 0 {
+				ancestors := map[string]*txResponse{}
+				if err := s.ancestors(utxo.TxHash.String(), txs, ancestors); err != nil {
+					return nil, err
+				}
+				for _, tx := range ancestors {
+					utxo.Ancestorfees += int64(tx.Fee)
+					utxo.Ancestorsize += int64((tx.Weight + 3) / 4)
+				}
+				utxo.Ancestorcount = int64(len(ancestors))
+			}
+			utxos = append(utxos, utxo)
+		}
+	}
+	return utxos, nil
+}
+
+// ancestors adds txid and its unconfirmed ancestors to found. txs caches the
+// transactions fetched during one GetUtxos.
+func (s esploraUtxoSource) ancestors(txid string, txs, found map[string]*txResponse) error {
+	if _, ok := found[txid]; ok {
+		return nil
+	}
+	tx, ok := txs[txid]
+	if !ok {
+		var err error
+		if tx, err = s.connector.GetTx(txid); err != nil {
+			return err
+		}
+		txs[txid] = tx
+	}
+	if tx.Status.Confirmed {
+		return nil
+	}
+	found[txid] = tx
+	for _, in := range tx.Vin {
+		if err := s.ancestors(in.Txid, txs, found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s esploraUtxoSource) GetTxFee(txid string) (int64, bool, error) {
+	tx, err := s.connector.GetTx(txid)
+	if err != nil {
+		return 0, false, err
+	}
+	return int64(tx.Fee), tx.Status.Confirmed, nil
+}
+
+func (s esploraUtxoSource) GetTxInputs(txid string) ([]*Utxo, error) {
+	tx, err := s.connector.GetTx(txid)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]*Utxo, len(tx.Vin))
+	for i, in := range tx.Vin {
+		if in.Prevout == nil {
+			return nil, errors.New("esplora returned no prevout")
+		}
+		pkScript, err := hex.DecodeString(in.Prevout.ScriptPubKey)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = &Utxo{
+			TxHash:   HexToHash(in.Txid),
+			Index:    in.Vout,
+			Value:    in.Prevout.Value,
+			PkScript: pkScript,
+		}
+	}
+	return inputs, nil
+}
+
+func (s esploraUtxoSource) GetRawTx(hash chainhash.Hash) (*wire.MsgTx, error) {
+	return s.connector.GetRawTxByHash(hash.String())
+}
+
+func (s esploraUtxoSource) SendTx(raw []byte) (string, error) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return "", err
+	}
+	hash, err := s.connector.SendRawTransaction(tx, false)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+func (s esploraUtxoSource) GetBlockHeight() (uint64, error) {
+	return s.connector.GetBlockHeight()
+}
+
+func (s esploraUtxoSource) ListOutputs(address string) ([]*Utxo, error) {
+	return s.connector.GetUtxos(address)
+}
+
+func (s esploraUtxoSource) GetBalance(address string) (uint64, error) {
+	return s.connector.GetBalance(address)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTxid(c string) string {
+	return strings.Repeat(c, 64)
+}
+
+// esploraServer serves paths from responses and counts the requests of each.
+func esploraServer(t *testing.T, responses map[string]string) (esploraUtxoSource, map[string]int) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return esploraUtxoSource{NewMempoolConnector(Config{Network: "regtest", RpcUrl: server.URL})}, requests
+}
+
+func esploraTx(txid string, fee, weight int, confirmed bool, parents ...string) string {
+	var vin []string
+	for _, parent := range parents {
+		vin = append(vin, fmt.Sprintf(`{"txid":"%s","vout":0,"prevout":{"scriptpubkey":"51","value":100000}}`, parent))
+	}
+	status := `{"confirmed":false}`
+	if confirmed {
+		status = `{"confirmed":true,"block_height":90}`
+	}
+	return fmt.Sprintf(`{"txid":"%s","weight":%d,"fee":%d,"vin":[%s],"status":%s}`, txid, weight, fee, strings.Join(vin, ","), status)
+}
+
+func TestEsploraGetUtxos(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+
+	// d spends b and c, which both spend the unconfirmed a; a spends the
+	// confirmed e
+	a, b, c, d, e := testTxid("a"), testTxid("b"), testTxid("c"), testTxid("d"), testTxid("e")
+	source, requests := esploraServer(t, map[string]string{
+		"/blocks/tip/height": "100",
+		"/address/" + address.EncodeAddress() + "/utxo": fmt.Sprintf(`[`+
+			`{"txid":"%s","vout":1,"value":50000,"status":{"confirmed":true,"block_height":95}},`+
+			`{"txid":"%s","vout":2,"value":5000,"status":{"confirmed":true,"block_height":95}},`+
+			`{"txid":"%s","vout":0,"value":40000,"status":{"confirmed":false}},`+
+			`{"txid":"%s","vout":1,"value":30000,"status":{"confirmed":false}}]`, e, e, d, d),
+		"/tx/" + a: esploraTx(a, 1000, 800, false, e),
+		"/tx/" + b: esploraTx(b, 200, 441, false, a),
+		"/tx/" + c: esploraTx(c, 100, 400, false, a),
+		"/tx/" + d: esploraTx(d, 300, 600, false, b, c),
+		"/tx/" + e: esploraTx(e, 500, 500, true),
+	})
+
+	utxos, err := source.GetUtxos(address.EncodeAddress())
+	require.NoError(t, err)
+	// the output of 5000 sat may carry runes or inscriptions
+	require.Len(t, utxos, 3)
+
+	confirmed := utxos[0]
+	assert.Equal(t, HexToHash(e), confirmed.TxHash)
+	assert.Equal(t, uint32(1), confirmed.Index)
+	assert.Equal(t, int64(6), confirmed.Confirmations)
+	assert.Zero(t, confirmed.Ancestorcount)
+
+	// a is counted once although both b and c spend it, and e is confirmed
+	for _, utxo := range utxos[1:] {
+		assert.Equal(t, HexToHash(d), utxo.TxHash)
+		assert.Zero(t, utxo.Confirmations)
+		assert.Equal(t, int64(4), utxo.Ancestorcount)
+		assert.Equal(t, int64(1600), utxo.Ancestorfees)
+		assert.Equal(t, int64(150+111+100+200), utxo.Ancestorsize)
+		assert.Equal(t, address.ScriptAddress(), utxo.PkScript[2:])
+	}
+	// every transaction is fetched once for both outputs of d
+	for _, txid := range []string{a, b, c, d, e} {
+		assert.Equal(t, 1, requests["/tx/"+txid], txid)
+	}
+}
+
+func TestEsploraGetUtxosMissingParent(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	a, b := testTxid("a"), testTxid("b")
+	source, _ := esploraServer(t, map[string]string{
+		"/address/" + address.EncodeAddress() + "/utxo": fmt.Sprintf(`[{"txid":"%s","vout":0,"value":40000,"status":{"confirmed":false}}]`, b),
+		"/tx/" + b: esploraTx(b, 300, 600, false, a),
+	})
+	_, err = source.GetUtxos(address.EncodeAddress())
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestEsploraTxInputs(t *testing.T) {
+	a, b := testTxid("a"), "0100000000000000000000000000000000000000000000000000000000000002"
+	source, _ := esploraServer(t, map[string]string{
+		"/tx/" + a: esploraTx(a, 300, 600, true, b),
+		"/tx/" + b: `{"txid":"` + b + `","fee":200,"vin":[{"txid":"` + a + `","vout":0}],"status":{"confirmed":false}}`,
+	})
+	fee, confirmed, err := source.GetTxFee(a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), fee)
+	assert.True(t, confirmed)
+
+	inputs, err := source.GetTxInputs(a)
+	require.NoError(t, err)
+	require.Len(t, inputs, 1)
+	assert.Equal(t, b, inputs[0].TxHash.String())
+	assert.Equal(t, b+":0", inputs[0].OutPoint().String())
+	assert.Equal(t, int64(100000), inputs[0].Value)
+	assert.Equal(t, []byte{0x51}, inputs[0].PkScript)
+
+	_, err = source.GetTxInputs(b)
+	assert.ErrorContains(t, err, "no prevout")
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+)
+
+const (
+	// minRelayFeeRate is the default minimum relay fee rate of the node, in
+	// sat/vB.
+	minRelayFeeRate = int64(mempool.DefaultMinRelayTxFee / 1000)
+	// maxFeeRate is the default maxfeerate of sendrawtransaction, 0.1 BTC/kvB,
+	// in sat/vB.
+	maxFeeRate = int64(10000)
+)
+
+// VerifyOptions is what VerifyTx checks a signed transaction against.
+type VerifyOptions struct {
+	PrevOuts txscript.PrevOutputFetcher // the outputs spent by the inputs
+	// FeeRate is the fee rate the transaction was built for in sat/vB. It must
+	// pay at least that and the minimum relay fee rate.
+	FeeRate int64
+	// Runestone is the OP_RETURN script of the runestone the transaction must
+	// carry, nil if it must carry none.
+	Runestone []byte
+}
+
+// ScriptError is an input that does not spend its output.
+type ScriptError struct {
+	Input int
+	Err   error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("input %d: %s", e.Input, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// FeeRateError is a fee out of policy: below Limit, the fee the fee rate the
+// transaction was built for or the relay minimum requires, or above Limit,
+// the fee the node refuses to send.
+type FeeRateError struct {
+	Fee   int64
+	Vsize int64
+	Limit int64
+}
+
+func (e *FeeRateError) Error() string {
+	if e.Fee < e.Limit {
+		return fmt.Sprintf("fee %d sat for %d vB is below %d sat", e.Fee, e.Vsize, e.Limit)
+	}
+	return fmt.Sprintf("fee %d sat for %d vB is above the maximum %d sat", e.Fee, e.Vsize, e.Limit)
+}
+
+// ArtifactError is a runestone other than the one intended: a cenotaph, a
+// missing or unexpected runestone, or different fields.
+type ArtifactError struct {
+	Want *runestone.Runestone // nil if the transaction must carry none
+	Got  *runestone.Artifact  // nil if it carries none
+}
+
+func (e *ArtifactError) Error() string {
+	switch {
+	case e.Got != nil && e.Got.Cenotaph != nil:
+		flaw := "unknown flaw"
+		if e.Got.Cenotaph.Flaw != nil {
+			flaw = e.Got.Cenotaph.Flaw.String()
+		}
+		return "the runestone is a cenotaph, its runes would be burned: " + flaw
+	case e.Got == nil:
+		return "the runestone is missing"
+	case e.Want == nil:
+		return "the transaction carries an unexpected runestone"
+	}
+	return "the runestone differs from the one intended"
+}
+
+// isVerifyError tells whether err is one of the errors of VerifyTx.
+func isVerifyError(err error) bool {
+	var scriptErr *ScriptError
+	var feeRateErr *FeeRateError
+	var artifactErr *ArtifactError
+	return errors.As(err, &scriptErr) || errors.As(err, &feeRateErr) || errors.As(err, &artifactErr)
+}
+
+// VerifyTx runs every input of tx against the output it spends, checks its fee
+// against policy and that it carries the intended runestone. The errors are
+// *ScriptError, *FeeRateError or *ArtifactError.
+func VerifyTx(tx *wire.MsgTx, opts VerifyOptions) error {
+	// the taproot sighashes commit to every spent output
+	for i, in := range tx.TxIn {
+		if opts.PrevOuts.FetchPrevOutput(in.PreviousOutPoint) == nil {
+			return &ScriptError{Input: i, Err: fmt.Errorf("spent output %s is unknown", in.PreviousOutPoint)}
+		}
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, opts.PrevOuts)
+	fee := int64(0)
+	for i, in := range tx.TxIn {
+		prevOut := opts.PrevOuts.FetchPrevOutput(in.PreviousOutPoint)
+		engine, err := txscript.NewEngine(prevOut.PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, opts.PrevOuts)
+		if err == nil {
+			err = engine.Execute()
+		}
+		if err != nil {
+			return &ScriptError{Input: i, Err: err}
+		}
+		fee += prevOut.Value
+	}
+	for _, out := range tx.TxOut {
+		fee -= out.Value
+	}
+
+	weight := blockchain.GetTransactionWeight(btcutil.NewTx(tx))
+	vsize := (weight + 3) / 4
+	if minimum := vbytesFee(weight, max(opts.FeeRate, minRelayFeeRate)); fee < minimum {
+		return &FeeRateError{Fee: fee, Vsize: vsize, Limit: minimum}
+	}
+	if maximum := vsize * maxFeeRate; fee > maximum {
+		return &FeeRateError{Fee: fee, Vsize: vsize, Limit: maximum}
+	}
+
+	return verifyRunestone(tx, opts.Runestone)
+}
+
+// VerifyRawTx is VerifyTx for a serialized transaction.
+func VerifyRawTx(raw []byte, opts VerifyOptions) error {
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return err
+	}
+	return VerifyTx(tx, opts)
+}
+
+func verifyRunestone(tx *wire.MsgTx, script []byte) error {
+	got, err := decipherRunestone(tx)
+	if err != nil {
+		return err
+	}
+	if got != nil && got.Cenotaph != nil {
+		return &ArtifactError{Got: got}
+	}
+	var want *runestone.Runestone
+	if script != nil {
+		// decipher the intended runestone against the outputs of tx, which
+		// its edicts and pointer refer to
+		intended := &wire.MsgTx{TxOut: append([]*wire.TxOut{}, tx.TxOut...)}
+		replaced := false
+		if current := runestone.RunestoneScript(tx); current != nil {
+			for i, out := range intended.TxOut {
+				if bytes.Equal(out.PkScript, current) {
+					intended.TxOut[i], replaced = wire.NewTxOut(0, script), true
+					break
+				}
+			}
+		}
+		if !replaced {
+			intended.TxOut = append(intended.TxOut, wire.NewTxOut(0, script))
+		}
+		artifact, err := decipherRunestone(intended)
+		if err != nil {
+			return err
+		}
+		if artifact == nil || artifact.Runestone == nil {
+			return errors.New("the intended runestone is not valid")
+		}
+		want = artifact.Runestone
+	}
+	if (got == nil) != (want == nil) || (got != nil && !reflect.DeepEqual(got.Runestone, want)) {
+		return &ArtifactError{Want: want, Got: got}
+	}
+	return nil
+}
+
+// decipherRunestone returns the artifact of tx, nil if it has no runestone
+// output.
+func decipherRunestone(tx *wire.MsgTx) (*runestone.Artifact, error) {
+	if !runestone.HasRunestoneOutput(tx) {
+		return nil, nil
+	}
+	artifact, err := (&runestone.Runestone{}).Decipher(tx)
+	if artifact != nil {
+		return artifact, nil
+	}
+	return nil, err
+}
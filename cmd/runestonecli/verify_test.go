@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/bxelab/runestone"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedTestTx spends a 0.1 BTC key path output to the same key, paying
+// fee, with runeData as the first output if not nil.
+func signedTestTx(t *testing.T, runeData []byte, fee int64) (*wire.MsgTx, *txscript.MultiPrevOutFetcher) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+
+	outpoint := wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	prevOuts.AddPrevOut(outpoint, wire.NewTxOut(10000000, pkScript))
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+	if runeData != nil {
+		tx.AddTxOut(wire.NewTxOut(0, runeData))
+	}
+	tx.AddTxOut(wire.NewTxOut(10000000-fee, pkScript))
+	witness, err := txscript.TaprootWitnessSignature(tx, txscript.NewTxSigHashes(tx, prevOuts), 0, 10000000, pkScript, txscript.SigHashDefault, key)
+	require.NoError(t, err)
+	tx.TxIn[0].Witness = witness
+	return tx, prevOuts
+}
+
+func testMintData(t *testing.T, r runestone.Runestone) []byte {
+	runeData, err := r.Encipher()
+	require.NoError(t, err)
+	return runeData
+}
+
+func TestVerifyTx(t *testing.T) {
+	id, err := runestone.NewRuneId(840000, 1)
+	require.NoError(t, err)
+	pointer := uint32(1)
+	runeData := testMintData(t, runestone.Runestone{Mint: id, Pointer: &pointer})
+	tx, prevOuts := signedTestTx(t, runeData, 2000)
+	assert.NoError(t, VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10, Runestone: runeData}))
+
+	var raw bytes.Buffer
+	require.NoError(t, tx.Serialize(&raw))
+	assert.NoError(t, VerifyRawTx(raw.Bytes(), VerifyOptions{PrevOuts: prevOuts, FeeRate: 10, Runestone: runeData}))
+
+	plain, plainPrevOuts := signedTestTx(t, nil, 2000)
+	assert.NoError(t, VerifyTx(plain, VerifyOptions{PrevOuts: plainPrevOuts, FeeRate: 10}))
+}
+
+func TestVerifyTxScriptError(t *testing.T) {
+	tx, prevOuts := signedTestTx(t, nil, 2000)
+	var scriptErr *ScriptError
+
+	tampered := tx.Copy()
+	tampered.TxOut[0].Value--
+	err := VerifyTx(tampered, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10})
+	require.True(t, errors.As(err, &scriptErr))
+	assert.Equal(t, 0, scriptErr.Input)
+
+	err = VerifyTx(tx, VerifyOptions{PrevOuts: txscript.NewMultiPrevOutFetcher(nil), FeeRate: 10})
+	require.True(t, errors.As(err, &scriptErr))
+	assert.ErrorContains(t, err, "is unknown")
+}
+
+func TestVerifyTxFeeRateError(t *testing.T) {
+	var feeErr *FeeRateError
+
+	tx, prevOuts := signedTestTx(t, nil, 200)
+	err := VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10})
+	require.True(t, errors.As(err, &feeErr))
+	assert.EqualValues(t, 200, feeErr.Fee)
+	assert.Greater(t, feeErr.Limit, feeErr.Fee)
+	assert.ErrorContains(t, err, "below")
+
+	// the relay minimum applies whatever the fee rate built for
+	tx, prevOuts = signedTestTx(t, nil, 50)
+	err = VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts})
+	require.True(t, errors.As(err, &feeErr))
+
+	tx, prevOuts = signedTestTx(t, nil, 5000000)
+	err = VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10})
+	require.True(t, errors.As(err, &feeErr))
+	assert.ErrorContains(t, err, "above the maximum")
+}
+
+func TestVerifyTxArtifactError(t *testing.T) {
+	id, err := runestone.NewRuneId(840000, 1)
+	require.NoError(t, err)
+	pointer := uint32(1)
+	runeData := testMintData(t, runestone.Runestone{Mint: id, Pointer: &pointer})
+	var artifactErr *ArtifactError
+
+	// an edict to an output the transaction does not have burns the runes
+	cenotaph := testMintData(t, runestone.Runestone{Edicts: []runestone.Edict{{ID: *id, Output: 5}}})
+	tx, prevOuts := signedTestTx(t, cenotaph, 2000)
+	err = VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10, Runestone: cenotaph})
+	require.True(t, errors.As(err, &artifactErr))
+	assert.ErrorContains(t, err, "cenotaph")
+
+	tx, prevOuts = signedTestTx(t, nil, 2000)
+	err = VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10, Runestone: runeData})
+	require.True(t, errors.As(err, &artifactErr))
+	assert.ErrorContains(t, err, "missing")
+
+	tx, prevOuts = signedTestTx(t, runeData, 2000)
+	err = VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10})
+	require.True(t, errors.As(err, &artifactErr))
+	assert.ErrorContains(t, err, "unexpected")
+
+	other, err := runestone.NewRuneId(840000, 2)
+	require.NoError(t, err)
+	err = VerifyTx(tx, VerifyOptions{PrevOuts: prevOuts, FeeRate: 10, Runestone: testMintData(t, runestone.Runestone{Mint: other, Pointer: &pointer})})
+	require.True(t, errors.As(err, &artifactErr))
+	assert.ErrorContains(t, err, "differs")
+}
+
+func TestVerifyEtchingReveal(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	address, err := getP2TRAddress(key.PubKey(), net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	utxo := []*Utxo{{Index: 0, Value: 100000, PkScript: pkScript}}
+	spaced, err := runestone.SpacedRuneFromString("VERIFIED•RUNE")
+	require.NoError(t, err)
+	runeData := testMintData(t, runestone.Runestone{Etching: &runestone.Etching{Rune: &spaced.Rune}})
+	txs, err := buildRuneEtchingRevealTxs(key.PubKey(), utxo, runeData, spaced.Rune, nil, 2, defaultRevealOutValue, net, address.EncodeAddress(), nil)
+	require.NoError(t, err)
+	commit, reveal, err := txs.sign(key, singleKey{key}, utxo)
+	require.NoError(t, err)
+	assert.NoError(t, VerifyRawTx(commit, VerifyOptions{PrevOuts: UtxoList(utxo), FeeRate: 2}))
+	assert.NoError(t, VerifyRawTx(reveal, VerifyOptions{PrevOuts: txs.prevOuts(), FeeRate: 2, Runestone: runeData}))
+}
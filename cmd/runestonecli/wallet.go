@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// walletCall calls method on the watch-only wallet and decodes its result
+// into result.
+func (c Config) walletCall(method string, params []interface{}, result interface{}) error {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      method,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(c.GetLocalRpcUrl()+"/wallet/"+c.walletName(), "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  interface{}     `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return err
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("RPC error: %v", reply.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// rescanProgressInterval is how often rescan prints its progress.
+const rescanProgressInterval = 10 * time.Second
+
+// rescan rescans the chain from height for transactions of the wallet's
+// addresses. rescanblockchain blocks until it is done, so the progress is
+// polled from getwalletinfo meanwhile.
+func (c Config) rescan(height int64) error {
+	p.Printf("Rescanning wallet %s from block %d, this can take a while...\n", c.walletName(), height)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(rescanProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			var info struct {
+				Scanning interface{} `json:"scanning"` // false, or the progress
+			}
+			if err := c.walletCall("getwalletinfo", nil, &info); err != nil {
+				continue
+			}
+			if scanning, ok := info.Scanning.(map[string]interface{}); ok {
+				progress, _ := scanning["progress"].(float64)
+				duration, _ := scanning["duration"].(float64)
+				p.Printf("Rescan progress: %.1f%% (%ds)\n", progress*100, int64(duration))
+			}
+		}
+	}()
+
+	var result struct {
+		StartHeight int64 `json:"start_height"`
+		StopHeight  int64 `json:"stop_height"`
+	}
+	if err := c.walletCall("rescanblockchain", []interface{}{height}, &result); err != nil {
+		return err
+	}
+	p.Printf("Rescanned blocks %d to %d\n", result.StartHeight, result.StopHeight)
+	return nil
+}
+
+// runRescan rescans the watch-only wallet from the height given as argument,
+// or from RescanFrom.
+func runRescan(args []string) {
+	fs := flag.NewFlagSet("rescan", flag.ExitOnError)
+	fs.Parse(args)
+	var err error
+	switch {
+	case fs.NArg() == 1:
+		var height int64
+		if height, err = strconv.ParseInt(fs.Arg(0), 10, 64); err == nil {
+			err = config.rescan(height)
+		}
+	case fs.NArg() == 0 && config.RescanFrom != nil:
+		err = config.rescan(*config.RescanFrom)
+	default:
+		err = errors.New("usage: rescan <height>, or set RescanFrom in config.yaml")
+	}
+	if err != nil {
+		p.Println(err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"github.com/btcsuite/btcd/wire"
+	"lukechampine.com/uint128"
+)
+
+// Explanation is the runestone or cenotaph of a transaction in readable form:
+// rune names are spaced and amounts are Piles wherever the divisibility of
+// the rune is known, raw integers otherwise.
+type Explanation struct {
+	Cenotaph bool                `json:"cenotaph"`
+	Flaw     string              `json:"flaw,omitempty"`
+	Etching  *EtchingExplanation `json:"etching,omitempty"`
+	Mint     *MintExplanation    `json:"mint,omitempty"`
+	Edicts   []EdictExplanation  `json:"edicts,omitempty"`
+	Pointer  *uint32             `json:"pointer,omitempty"`
+}
+
+// EtchingExplanation describes an etching. Rune is empty when the etching
+// leaves the name to be assigned by the index.
+type EtchingExplanation struct {
+	Rune         string            `json:"rune,omitempty"`
+	Symbol       string            `json:"symbol,omitempty"`
+	Divisibility uint8             `json:"divisibility"`
+	Premine      string            `json:"premine,omitempty"`
+	Terms        *TermsExplanation `json:"terms,omitempty"`
+	Turbo        bool              `json:"turbo,omitempty"`
+}
+
+type TermsExplanation struct {
+	Amount string     `json:"amount,omitempty"`
+	Cap    string     `json:"cap,omitempty"`
+	Height [2]*uint64 `json:"height"`
+	Offset [2]*uint64 `json:"offset"`
+}
+
+// MintExplanation names the minted rune and, if its terms are known, the
+// amount the mint receives.
+type MintExplanation struct {
+	ID     string `json:"id"`
+	Rune   string `json:"rune,omitempty"`
+	Amount string `json:"amount,omitempty"`
+}
+
+type EdictExplanation struct {
+	ID     string `json:"id"`
+	Rune   string `json:"rune,omitempty"`
+	Amount string `json:"amount"`
+	Output uint32 `json:"output"`
+}
+
+// Explain deciphers the runestone of tx. lookup returns the entries of runes
+// etched before tx, as Index.RuneEntry does, and may be nil. The result is nil
+// when tx has no runestone.
+func Explain(tx *wire.MsgTx, lookup func(RuneId) (*RuneEntry, bool)) (*Explanation, error) {
+	artifact, err := (&Runestone{}).Decipher(tx)
+	if artifact == nil {
+		if HasRunestoneOutput(tx) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	entry := func(id RuneId) *RuneEntry {
+		if lookup == nil {
+			return nil
+		}
+		if e, ok := lookup(id); ok {
+			return e
+		}
+		return nil
+	}
+	x := &Explanation{}
+	if c := artifact.Cenotaph; c != nil {
+		x.Cenotaph = true
+		if c.Flaw != nil {
+			x.Flaw = c.Flaw.String()
+		}
+		if c.Etching != nil {
+			x.Etching = &EtchingExplanation{Rune: c.Etching.String()}
+		}
+		if c.Mint != nil {
+			x.Mint = explainMint(*c.Mint, entry(*c.Mint))
+		}
+		return x, nil
+	}
+	r := artifact.Runestone
+	// the rune etched here, which edicts of id 0:0 refer to
+	var etched *RuneEntry
+	if e := r.Etching; e != nil {
+		etched = &RuneEntry{Symbol: e.Symbol, Terms: e.Terms}
+		if e.Divisibility != nil {
+			etched.Divisibility = *e.Divisibility
+		}
+		if e.Rune != nil {
+			etched.SpacedRune = SpacedRune{Rune: *e.Rune}
+			if e.Spacers != nil {
+				etched.SpacedRune.Spacers = *e.Spacers
+			}
+		}
+		x.Etching = &EtchingExplanation{
+			Divisibility: etched.Divisibility,
+			Turbo:        e.Turbo,
+		}
+		if e.Rune != nil {
+			x.Etching.Rune = etched.SpacedRune.String()
+		}
+		if e.Symbol != nil {
+			x.Etching.Symbol = string(*e.Symbol)
+		}
+		if e.Premine != nil {
+			x.Etching.Premine = etched.pile(*e.Premine).String()
+		}
+		if t := e.Terms; t != nil {
+			x.Etching.Terms = &TermsExplanation{Height: t.Height, Offset: t.Offset}
+			if t.Amount != nil {
+				x.Etching.Terms.Amount = etched.pile(*t.Amount).String()
+			}
+			if t.Cap != nil {
+				x.Etching.Terms.Cap = t.Cap.String()
+			}
+		}
+	}
+	if r.Mint != nil {
+		x.Mint = explainMint(*r.Mint, entry(*r.Mint))
+	}
+	for _, edict := range r.Edicts {
+		e := entry(edict.ID)
+		name := e.name()
+		if edict.ID == (RuneId{}) {
+			// without an etching the index ignores the edict, whose rune
+			// stays unknown
+			e, name = etched, ""
+			if x.Etching != nil {
+				name = x.Etching.Rune
+			}
+		}
+		x.Edicts = append(x.Edicts, EdictExplanation{
+			ID:     edict.ID.String(),
+			Rune:   name,
+			Amount: e.amount(edict.Amount),
+			Output: edict.Output,
+		})
+	}
+	x.Pointer = r.Pointer
+	return x, nil
+}
+
+func explainMint(id RuneId, e *RuneEntry) *MintExplanation {
+	m := &MintExplanation{ID: id.String(), Rune: e.name()}
+	if e != nil && e.Terms != nil && e.Terms.Amount != nil {
+		m.Amount = e.pile(*e.Terms.Amount).String()
+	}
+	return m
+}
+
+func (e *RuneEntry) pile(amount uint128.Uint128) Pile {
+	return Pile{Amount: amount, Divisibility: e.Divisibility, Symbol: e.Symbol}
+}
+
+// name and amount fall back to nothing and the raw integer for unknown runes.
+func (e *RuneEntry) name() string {
+	if e == nil {
+		return ""
+	}
+	return e.SpacedRune.String()
+}
+
+func (e *RuneEntry) amount(amount uint128.Uint128) string {
+	if e == nil {
+		return amount.String()
+	}
+	return e.pile(amount).String()
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainWithoutRunestone(t *testing.T) {
+	x, err := Explain(testTx(t, nil, 1), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, x)
+}
+
+func TestExplainEtching(t *testing.T) {
+	spaced, err := SpacedRuneFromString("HELLO•WORLD")
+	assert.NoError(t, err)
+	tx := testTx(t, &Runestone{
+		Etching: &Etching{
+			Rune:         &spaced.Rune,
+			Spacers:      Uint32P(spaced.Spacers),
+			Divisibility: Uint8P(2),
+			Premine:      Uint128PFrom64(12345),
+			Symbol:       CharP('$'),
+			Terms: &Terms{
+				Amount: Uint128PFrom64(100),
+				Cap:    Uint128PFrom64(1000),
+				Height: [2]*uint64{Uint64P(840000), nil},
+			},
+		},
+		Edicts:  []Edict{{Amount: i128(500), Output: 1}},
+		Pointer: Uint32P(2),
+	}, 2)
+
+	x, err := Explain(tx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Explanation{
+		Etching: &EtchingExplanation{
+			Rune:         "HELLO•WORLD",
+			Symbol:       "$",
+			Divisibility: 2,
+			Premine:      "123.45\u00a0$",
+			Terms: &TermsExplanation{
+				Amount: "1\u00a0$",
+				Cap:    "1000",
+				Height: [2]*uint64{Uint64P(840000), nil},
+			},
+		},
+		Edicts:  []EdictExplanation{{ID: "0:0", Rune: "HELLO•WORLD", Amount: "5\u00a0$", Output: 1}},
+		Pointer: Uint32P(2),
+	}, x)
+}
+
+func TestExplainEdictOfNoEtching(t *testing.T) {
+	tx := testTx(t, &Runestone{
+		Edicts: []Edict{{Amount: i128(500), Output: 1}},
+	}, 2)
+
+	x, err := Explain(tx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Explanation{
+		Edicts: []EdictExplanation{{ID: "0:0", Amount: "500", Output: 1}},
+	}, x)
+}
+
+func TestExplainMintAndEdictsOfIndexedRune(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	id, _ := etchTestRune(t, index, &Etching{
+		Rune:         RuneP64(1000),
+		Divisibility: Uint8P(1),
+		Terms:        &Terms{Amount: Uint128PFrom64(25), Cap: Uint128PFrom64(10)},
+	}, 1)
+	other := RuneId{Block: 1, Tx: 2}
+	tx := testTx(t, &Runestone{
+		Mint:   &id,
+		Edicts: []Edict{{ID: other, Amount: i128(7), Output: 1}, {ID: id, Amount: i128(15), Output: 1}},
+	}, 1)
+
+	x, err := Explain(tx, index.RuneEntry)
+	assert.NoError(t, err)
+	name := Rune{i128(1000)}.String()
+	assert.Equal(t, &Explanation{
+		Mint: &MintExplanation{ID: id.String(), Rune: name, Amount: "2.5\u00a0¤"},
+		Edicts: []EdictExplanation{
+			{ID: "1:2", Amount: "7", Output: 1},
+			{ID: id.String(), Rune: name, Amount: "1.5\u00a0¤", Output: 1},
+		},
+	}, x)
+}
+
+func TestExplainCenotaph(t *testing.T) {
+	tx := testTx(t, nil, 1)
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN, MAGIC_NUMBER, txscript.OP_VERIFY}))
+
+	x, err := Explain(tx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Explanation{Cenotaph: true, Flaw: Opcode.String()}, x)
+}
@@ -0,0 +1,305 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultSnapshotInterval is the number of batches a FileStore logs before it
+// writes a new snapshot.
+const DefaultSnapshotInterval = 1000
+
+const (
+	snapshotFile = "snapshot"
+	logFile      = "log"
+	opPut        = 0
+	opDelete     = 1
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+// FileStore is a Store kept in a directory with the standard library alone: a
+// snapshot of every key and an append-only log of the batches written since.
+// The whole store is held in memory. Write appends the batch to the log and
+// syncs it before it returns; a batch cut short by a crash is dropped when the
+// store is opened again. Every SnapshotInterval batches the snapshot is
+// rewritten and the log emptied.
+type FileStore struct {
+	SnapshotInterval int
+
+	mu     sync.Mutex
+	mem    *MemoryStore
+	dir    string
+	log    *os.File
+	logged int
+}
+
+// OpenFileStore opens the store in dir, creating it if it does not exist.
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &FileStore{SnapshotInterval: DefaultSnapshotInterval, mem: NewMemoryStore(), dir: dir}
+	if err := s.readSnapshot(); err != nil {
+		return nil, err
+	}
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	// replaying the log over a snapshot that already holds some of its
+	// batches is harmless: a batch only sets and deletes keys
+	good, err := readRecords(log, func(payload []byte) error {
+		batch, err := decodeBatch(payload)
+		if err != nil {
+			return err
+		}
+		s.mem.apply(batch)
+		s.logged++
+		return nil
+	})
+	if err == nil {
+		// drop a batch cut short by a crash
+		err = log.Truncate(good)
+	}
+	if err == nil {
+		_, err = log.Seek(good, io.SeekStart)
+	}
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	s.log = log
+	return s, nil
+}
+
+func (s *FileStore) readSnapshot() error {
+	f, err := os.Open(filepath.Join(s.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	good, err := readRecords(f, func(payload []byte) error {
+		batch, err := decodeBatch(payload)
+		if err != nil {
+			return err
+		}
+		s.mem.apply(batch)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if good != info.Size() {
+		// the snapshot is renamed into place once complete
+		return fmt.Errorf("snapshot: %w at offset %d", errCorruptRecord, good)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(key []byte) ([]byte, bool, error) {
+	return s.mem.Get(key)
+}
+
+func (s *FileStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return s.mem.Iterate(prefix, fn)
+}
+
+func (s *FileStore) Write(batch Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return os.ErrClosed
+	}
+	if _, err := s.log.Write(encodeRecord(encodeBatch(batch))); err != nil {
+		return err
+	}
+	if err := s.log.Sync(); err != nil {
+		return err
+	}
+	s.mem.apply(batch)
+	s.logged++
+	if s.SnapshotInterval > 0 && s.logged >= s.SnapshotInterval {
+		return s.snapshot()
+	}
+	return nil
+}
+
+// Snapshot writes every key to a new snapshot and empties the log.
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return os.ErrClosed
+	}
+	return s.snapshot()
+}
+
+func (s *FileStore) snapshot() error {
+	path := filepath.Join(s.dir, snapshotFile)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = s.mem.Iterate(nil, func(key, value []byte) error {
+		_, err := w.Write(encodeRecord(encodeBatch(Batch{{Key: key, Value: value}})))
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	syncDir(s.dir)
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.logged = 0
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
+
+// syncDir makes a rename in dir durable where the platform allows it.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// encodeRecord frames payload with its length and CRC-32.
+func encodeRecord(payload []byte) []byte {
+	record := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(record, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+// readRecords calls fn with the payload of every record of r up to the first
+// one cut short or corrupt, and returns the offset the good records end at.
+func readRecords(r io.Reader, fn func(payload []byte) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			return offset, nil
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header))
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return offset, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			return offset, nil
+		}
+		if err := fn(payload); err != nil {
+			return offset, err
+		}
+		offset += int64(len(header) + len(payload))
+	}
+}
+
+func encodeBatch(batch Batch) []byte {
+	var b []byte
+	for _, op := range batch {
+		if op.Delete {
+			b = append(b, opDelete)
+			b = binary.AppendUvarint(b, uint64(len(op.Key)))
+			b = append(b, op.Key...)
+			continue
+		}
+		b = append(b, opPut)
+		b = binary.AppendUvarint(b, uint64(len(op.Key)))
+		b = append(b, op.Key...)
+		b = binary.AppendUvarint(b, uint64(len(op.Value)))
+		b = append(b, op.Value...)
+	}
+	return b
+}
+
+func decodeBatch(b []byte) (Batch, error) {
+	var batch Batch
+	next := func() ([]byte, bool) {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || uint64(len(b)-size) < n {
+			return nil, false
+		}
+		data := b[size : size+int(n)]
+		b = b[size+int(n):]
+		return data, true
+	}
+	for len(b) > 0 {
+		kind := b[0]
+		b = b[1:]
+		key, ok := next()
+		if !ok {
+			return nil, errCorruptRecord
+		}
+		switch kind {
+		case opDelete:
+			batch.Delete(key)
+		case opPut:
+			value, ok := next()
+			if !ok {
+				return nil, errCorruptRecord
+			}
+			batch.Put(key, value)
+		default:
+			return nil, errCorruptRecord
+		}
+	}
+	return batch, nil
+}
@@ -0,0 +1,450 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"lukechampine.com/uint128"
+)
+
+// Balance is an amount of a single rune held by an output.
+type Balance struct {
+	ID     RuneId
+	Amount uint128.Uint128
+}
+
+// TxOutFetcher looks up a previous output together with the height of the
+// block that confirmed it. The index uses it to check that an etching commits
+// to its rune through a mature taproot input.
+type TxOutFetcher interface {
+	FetchTxOut(outpoint wire.OutPoint) (txOut *wire.TxOut, height uint64, err error)
+}
+
+var ErrBlockHeight = errors.New("block height is not the next height of the index")
+
+// ErrBlockParent is returned for a block that does not build on the last
+// indexed block, as happens when the chain reorganizes while the index syncs.
+// Reorg rolls the index back to the chain.
+var ErrBlockParent = errors.New("block does not build on the last indexed block")
+
+// Index tracks rune entries and outpoint balances block by block, following
+// the rules of ord's rune updater.
+//
+// Without a Fetcher, an etching is accepted as soon as one of its inputs
+// reveals the rune commitment in a tapscript; the taproot and maturity checks
+// are skipped.
+type Index struct {
+	Network wire.BitcoinNet
+	Fetcher TxOutFetcher
+
+	// MaxReorgDepth is the number of blocks the index keeps undo records
+	// for, the deepest reorg it can roll back.
+	MaxReorgDepth int
+
+	store    Store
+	pending  *blockUndo   // of the block being indexed
+	undos    []*blockUndo // of the last MaxReorgDepth blocks, oldest first
+	indexed  bool
+	height   uint64
+	hash     chainhash.Hash
+	number   uint64
+	runes    map[RuneId]*RuneEntry
+	ids      map[uint128.Uint128]RuneId
+	balances map[wire.OutPoint][]Balance
+}
+
+func NewIndex(network wire.BitcoinNet) *Index {
+	return &Index{
+		Network:       network,
+		MaxReorgDepth: DefaultMaxReorgDepth,
+		runes:         make(map[RuneId]*RuneEntry),
+		ids:           make(map[uint128.Uint128]RuneId),
+		balances:      make(map[wire.OutPoint][]Balance),
+	}
+}
+
+// Height returns the height and hash of the last indexed block.
+func (i *Index) Height() (uint64, chainhash.Hash, bool) {
+	return i.height, i.hash, i.indexed
+}
+
+// RuneEntry returns the entry of an etched rune.
+func (i *Index) RuneEntry(id RuneId) (*RuneEntry, bool) {
+	entry, ok := i.runes[id]
+	return entry, ok
+}
+
+// RuneId looks up the id of an etched rune by name.
+func (i *Index) RuneId(r Rune) (*RuneId, bool) {
+	id, ok := i.ids[r.Value]
+	if !ok {
+		return nil, false
+	}
+	return &id, true
+}
+
+// Balances returns the runes held by an unspent output.
+func (i *Index) Balances(outpoint wire.OutPoint) []Balance {
+	return i.balances[outpoint]
+}
+
+// IndexBlock applies every transaction of the block at height. Blocks must be
+// indexed in order, each building on the one before; the first block indexed
+// may be at any height. With a store
+// the changes of the block are written to it in one batch. After an error the
+// index is left at the block before.
+func (i *Index) IndexBlock(height uint64, block *wire.MsgBlock) error {
+	if i.indexed && height != i.height+1 {
+		return fmt.Errorf("%w: got %d, want %d", ErrBlockHeight, height, i.height+1)
+	}
+	if i.indexed && block.Header.PrevBlock != i.hash {
+		return fmt.Errorf("%w: block %s at %d builds on %s, not %s", ErrBlockParent, block.BlockHash(), height, block.Header.PrevBlock, i.hash)
+	}
+	undo := i.newBlockUndo(height)
+	i.pending = undo
+	defer func() { i.pending = nil }()
+	timestamp := uint64(block.Header.Timestamp.Unix())
+	for txIndex, tx := range block.Transactions {
+		if err := i.indexTx(height, timestamp, uint32(txIndex), tx); err != nil {
+			i.revert(undo)
+			return fmt.Errorf("tx %s: %w", tx.TxHash(), err)
+		}
+	}
+	i.indexed = true
+	i.height = height
+	i.hash = block.BlockHash()
+	undo.hash = i.hash
+
+	undos := i.undos
+	if i.MaxReorgDepth > 0 {
+		undos = append(undos[:len(undos):len(undos)], undo)
+	}
+	excess := max(len(undos)-max(i.MaxReorgDepth, 0), 0)
+	if i.store != nil {
+		if err := i.save(undo, undos[:excess]); err != nil {
+			i.revert(undo)
+			return err
+		}
+	}
+	i.undos = undos[excess:]
+	return nil
+}
+
+func (i *Index) indexTx(height, timestamp uint64, txIndex uint32, tx *wire.MsgTx) error {
+	artifact, _ := (&Runestone{}).Decipher(tx)
+	unallocated := i.unallocated(tx)
+	allocated := make([]map[RuneId]uint128.Uint128, len(tx.TxOut))
+	for n := range allocated {
+		allocated[n] = make(map[RuneId]uint128.Uint128)
+	}
+
+	var etchedId *RuneId
+	var etchedRune Rune
+	if artifact != nil {
+		if id := artifact.Mint(); id != nil {
+			if amount, ok := i.mint(*id, height); ok {
+				unallocated[*id] = unallocated[*id].Add(amount)
+			}
+		}
+		var err error
+		etchedId, etchedRune, err = i.etched(height, txIndex, tx, artifact)
+		if err != nil {
+			return err
+		}
+		if runestone := artifact.Runestone; runestone != nil {
+			if etchedId != nil && runestone.Etching.Premine != nil {
+				unallocated[*etchedId] = unallocated[*etchedId].Add(*runestone.Etching.Premine)
+			}
+			for _, edict := range runestone.Edicts {
+				i.allocateEdict(tx, edict, etchedId, unallocated, allocated)
+			}
+		}
+		if etchedId != nil {
+			i.createRuneEntry(tx.TxHash(), timestamp, artifact, *etchedId, etchedRune)
+		}
+	}
+
+	burned := make(map[RuneId]uint128.Uint128)
+	if artifact != nil && artifact.Cenotaph != nil {
+		for id, balance := range unallocated {
+			burned[id] = burned[id].Add(balance)
+		}
+	} else {
+		vout := -1
+		if artifact != nil && artifact.Runestone != nil && artifact.Runestone.Pointer != nil {
+			vout = int(*artifact.Runestone.Pointer)
+		} else {
+			for n, out := range tx.TxOut {
+				if !isOpReturn(out.PkScript) {
+					vout = n
+					break
+				}
+			}
+		}
+		for id, balance := range unallocated {
+			if balance.IsZero() {
+				continue
+			}
+			if vout >= 0 {
+				allocated[vout][id] = allocated[vout][id].Add(balance)
+			} else {
+				burned[id] = burned[id].Add(balance)
+			}
+		}
+	}
+
+	txid := tx.TxHash()
+	for vout, balances := range allocated {
+		if len(balances) == 0 {
+			continue
+		}
+		if isOpReturn(tx.TxOut[vout].PkScript) {
+			for id, balance := range balances {
+				burned[id] = burned[id].Add(balance)
+			}
+			continue
+		}
+		list := make([]Balance, 0, len(balances))
+		for id, balance := range balances {
+			list = append(list, Balance{ID: id, Amount: balance})
+		}
+		sort.Slice(list, func(a, b int) bool {
+			return list[a].ID.Cmp(list[b].ID) < 0
+		})
+		outpoint := wire.OutPoint{Hash: txid, Index: uint32(vout)}
+		i.balances[outpoint] = list
+		i.pending.create(outpoint)
+	}
+
+	for id, amount := range burned {
+		if entry, ok := i.runes[id]; ok {
+			entry.Burned = entry.Burned.Add(amount)
+			i.pending.burn(id, amount)
+		}
+	}
+	return nil
+}
+
+// unallocated removes the balances of the spent outputs from the index and
+// returns their sum per rune.
+func (i *Index) unallocated(tx *wire.MsgTx) map[RuneId]uint128.Uint128 {
+	unallocated := make(map[RuneId]uint128.Uint128)
+	for _, in := range tx.TxIn {
+		balances, ok := i.balances[in.PreviousOutPoint]
+		if !ok {
+			continue
+		}
+		delete(i.balances, in.PreviousOutPoint)
+		i.pending.spend(in.PreviousOutPoint, balances)
+		for _, balance := range balances {
+			unallocated[balance.ID] = unallocated[balance.ID].Add(balance.Amount)
+		}
+	}
+	return unallocated
+}
+
+func (i *Index) allocateEdict(tx *wire.MsgTx, edict Edict, etchedId *RuneId,
+	unallocated map[RuneId]uint128.Uint128, allocated []map[RuneId]uint128.Uint128) {
+	id := edict.ID
+	if id == (RuneId{}) {
+		if etchedId == nil {
+			return
+		}
+		id = *etchedId
+	}
+	balance, ok := unallocated[id]
+	if !ok {
+		return
+	}
+	allocate := func(amount uint128.Uint128, output int) {
+		if amount.IsZero() {
+			return
+		}
+		balance = balance.Sub(amount)
+		allocated[output][id] = allocated[output][id].Add(amount)
+	}
+
+	if int(edict.Output) == len(tx.TxOut) {
+		var destinations []int
+		for n, out := range tx.TxOut {
+			if !isOpReturn(out.PkScript) {
+				destinations = append(destinations, n)
+			}
+		}
+		if len(destinations) > 0 {
+			if edict.Amount.IsZero() {
+				amount := balance.Div64(uint64(len(destinations)))
+				remainder := balance.Mod64(uint64(len(destinations)))
+				for n, output := range destinations {
+					if uint64(n) < remainder {
+						allocate(amount.Add64(1), output)
+					} else {
+						allocate(amount, output)
+					}
+				}
+			} else {
+				for _, output := range destinations {
+					allocate(minUint128(edict.Amount, balance), output)
+				}
+			}
+		}
+	} else {
+		amount := balance
+		if !edict.Amount.IsZero() {
+			amount = minUint128(edict.Amount, balance)
+		}
+		allocate(amount, int(edict.Output))
+	}
+	unallocated[id] = balance
+}
+
+func (i *Index) mint(id RuneId, height uint64) (uint128.Uint128, bool) {
+	entry, ok := i.runes[id]
+	if !ok {
+		return uint128.Zero, false
+	}
+	amount, err := entry.Mintable(height)
+	if err != nil {
+		return uint128.Zero, false
+	}
+	entry.Mints = entry.Mints.Add64(1)
+	i.pending.mints[id]++
+	return amount, true
+}
+
+func (i *Index) etched(height uint64, txIndex uint32, tx *wire.MsgTx, artifact *Artifact) (*RuneId, Rune, error) {
+	var r *Rune
+	if artifact.Runestone != nil {
+		if artifact.Runestone.Etching == nil {
+			return nil, Rune{}, nil
+		}
+		r = artifact.Runestone.Etching.Rune
+	} else {
+		if artifact.Cenotaph.Etching == nil {
+			return nil, Rune{}, nil
+		}
+		r = artifact.Cenotaph.Etching
+	}
+
+	if r == nil {
+		reserved := Reserved(height, txIndex)
+		r = &reserved
+	} else {
+		minimum := MinimumAtHeight(i.Network, height)
+		if r.Value.Cmp(minimum.Value) < 0 || r.IsReserved() {
+			return nil, Rune{}, nil
+		}
+		if _, ok := i.ids[r.Value]; ok {
+			return nil, Rune{}, nil
+		}
+		commits, err := i.txCommitsToRune(height, tx, *r)
+		if err != nil {
+			return nil, Rune{}, err
+		}
+		if !commits {
+			return nil, Rune{}, nil
+		}
+	}
+	return &RuneId{Block: height, Tx: txIndex}, *r, nil
+}
+
+func (i *Index) txCommitsToRune(height uint64, tx *wire.MsgTx, r Rune) (bool, error) {
+	commitment := r.Commitment()
+	for _, in := range tx.TxIn {
+		tapscript := witnessTapscript(in.Witness)
+		if tapscript == nil {
+			continue
+		}
+		tokenizer := txscript.MakeScriptTokenizer(0, tapscript)
+		for tokenizer.Next() {
+			if !isPushBytes(tokenizer.Opcode()) || string(tokenizer.Data()) != string(commitment) {
+				continue
+			}
+			if i.Fetcher == nil {
+				return true, nil
+			}
+			txOut, commitHeight, err := i.Fetcher.FetchTxOut(in.PreviousOutPoint)
+			if err != nil {
+				return false, err
+			}
+			if !txscript.IsPayToTaproot(txOut.PkScript) || commitHeight > height {
+				continue
+			}
+			if height-commitHeight+1 >= COMMIT_CONFIRMATIONS {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (i *Index) createRuneEntry(txid chainhash.Hash, timestamp uint64, artifact *Artifact, id RuneId, r Rune) {
+	entry := &RuneEntry{
+		Block:      id.Block,
+		Etching:    txid,
+		Number:     i.number,
+		SpacedRune: SpacedRune{Rune: r},
+		Timestamp:  timestamp,
+	}
+	if artifact.Runestone != nil {
+		etching := artifact.Runestone.Etching
+		if etching.Divisibility != nil {
+			entry.Divisibility = *etching.Divisibility
+		}
+		if etching.Premine != nil {
+			entry.Premine = *etching.Premine
+		}
+		if etching.Spacers != nil {
+			entry.SpacedRune.Spacers = *etching.Spacers
+		}
+		entry.Symbol = etching.Symbol
+		entry.Terms = etching.Terms
+		entry.Turbo = etching.Turbo
+	}
+	i.number++
+	i.runes[id] = entry
+	i.ids[r.Value] = id
+	i.pending.etched = append(i.pending.etched, id)
+}
+
+// witnessTapscript returns the script of a script-path spend, dropping the
+// annex if there is one.
+func witnessTapscript(witness wire.TxWitness) []byte {
+	n := len(witness)
+	if n > 1 && len(witness[n-1]) > 0 && witness[n-1][0] == txscript.TaprootAnnexTag {
+		n--
+	}
+	if n < 2 {
+		return nil
+	}
+	return witness[n-2]
+}
+
+func isOpReturn(pkScript []byte) bool {
+	return len(pkScript) > 0 && pkScript[0] == txscript.OP_RETURN
+}
+
+func minUint128(a, b uint128.Uint128) uint128.Uint128 {
+	if a.Cmp(b) < 0 {
+		return a
+	}
+	return b
+}
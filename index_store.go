@@ -0,0 +1,436 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"lukechampine.com/uint128"
+)
+
+// Keys of the index state in a Store. Numbers in keys are big-endian so that
+// keys sort by them.
+var (
+	stateKey        = []byte("s") // network, height, hash and rune number
+	blockHashPrefix = []byte("b") // height → block hash
+	runeEntryPrefix = []byte("r") // rune id → rune entry
+	runeIdPrefix    = []byte("n") // rune → rune id
+	balancesPrefix  = []byte("o") // outpoint → balances
+	undoPrefix      = []byte("u") // height → undo record of the block
+)
+
+var ErrStoreNetwork = errors.New("store holds the index of another network")
+
+var errCorruptValue = errors.New("corrupt index value")
+
+func blockHashKey(height uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, blockHashPrefix...), height)
+}
+
+func undoKey(height uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, undoPrefix...), height)
+}
+
+func runeEntryKey(id RuneId) []byte {
+	key := binary.BigEndian.AppendUint64(append([]byte{}, runeEntryPrefix...), id.Block)
+	return binary.BigEndian.AppendUint32(key, id.Tx)
+}
+
+func runeIdKey(r Rune) []byte {
+	key := make([]byte, len(runeIdPrefix)+16)
+	copy(key, runeIdPrefix)
+	r.Value.PutBytesBE(key[len(runeIdPrefix):])
+	return key
+}
+
+func balancesKey(outpoint wire.OutPoint) []byte {
+	key := append(append([]byte{}, balancesPrefix...), outpoint.Hash[:]...)
+	return binary.BigEndian.AppendUint32(key, outpoint.Index)
+}
+
+// OpenIndex returns an index kept in store, with the state it holds if the
+// index has written any. Every block indexed afterwards is written to the
+// store as one batch.
+func OpenIndex(network wire.BitcoinNet, store Store) (*Index, error) {
+	i := NewIndex(network)
+	i.store = store
+	value, ok, err := store.Get(stateKey)
+	if err != nil || !ok {
+		return i, err
+	}
+	d := &storeDecoder{b: value}
+	if wire.BitcoinNet(d.uint32()) != network {
+		return nil, ErrStoreNetwork
+	}
+	i.height = d.uint64()
+	copy(i.hash[:], d.bytes(chainhash.HashSize))
+	i.number = d.uint64()
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("index state: %w", err)
+	}
+	i.indexed = true
+
+	err = store.Iterate(runeEntryPrefix, func(key, value []byte) error {
+		if len(key) != len(runeEntryPrefix)+12 {
+			return errCorruptValue
+		}
+		id := RuneId{
+			Block: binary.BigEndian.Uint64(key[len(runeEntryPrefix):]),
+			Tx:    binary.BigEndian.Uint32(key[len(runeEntryPrefix)+8:]),
+		}
+		entry, err := decodeRuneEntry(value)
+		if err != nil {
+			return fmt.Errorf("rune %s: %w", id, err)
+		}
+		i.runes[id] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = store.Iterate(runeIdPrefix, func(key, value []byte) error {
+		if len(key) != len(runeIdPrefix)+16 {
+			return errCorruptValue
+		}
+		d := &storeDecoder{b: value}
+		id := d.runeId()
+		if err := d.finish(); err != nil {
+			return err
+		}
+		i.ids[uint128.FromBytesBE(key[len(runeIdPrefix):])] = id
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = store.Iterate(undoPrefix, func(key, value []byte) error {
+		undo, err := decodeBlockUndo(value)
+		if err != nil {
+			return fmt.Errorf("undo record %x: %w", key, err)
+		}
+		i.undos = append(i.undos, undo)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = store.Iterate(balancesPrefix, func(key, value []byte) error {
+		if len(key) != len(balancesPrefix)+chainhash.HashSize+4 {
+			return errCorruptValue
+		}
+		var outpoint wire.OutPoint
+		copy(outpoint.Hash[:], key[len(balancesPrefix):])
+		outpoint.Index = binary.BigEndian.Uint32(key[len(balancesPrefix)+chainhash.HashSize:])
+		balances, err := decodeBalances(value)
+		if err != nil {
+			return fmt.Errorf("outpoint %s: %w", outpoint, err)
+		}
+		i.balances[outpoint] = balances
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// save writes the block just indexed to the store: the keys it changed, its
+// undo record and hash, and the new height. The undo record that fell out of
+// the reorg window is deleted.
+func (i *Index) save(undo *blockUndo, pruned []*blockUndo) error {
+	var batch Batch
+	for _, id := range undo.runes() {
+		batch.Put(runeEntryKey(id), encodeRuneEntry(i.runes[id]))
+	}
+	for _, id := range undo.etched {
+		batch.Put(runeIdKey(i.runes[id].SpacedRune.Rune), encodeRuneId(id))
+	}
+	for outpoint := range undo.created {
+		batch.Put(balancesKey(outpoint), encodeBalances(i.balances[outpoint]))
+	}
+	for outpoint := range undo.spent {
+		batch.Delete(balancesKey(outpoint))
+	}
+	for _, old := range pruned {
+		batch.Delete(undoKey(old.height))
+	}
+	if i.MaxReorgDepth > 0 {
+		batch.Put(undoKey(undo.height), encodeBlockUndo(undo))
+	}
+	batch.Put(blockHashKey(i.height), i.hash[:])
+	i.putState(&batch, i.height, i.hash, i.number)
+	return i.store.Write(batch)
+}
+
+// putState adds the height, hash and rune number of the index to batch.
+func (i *Index) putState(batch *Batch, height uint64, hash chainhash.Hash, number uint64) {
+	e := &storeEncoder{}
+	e.uint32(uint32(i.Network))
+	e.uint64(height)
+	e.bytes(hash[:])
+	e.uint64(number)
+	batch.Put(stateKey, e.b)
+}
+
+func encodeRuneId(id RuneId) []byte {
+	e := &storeEncoder{}
+	e.uvarint(id.Block)
+	e.uvarint(uint64(id.Tx))
+	return e.b
+}
+
+func encodeRuneEntry(entry *RuneEntry) []byte {
+	e := &storeEncoder{}
+	e.uvarint(entry.Block)
+	e.uint128(entry.Burned)
+	e.bytes([]byte{entry.Divisibility})
+	e.bytes(entry.Etching[:])
+	e.uint128(entry.Mints)
+	e.uvarint(entry.Number)
+	e.uint128(entry.Premine)
+	e.uint128(entry.SpacedRune.Rune.Value)
+	e.uvarint(uint64(entry.SpacedRune.Spacers))
+	e.bool(entry.Symbol != nil)
+	if entry.Symbol != nil {
+		e.uvarint(uint64(*entry.Symbol))
+	}
+	e.bool(entry.Terms != nil)
+	if t := entry.Terms; t != nil {
+		e.optUint128(t.Amount)
+		e.optUint128(t.Cap)
+		e.optUint64(t.Height[0])
+		e.optUint64(t.Height[1])
+		e.optUint64(t.Offset[0])
+		e.optUint64(t.Offset[1])
+	}
+	e.uvarint(entry.Timestamp)
+	e.bool(entry.Turbo)
+	return e.b
+}
+
+func decodeRuneEntry(value []byte) (*RuneEntry, error) {
+	d := &storeDecoder{b: value}
+	entry := &RuneEntry{}
+	entry.Block = d.uvarint()
+	entry.Burned = d.uint128()
+	if b := d.bytes(1); b != nil {
+		entry.Divisibility = b[0]
+	}
+	copy(entry.Etching[:], d.bytes(chainhash.HashSize))
+	entry.Mints = d.uint128()
+	entry.Number = d.uvarint()
+	entry.Premine = d.uint128()
+	entry.SpacedRune.Rune.Value = d.uint128()
+	entry.SpacedRune.Spacers = uint32(d.uvarint())
+	if d.bool() {
+		symbol := rune(d.uvarint())
+		entry.Symbol = &symbol
+	}
+	if d.bool() {
+		entry.Terms = &Terms{
+			Amount: d.optUint128(),
+			Cap:    d.optUint128(),
+			Height: [2]*uint64{d.optUint64(), d.optUint64()},
+			Offset: [2]*uint64{d.optUint64(), d.optUint64()},
+		}
+	}
+	entry.Timestamp = d.uvarint()
+	entry.Turbo = d.bool()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func encodeBalances(balances []Balance) []byte {
+	e := &storeEncoder{}
+	e.uvarint(uint64(len(balances)))
+	for _, balance := range balances {
+		e.uvarint(balance.ID.Block)
+		e.uvarint(uint64(balance.ID.Tx))
+		e.uint128(balance.Amount)
+	}
+	return e.b
+}
+
+func decodeBalances(value []byte) ([]Balance, error) {
+	d := &storeDecoder{b: value}
+	balances := make([]Balance, d.count())
+	for k := range balances {
+		balances[k].ID = d.runeId()
+		balances[k].Amount = d.uint128()
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+type storeEncoder struct {
+	b []byte
+}
+
+func (e *storeEncoder) uvarint(v uint64) {
+	e.b = binary.AppendUvarint(e.b, v)
+}
+
+func (e *storeEncoder) uint32(v uint32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, v)
+}
+
+func (e *storeEncoder) uint64(v uint64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, v)
+}
+
+func (e *storeEncoder) uint128(v uint128.Uint128) {
+	e.b = append(e.b, make([]byte, 16)...)
+	v.PutBytesBE(e.b[len(e.b)-16:])
+}
+
+func (e *storeEncoder) bytes(b []byte) {
+	e.b = append(e.b, b...)
+}
+
+func (e *storeEncoder) outpoint(outpoint wire.OutPoint) {
+	e.bytes(outpoint.Hash[:])
+	e.uint32(outpoint.Index)
+}
+
+func (e *storeEncoder) bool(v bool) {
+	if v {
+		e.b = append(e.b, 1)
+	} else {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *storeEncoder) optUint128(v *uint128.Uint128) {
+	e.bool(v != nil)
+	if v != nil {
+		e.uint128(*v)
+	}
+}
+
+func (e *storeEncoder) optUint64(v *uint64) {
+	e.bool(v != nil)
+	if v != nil {
+		e.uvarint(*v)
+	}
+}
+
+// storeDecoder reads what storeEncoder wrote. After the first read past the
+// end every read returns zero, and finish reports the error.
+type storeDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *storeDecoder) bytes(n int) []byte {
+	if d.err != nil || len(d.b) < n {
+		d.err = errCorruptValue
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *storeDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errCorruptValue
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count reads a number of items, each at least a byte long.
+func (d *storeDecoder) count() uint64 {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = errCorruptValue
+		return 0
+	}
+	return n
+}
+
+func (d *storeDecoder) runeId() RuneId {
+	return RuneId{Block: d.uvarint(), Tx: uint32(d.uvarint())}
+}
+
+func (d *storeDecoder) outpoint() wire.OutPoint {
+	var outpoint wire.OutPoint
+	copy(outpoint.Hash[:], d.bytes(chainhash.HashSize))
+	outpoint.Index = d.uint32()
+	return outpoint
+}
+
+func (d *storeDecoder) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *storeDecoder) uint64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *storeDecoder) uint128() uint128.Uint128 {
+	if b := d.bytes(16); b != nil {
+		return uint128.FromBytesBE(b)
+	}
+	return uint128.Zero
+}
+
+func (d *storeDecoder) bool() bool {
+	b := d.bytes(1)
+	return b != nil && b[0] != 0
+}
+
+func (d *storeDecoder) optUint128() *uint128.Uint128 {
+	if !d.bool() {
+		return nil
+	}
+	v := d.uint128()
+	return &v
+}
+
+func (d *storeDecoder) optUint64() *uint64 {
+	if !d.bool() {
+		return nil
+	}
+	v := d.uvarint()
+	return &v
+}
+
+// finish returns the first error, or an error if bytes are left over.
+func (d *storeDecoder) finish() error {
+	if d.err == nil && len(d.b) > 0 {
+		d.err = errCorruptValue
+	}
+	return d.err
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"lukechampine.com/uint128"
+)
+
+func TestRuneEntryEncoding(t *testing.T) {
+	zero := uint64(0)
+	entry := &RuneEntry{
+		Block:        testIndexHeight,
+		Burned:       uint128.New(1, 2),
+		Divisibility: 38,
+		Etching:      [32]byte{1},
+		Mints:        uint128.From64(3),
+		Number:       4,
+		Premine:      uint128.Max,
+		SpacedRune:   SpacedRune{Rune: Rune{uint128.From64(1000)}, Spacers: 5},
+		Symbol:       CharP('\x00'),
+		Terms:        &Terms{Amount: Uint128PFrom64(0), Height: [2]*uint64{&zero, nil}, Offset: [2]*uint64{nil, Uint64P(9)}},
+		Timestamp:    1700000000,
+		Turbo:        true,
+	}
+	decoded, err := decodeRuneEntry(encodeRuneEntry(entry))
+	require.NoError(t, err)
+	assert.Equal(t, entry, decoded)
+
+	plain := &RuneEntry{SpacedRune: SpacedRune{Rune: Rune{uint128.From64(1)}}}
+	decoded, err = decodeRuneEntry(encodeRuneEntry(plain))
+	require.NoError(t, err)
+	assert.Equal(t, plain, decoded)
+
+	_, err = decodeRuneEntry(encodeRuneEntry(entry)[:20])
+	assert.ErrorIs(t, err, errCorruptValue)
+}
+
+func TestIndexReopensFromStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	index, err := OpenIndex(wire.TestNet, store)
+	require.NoError(t, err)
+
+	id, etch := etchTestRune(t, index, &Etching{
+		Rune:    RuneP64(1000),
+		Premine: Uint128PFrom64(100),
+		Symbol:  CharP('$'),
+		Terms:   &Terms{Amount: Uint128PFrom64(10), Cap: Uint128PFrom64(5)},
+	}, 1)
+	mint := testTx(t, &Runestone{Mint: &id}, 1)
+	transfer := testTx(t, &Runestone{Edicts: []Edict{{ID: id, Amount: uint128.From64(30), Output: 2}}}, 2, wire.OutPoint{Hash: etch.TxHash(), Index: 1})
+	require.NoError(t, index.IndexBlock(id.Block+1, nextTestBlock(index, mint, transfer)))
+	require.NoError(t, store.Close())
+
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	reopened, err := OpenIndex(wire.TestNet, store)
+	require.NoError(t, err)
+	height, hash, ok := reopened.Height()
+	assert.True(t, ok)
+	assert.Equal(t, id.Block+1, height)
+	_, wantHash, _ := index.Height()
+	assert.Equal(t, wantHash, hash)
+	assert.Equal(t, index.runes, reopened.runes)
+	assert.Equal(t, index.ids, reopened.ids)
+	assert.Equal(t, index.balances, reopened.balances)
+	assert.Empty(t, reopened.Balances(wire.OutPoint{Hash: etch.TxHash(), Index: 1}))
+
+	// indexing goes on where it stopped, numbering runes after the stored ones
+	next, _ := etchTestRune(t, reopened, &Etching{Rune: RuneP64(2000)}, 1)
+	assert.Equal(t, id.Block+2, next.Block)
+	entry, ok := reopened.RuneEntry(next)
+	require.True(t, ok)
+	assert.EqualValues(t, 1, entry.Number)
+	value, ok, err := store.Get(blockHashKey(id.Block + 1))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, wantHash[:], value)
+
+	_, err = OpenIndex(wire.MainNet, store)
+	assert.ErrorIs(t, err, ErrStoreNetwork)
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"lukechampine.com/uint128"
+)
+
+const testIndexHeight = 300_000
+
+var testPkScript = []byte{txscript.OP_1, txscript.OP_DATA_32,
+	1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+	17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}
+
+func testBlock(txs ...*wire.MsgTx) *wire.MsgBlock {
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex}, nil, nil))
+	coinbase.AddTxOut(wire.NewTxOut(0, testPkScript))
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, 0))
+	block.Header.Timestamp = time.Unix(1700000000, 0)
+	block.AddTransaction(coinbase)
+	for _, tx := range txs {
+		block.AddTransaction(tx)
+	}
+	return block
+}
+
+// nextTestBlock is testBlock building on the last block of index.
+func nextTestBlock(index *Index, txs ...*wire.MsgTx) *wire.MsgBlock {
+	block := testBlock(txs...)
+	_, block.Header.PrevBlock, _ = index.Height()
+	return block
+}
+
+var testTxCount uint32
+
+// testTx builds a transaction spending inputs with the runestone, if any, in
+// output 0 followed by the given number of non-OP_RETURN outputs.
+func testTx(t *testing.T, r *Runestone, outputs int, inputs ...wire.OutPoint) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for _, in := range inputs {
+		tx.AddTxIn(wire.NewTxIn(&in, nil, nil))
+	}
+	if len(inputs) == 0 {
+		// unique dummy input so that every test transaction has its own txid
+		testTxCount++
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: testTxCount}, nil, nil))
+	}
+	if r != nil {
+		script, err := r.Encipher()
+		assert.NoError(t, err)
+		tx.AddTxOut(wire.NewTxOut(0, script))
+	}
+	for n := 0; n < outputs; n++ {
+		tx.AddTxOut(wire.NewTxOut(330, testPkScript))
+	}
+	return tx
+}
+
+func commitWitness(t *testing.T, r Rune) wire.TxWitness {
+	script, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_FALSE).AddOp(txscript.OP_IF).
+		AddData(r.Commitment()).
+		AddOp(txscript.OP_ENDIF).Script()
+	assert.NoError(t, err)
+	return wire.TxWitness{make([]byte, 64), script, make([]byte, 33)}
+}
+
+func etchTestRune(t *testing.T, index *Index, etching *Etching, outputs int) (RuneId, *wire.MsgTx) {
+	tx := testTx(t, &Runestone{Etching: etching}, outputs)
+	if etching.Rune != nil {
+		tx.TxIn[0].Witness = commitWitness(t, *etching.Rune)
+	}
+	height := uint64(testIndexHeight)
+	if h, _, ok := index.Height(); ok {
+		height = h + 1
+	}
+	assert.NoError(t, index.IndexBlock(height, nextTestBlock(index, tx)))
+	return RuneId{Block: height, Tx: 1}, tx
+}
+
+func TestIndexEtchingWithPremine(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	etching := &Etching{
+		Rune:         RuneP64(1000),
+		Divisibility: Uint8P(2),
+		Premine:      Uint128PFrom64(500),
+		Symbol:       CharP('$'),
+	}
+	id, tx := etchTestRune(t, index, etching, 1)
+
+	entry, ok := index.RuneEntry(id)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(2), entry.Divisibility)
+	assert.Equal(t, tx.TxHash(), entry.Etching)
+	assert.Equal(t, '$', *entry.Symbol)
+	assert.Equal(t, uint64(1700000000), entry.Timestamp)
+
+	found, ok := index.RuneId(Rune{uint128.From64(1000)})
+	assert.True(t, ok)
+	assert.Equal(t, id, *found)
+
+	assert.Equal(t, []Balance{{ID: id, Amount: uint128.From64(500)}},
+		index.Balances(wire.OutPoint{Hash: tx.TxHash(), Index: 1}))
+}
+
+func TestIndexEtchingWithoutCommitmentIsIgnored(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	tx := testTx(t, &Runestone{Etching: &Etching{Rune: RuneP64(1000), Premine: Uint128PFrom64(1)}}, 1)
+	assert.NoError(t, index.IndexBlock(testIndexHeight, testBlock(tx)))
+
+	_, ok := index.RuneEntry(RuneId{Block: testIndexHeight, Tx: 1})
+	assert.False(t, ok)
+}
+
+func TestIndexEtchingWithoutRuneIsReserved(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	id, _ := etchTestRune(t, index, &Etching{Premine: Uint128PFrom64(1)}, 1)
+
+	entry, ok := index.RuneEntry(id)
+	assert.True(t, ok)
+	assert.Equal(t, Reserved(id.Block, id.Tx), entry.SpacedRune.Rune)
+}
+
+func TestIndexMintUntilCap(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	id, _ := etchTestRune(t, index, &Etching{
+		Rune:  RuneP64(1000),
+		Terms: &Terms{Amount: Uint128PFrom64(10), Cap: Uint128PFrom64(2)},
+	}, 1)
+
+	mints := []*wire.MsgTx{
+		testTx(t, &Runestone{Mint: &id}, 1),
+		testTx(t, &Runestone{Mint: &id}, 2),
+		testTx(t, &Runestone{Mint: &id}, 3),
+	}
+	assert.NoError(t, index.IndexBlock(id.Block+1, nextTestBlock(index, mints...)))
+
+	entry, _ := index.RuneEntry(id)
+	assert.Equal(t, uint128.From64(2), entry.Mints)
+	assert.Equal(t, uint128.From64(20), entry.Supply())
+	assert.Equal(t, []Balance{{ID: id, Amount: uint128.From64(10)}},
+		index.Balances(wire.OutPoint{Hash: mints[0].TxHash(), Index: 1}))
+	assert.Empty(t, index.Balances(wire.OutPoint{Hash: mints[2].TxHash(), Index: 1}))
+
+	_, err := entry.Mintable(id.Block + 2)
+	assert.Equal(t, &MintError{Kind: MintCap, Cap: uint128.From64(2)}, err)
+}
+
+func TestIndexEdictsAndPointer(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	id, etch := etchTestRune(t, index, &Etching{Rune: RuneP64(1000), Premine: Uint128PFrom64(100)}, 1)
+	funding := wire.OutPoint{Hash: etch.TxHash(), Index: 1}
+
+	// split 30 to output 1, the remaining 70 to the pointer output 3
+	tx := testTx(t, &Runestone{
+		Edicts:  []Edict{{ID: id, Amount: uint128.From64(30), Output: 1}},
+		Pointer: Uint32P(3),
+	}, 3, funding)
+	assert.NoError(t, index.IndexBlock(id.Block+1, nextTestBlock(index, tx)))
+
+	assert.Empty(t, index.Balances(funding))
+	assert.Equal(t, uint128.From64(30), index.Balances(wire.OutPoint{Hash: tx.TxHash(), Index: 1})[0].Amount)
+	assert.Empty(t, index.Balances(wire.OutPoint{Hash: tx.TxHash(), Index: 2}))
+	assert.Equal(t, uint128.From64(70), index.Balances(wire.OutPoint{Hash: tx.TxHash(), Index: 3})[0].Amount)
+
+	// an edict to the output count with amount zero splits the balance evenly
+	spend := wire.OutPoint{Hash: tx.TxHash(), Index: 3}
+	split := testTx(t, &Runestone{Edicts: []Edict{{ID: id, Output: 4}}}, 3, spend)
+	assert.NoError(t, index.IndexBlock(id.Block+2, nextTestBlock(index, split)))
+	assert.Equal(t, uint128.From64(24), index.Balances(wire.OutPoint{Hash: split.TxHash(), Index: 1})[0].Amount)
+	assert.Equal(t, uint128.From64(23), index.Balances(wire.OutPoint{Hash: split.TxHash(), Index: 2})[0].Amount)
+	assert.Equal(t, uint128.From64(23), index.Balances(wire.OutPoint{Hash: split.TxHash(), Index: 3})[0].Amount)
+}
+
+func TestIndexCenotaphBurnsInputs(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	id, etch := etchTestRune(t, index, &Etching{Rune: RuneP64(1000), Premine: Uint128PFrom64(100)}, 1)
+
+	tx := testTx(t, nil, 1, wire.OutPoint{Hash: etch.TxHash(), Index: 1})
+	tx.TxOut = append([]*wire.TxOut{wire.NewTxOut(0, []byte{txscript.OP_RETURN, MAGIC_NUMBER, txscript.OP_VERIFY})}, tx.TxOut...)
+	assert.NoError(t, index.IndexBlock(id.Block+1, nextTestBlock(index, tx)))
+
+	entry, _ := index.RuneEntry(id)
+	assert.Equal(t, uint128.From64(100), entry.Burned)
+	assert.Empty(t, index.Balances(wire.OutPoint{Hash: tx.TxHash(), Index: 1}))
+}
+
+func TestIndexBlockOutOfOrder(t *testing.T) {
+	index := NewIndex(wire.TestNet)
+	assert.NoError(t, index.IndexBlock(10, testBlock()))
+	assert.ErrorIs(t, index.IndexBlock(12, testBlock()), ErrBlockHeight)
+	_, hash, _ := index.Height()
+
+	// a block of another chain at the next height
+	fork := testBlock()
+	fork.Header.Nonce = 1
+	assert.ErrorIs(t, index.IndexBlock(11, fork), ErrBlockParent)
+	height, current, _ := index.Height()
+	assert.Equal(t, uint64(10), height)
+	assert.Equal(t, hash, current)
+	assert.NoError(t, index.IndexBlock(11, nextTestBlock(index)))
+}
+
+type testFetcher map[wire.OutPoint]uint64
+
+func (f testFetcher) FetchTxOut(outpoint wire.OutPoint) (*wire.TxOut, uint64, error) {
+	return wire.NewTxOut(10000, testPkScript), f[outpoint], nil
+}
+
+func TestIndexEtchingRequiresMatureCommitment(t *testing.T) {
+	r := Rune{uint128.From64(1000)}
+	commit := wire.OutPoint{Index: 7}
+	newEtch := func() *wire.MsgTx {
+		tx := testTx(t, &Runestone{Etching: &Etching{Rune: &r}}, 1, commit)
+		tx.TxIn[0].Witness = commitWitness(t, r)
+		return tx
+	}
+
+	index := NewIndex(wire.TestNet)
+	index.Fetcher = testFetcher{commit: testIndexHeight - COMMIT_CONFIRMATIONS + 2}
+	assert.NoError(t, index.IndexBlock(testIndexHeight, testBlock(newEtch())))
+	_, ok := index.RuneId(r)
+	assert.False(t, ok)
+
+	index = NewIndex(wire.TestNet)
+	index.Fetcher = testFetcher{commit: testIndexHeight - COMMIT_CONFIRMATIONS + 1}
+	assert.NoError(t, index.IndexBlock(testIndexHeight, testBlock(newEtch())))
+	_, ok = index.RuneId(r)
+	assert.True(t, ok)
+}
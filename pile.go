@@ -0,0 +1,57 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"strings"
+
+	"lukechampine.com/uint128"
+)
+
+// Pile is an amount of a rune, displayed as ord does: in whole units of its
+// divisibility, followed by its symbol.
+type Pile struct {
+	Amount       uint128.Uint128
+	Divisibility uint8
+	Symbol       *rune
+}
+
+func (p Pile) String() string {
+	cutoff := uint128.From64(1)
+	for i := uint8(0); i < p.Divisibility; i++ {
+		cutoff = cutoff.Mul64(10)
+	}
+	whole, fractional := p.Amount.QuoRem(cutoff)
+	var b strings.Builder
+	b.WriteString(whole.String())
+	if !fractional.IsZero() {
+		width := int(p.Divisibility)
+		for fractional.Mod64(10) == 0 {
+			fractional = fractional.Div64(10)
+			width--
+		}
+		digits := fractional.String()
+		b.WriteByte('.')
+		b.WriteString(strings.Repeat("0", width-len(digits)))
+		b.WriteString(digits)
+	}
+	symbol := '¤'
+	if p.Symbol != nil {
+		symbol = *p.Symbol
+	}
+	b.WriteRune('\u00a0')
+	b.WriteRune(symbol)
+	return b.String()
+}
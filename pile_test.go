@@ -0,0 +1,46 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"lukechampine.com/uint128"
+)
+
+func TestPileDisplay(t *testing.T) {
+	pile := func(amount uint64, divisibility uint8) string {
+		return Pile{Amount: uint128.From64(amount), Divisibility: divisibility}.String()
+	}
+	assert.Equal(t, "0\u00a0¤", pile(0, 0))
+	assert.Equal(t, "25\u00a0¤", pile(25, 0))
+	assert.Equal(t, "0\u00a0¤", pile(0, 1))
+	assert.Equal(t, "0.1\u00a0¤", pile(1, 1))
+	assert.Equal(t, "1\u00a0¤", pile(10, 1))
+	assert.Equal(t, "1.1\u00a0¤", pile(11, 1))
+	assert.Equal(t, "0.01\u00a0¤", pile(1, 2))
+	assert.Equal(t, "0.1\u00a0¤", pile(10, 2))
+	assert.Equal(t, "1.01\u00a0¤", pile(101, 2))
+	assert.Equal(t, "1.23\u00a0¤", pile(123, 2))
+
+	assert.Equal(t, "340282366920938463463374607431768211455\u00a0¤",
+		Pile{Amount: uint128.Max}.String())
+	assert.Equal(t, "3.40282366920938463463374607431768211455\u00a0¤",
+		Pile{Amount: uint128.Max, Divisibility: MaxDivisibility}.String())
+
+	symbol := '$'
+	assert.Equal(t, "1.5\u00a0$", Pile{Amount: uint128.From64(15), Divisibility: 1, Symbol: &symbol}.String())
+}
@@ -0,0 +1,302 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"lukechampine.com/uint128"
+)
+
+// DefaultMaxReorgDepth is the MaxReorgDepth of a new index, as deep as ord
+// recovers from.
+const DefaultMaxReorgDepth = 20
+
+var ErrReorgTooDeep = errors.New("reorg deeper than the undo records of the index")
+
+// BlockHashFetcher returns the hash of the block the chain has at height now.
+type BlockHashFetcher interface {
+	FetchBlockHash(height uint64) (chainhash.Hash, error)
+}
+
+// blockUndo is what a block changed in the index, to write the change to a
+// store and to roll the block back.
+type blockUndo struct {
+	height      uint64
+	hash        chainhash.Hash
+	prevIndexed bool
+	prevHash    chainhash.Hash // of the block before, if prevIndexed
+	number      uint64         // rune number before the block
+	created     map[wire.OutPoint]struct{}
+	spent       map[wire.OutPoint][]Balance // outputs of earlier blocks
+	etched      []RuneId
+	mints       map[RuneId]uint64
+	burned      map[RuneId]uint128.Uint128
+}
+
+func (i *Index) newBlockUndo(height uint64) *blockUndo {
+	return &blockUndo{
+		height:      height,
+		prevIndexed: i.indexed,
+		prevHash:    i.hash,
+		number:      i.number,
+		created:     make(map[wire.OutPoint]struct{}),
+		spent:       make(map[wire.OutPoint][]Balance),
+		mints:       make(map[RuneId]uint64),
+		burned:      make(map[RuneId]uint128.Uint128),
+	}
+}
+
+func (u *blockUndo) create(outpoint wire.OutPoint) {
+	u.created[outpoint] = struct{}{}
+}
+
+// spend records the balances of a spent output, unless the block created it.
+func (u *blockUndo) spend(outpoint wire.OutPoint, balances []Balance) {
+	if _, ok := u.created[outpoint]; ok {
+		delete(u.created, outpoint)
+		return
+	}
+	u.spent[outpoint] = balances
+}
+
+func (u *blockUndo) burn(id RuneId, amount uint128.Uint128) {
+	if !amount.IsZero() {
+		u.burned[id] = u.burned[id].Add(amount)
+	}
+}
+
+// runes returns the ids of the rune entries the block changed, sorted.
+func (u *blockUndo) runes() []RuneId {
+	seen := make(map[RuneId]struct{})
+	for _, id := range u.etched {
+		seen[id] = struct{}{}
+	}
+	for id := range u.mints {
+		seen[id] = struct{}{}
+	}
+	for id := range u.burned {
+		seen[id] = struct{}{}
+	}
+	ids := make([]RuneId, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		return ids[a].Cmp(ids[b]) < 0
+	})
+	return ids
+}
+
+// revert undoes the changes of undo in memory, leaving the index at the block
+// before.
+func (i *Index) revert(undo *blockUndo) {
+	for outpoint := range undo.created {
+		delete(i.balances, outpoint)
+	}
+	for outpoint, balances := range undo.spent {
+		i.balances[outpoint] = balances
+	}
+	for id, mints := range undo.mints {
+		if entry, ok := i.runes[id]; ok {
+			entry.Mints = entry.Mints.Sub64(mints)
+		}
+	}
+	for id, amount := range undo.burned {
+		if entry, ok := i.runes[id]; ok {
+			entry.Burned = entry.Burned.Sub(amount)
+		}
+	}
+	for _, id := range undo.etched {
+		if entry, ok := i.runes[id]; ok {
+			delete(i.ids, entry.SpacedRune.Rune.Value)
+			delete(i.runes, id)
+		}
+	}
+	i.number = undo.number
+	i.indexed = undo.prevIndexed
+	i.hash = undo.prevHash
+	i.height = undo.height - 1
+	if !undo.prevIndexed {
+		i.height = 0
+	}
+}
+
+// Rollback undoes the blocks above height, newest first. It fails with
+// ErrReorgTooDeep, and changes nothing, if the index has no undo records for
+// all of them. Rolling back the first block indexed leaves the index empty.
+func (i *Index) Rollback(height uint64) error {
+	if !i.indexed || height >= i.height {
+		return nil
+	}
+	if i.height-height > uint64(len(i.undos)) {
+		return fmt.Errorf("%w: %d blocks back to %d, %d undo records", ErrReorgTooDeep, i.height-height, height, len(i.undos))
+	}
+	for i.indexed && i.height > height {
+		undo := i.undos[len(i.undos)-1]
+		if i.store != nil {
+			if err := i.store.Write(i.undoBatch(undo)); err != nil {
+				return err
+			}
+		}
+		i.revert(undo)
+		i.undos = i.undos[:len(i.undos)-1]
+	}
+	return nil
+}
+
+// undoBatch returns the writes that roll the store back by the block of undo,
+// the last one indexed.
+func (i *Index) undoBatch(undo *blockUndo) Batch {
+	var batch Batch
+	etched := make(map[RuneId]struct{})
+	for _, id := range undo.etched {
+		etched[id] = struct{}{}
+		batch.Delete(runeEntryKey(id))
+		batch.Delete(runeIdKey(i.runes[id].SpacedRune.Rune))
+	}
+	for _, id := range undo.runes() {
+		if _, ok := etched[id]; ok {
+			continue
+		}
+		entry := *i.runes[id]
+		entry.Mints = entry.Mints.Sub64(undo.mints[id])
+		entry.Burned = entry.Burned.Sub(undo.burned[id])
+		batch.Put(runeEntryKey(id), encodeRuneEntry(&entry))
+	}
+	for outpoint := range undo.created {
+		batch.Delete(balancesKey(outpoint))
+	}
+	for outpoint, balances := range undo.spent {
+		batch.Put(balancesKey(outpoint), encodeBalances(balances))
+	}
+	batch.Delete(undoKey(undo.height))
+	batch.Delete(blockHashKey(undo.height))
+	if undo.prevIndexed {
+		i.putState(&batch, undo.height-1, undo.prevHash, undo.number)
+	} else {
+		batch.Delete(stateKey)
+	}
+	return batch
+}
+
+// Reorg compares the hashes of the indexed blocks, from the tip down, with
+// the hashes chain has at their heights, and rolls the index back to the
+// highest block both agree on. It returns the number of blocks rolled back;
+// if the blocks agree no further back than the undo records reach, it fails
+// with ErrReorgTooDeep and changes nothing.
+func (i *Index) Reorg(chain BlockHashFetcher) (int, error) {
+	if !i.indexed {
+		return 0, nil
+	}
+	height, hash := i.height, i.hash
+	n := len(i.undos)
+	for {
+		current, err := chain.FetchBlockHash(height)
+		if err != nil {
+			return 0, err
+		}
+		if current == hash {
+			break
+		}
+		if n == 0 || !i.undos[n-1].prevIndexed {
+			return 0, fmt.Errorf("%w: block %s at %d is not in the chain", ErrReorgTooDeep, hash, height)
+		}
+		n--
+		height, hash = height-1, i.undos[n].prevHash
+	}
+	depth := int(i.height - height)
+	return depth, i.Rollback(height)
+}
+
+func encodeBlockUndo(undo *blockUndo) []byte {
+	e := &storeEncoder{}
+	e.uint64(undo.height)
+	e.bytes(undo.hash[:])
+	e.bool(undo.prevIndexed)
+	e.bytes(undo.prevHash[:])
+	e.uvarint(undo.number)
+	e.uvarint(uint64(len(undo.created)))
+	for outpoint := range undo.created {
+		e.outpoint(outpoint)
+	}
+	e.uvarint(uint64(len(undo.spent)))
+	for outpoint, balances := range undo.spent {
+		e.outpoint(outpoint)
+		b := encodeBalances(balances)
+		e.uvarint(uint64(len(b)))
+		e.bytes(b)
+	}
+	e.uvarint(uint64(len(undo.etched)))
+	for _, id := range undo.etched {
+		e.bytes(encodeRuneId(id))
+	}
+	e.uvarint(uint64(len(undo.mints)))
+	for id, mints := range undo.mints {
+		e.bytes(encodeRuneId(id))
+		e.uvarint(mints)
+	}
+	e.uvarint(uint64(len(undo.burned)))
+	for id, amount := range undo.burned {
+		e.bytes(encodeRuneId(id))
+		e.uint128(amount)
+	}
+	return e.b
+}
+
+func decodeBlockUndo(value []byte) (*blockUndo, error) {
+	d := &storeDecoder{b: value}
+	undo := &blockUndo{
+		created: make(map[wire.OutPoint]struct{}),
+		spent:   make(map[wire.OutPoint][]Balance),
+		mints:   make(map[RuneId]uint64),
+		burned:  make(map[RuneId]uint128.Uint128),
+	}
+	undo.height = d.uint64()
+	copy(undo.hash[:], d.bytes(chainhash.HashSize))
+	undo.prevIndexed = d.bool()
+	copy(undo.prevHash[:], d.bytes(chainhash.HashSize))
+	undo.number = d.uvarint()
+	for n := d.count(); n > 0; n-- {
+		undo.created[d.outpoint()] = struct{}{}
+	}
+	for n := d.count(); n > 0; n-- {
+		outpoint := d.outpoint()
+		balances, err := decodeBalances(d.bytes(int(d.count())))
+		if err != nil {
+			return nil, err
+		}
+		undo.spent[outpoint] = balances
+	}
+	for n := d.count(); n > 0; n-- {
+		undo.etched = append(undo.etched, d.runeId())
+	}
+	for n := d.count(); n > 0; n-- {
+		id := d.runeId()
+		undo.mints[id] = d.uvarint()
+	}
+	for n := d.count(); n > 0; n-- {
+		id := d.runeId()
+		undo.burned[id] = d.uint128()
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return undo, nil
+}
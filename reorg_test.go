@@ -0,0 +1,268 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"lukechampine.com/uint128"
+)
+
+// testChain is the hash of every block of a chain by height.
+type testChain map[uint64]chainhash.Hash
+
+func (c testChain) FetchBlockHash(height uint64) (chainhash.Hash, error) {
+	hash, ok := c[height]
+	if !ok {
+		return chainhash.Hash{}, fmt.Errorf("no block at %d", height)
+	}
+	return hash, nil
+}
+
+// testFork is a chain of blocks from testIndexHeight, each linked to the one
+// before so that the blocks of different forks have their own hashes.
+type testFork struct {
+	blocks []*wire.MsgBlock
+	chain  testChain
+}
+
+func newTestFork(base ...*wire.MsgBlock) *testFork {
+	f := &testFork{chain: testChain{}}
+	for _, block := range base {
+		f.add(block)
+	}
+	return f
+}
+
+func (f *testFork) next(fork uint32, txs ...*wire.MsgTx) *wire.MsgBlock {
+	block := testBlock(txs...)
+	block.Header.Nonce = fork
+	if n := len(f.blocks); n > 0 {
+		block.Header.PrevBlock = f.blocks[n-1].BlockHash()
+	}
+	f.add(block)
+	return block
+}
+
+func (f *testFork) add(block *wire.MsgBlock) {
+	f.chain[testIndexHeight+uint64(len(f.blocks))] = block.BlockHash()
+	f.blocks = append(f.blocks, block)
+}
+
+// indexTestBlocks indexes blocks from testIndexHeight+from.
+func indexTestBlocks(t *testing.T, index *Index, from int, blocks []*wire.MsgBlock) {
+	for n := from; n < len(blocks); n++ {
+		require.NoError(t, index.IndexBlock(testIndexHeight+uint64(n), blocks[n]))
+	}
+}
+
+func assertSameIndex(t *testing.T, want, got *Index) {
+	wantHeight, wantHash, wantOk := want.Height()
+	height, hash, ok := got.Height()
+	assert.Equal(t, wantOk, ok)
+	assert.Equal(t, wantHeight, height)
+	assert.Equal(t, wantHash, hash)
+	assert.Equal(t, want.number, got.number)
+	assert.Equal(t, want.runes, got.runes)
+	assert.Equal(t, want.ids, got.ids)
+	assert.Equal(t, want.balances, got.balances)
+}
+
+// testForks returns two forks sharing the block that etches a mintable rune:
+// fork A mints, transfers, burns and etches another rune in two blocks, fork
+// B mints and etches the same other rune in three.
+func testForks(t *testing.T) (a, b *testFork, id RuneId) {
+	id = RuneId{Block: testIndexHeight, Tx: 1}
+	etch := testTx(t, &Runestone{Etching: &Etching{
+		Rune:    RuneP64(1000),
+		Premine: Uint128PFrom64(100),
+		Terms:   &Terms{Amount: Uint128PFrom64(10), Cap: Uint128PFrom64(5)},
+	}}, 1)
+	etch.TxIn[0].Witness = commitWitness(t, Rune{uint128.From64(1000)})
+	premine := wire.OutPoint{Hash: etch.TxHash(), Index: 1}
+	base := testBlock(etch)
+	other := &Etching{Rune: RuneP64(2000), Premine: Uint128PFrom64(7)}
+
+	a = newTestFork(base)
+	transfer := testTx(t, &Runestone{Edicts: []Edict{{ID: id, Amount: uint128.From64(30), Output: 2}}}, 2, premine)
+	// spent in the block that created it
+	respend := testTx(t, nil, 1, wire.OutPoint{Hash: transfer.TxHash(), Index: 2})
+	a.next(1, testTx(t, &Runestone{Mint: &id}, 1), transfer, respend)
+	burn := testTx(t, nil, 1, wire.OutPoint{Hash: transfer.TxHash(), Index: 1})
+	burn.TxOut = append([]*wire.TxOut{wire.NewTxOut(0, []byte{txscript.OP_RETURN, MAGIC_NUMBER, txscript.OP_VERIFY})}, burn.TxOut...)
+	etchOther := testTx(t, &Runestone{Etching: other}, 1)
+	etchOther.TxIn[0].Witness = commitWitness(t, *other.Rune)
+	a.next(1, burn, testTx(t, &Runestone{Mint: &id}, 1), etchOther)
+
+	b = newTestFork(base)
+	b.next(2, testTx(t, &Runestone{Mint: &id}, 2))
+	b.next(2)
+	etchOther = testTx(t, &Runestone{Etching: other}, 1, premine)
+	etchOther.TxIn[0].Witness = commitWitness(t, *other.Rune)
+	b.next(2, etchOther)
+	return a, b, id
+}
+
+func TestIndexReorg(t *testing.T) {
+	a, b, id := testForks(t)
+	index := NewIndex(wire.TestNet)
+	indexTestBlocks(t, index, 0, a.blocks)
+	entry, _ := index.RuneEntry(id)
+	assert.EqualValues(t, 2, entry.Mints.Lo)
+	assert.EqualValues(t, 70, entry.Burned.Lo)
+
+	depth, err := index.Reorg(a.chain)
+	require.NoError(t, err)
+	assert.Zero(t, depth)
+
+	depth, err = index.Reorg(b.chain)
+	require.NoError(t, err)
+	assert.Equal(t, 2, depth)
+	base := NewIndex(wire.TestNet)
+	indexTestBlocks(t, base, 0, b.blocks[:1])
+	assertSameIndex(t, base, index)
+
+	// the other rune is etched again on fork B
+	indexTestBlocks(t, index, 1, b.blocks)
+	want := NewIndex(wire.TestNet)
+	indexTestBlocks(t, want, 0, b.blocks)
+	assertSameIndex(t, want, index)
+	otherId, ok := index.RuneId(Rune{uint128.From64(2000)})
+	require.True(t, ok)
+	assert.Equal(t, RuneId{Block: testIndexHeight + 3, Tx: 1}, *otherId)
+}
+
+func TestIndexReorgDuringSync(t *testing.T) {
+	a, b, _ := testForks(t)
+	index := NewIndex(wire.TestNet)
+	indexTestBlocks(t, index, 0, a.blocks[:2])
+
+	// the chain switched to fork B after the index checked it: the next block
+	// builds on a block the index does not have
+	err := index.IndexBlock(testIndexHeight+2, b.blocks[2])
+	assert.ErrorIs(t, err, ErrBlockParent)
+	want := NewIndex(wire.TestNet)
+	indexTestBlocks(t, want, 0, a.blocks[:2])
+	assertSameIndex(t, want, index)
+
+	depth, err := index.Reorg(b.chain)
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+	indexTestBlocks(t, index, 1, b.blocks)
+	want = NewIndex(wire.TestNet)
+	indexTestBlocks(t, want, 0, b.blocks)
+	assertSameIndex(t, want, index)
+}
+
+func TestIndexReorgTooDeep(t *testing.T) {
+	a, b, _ := testForks(t)
+	index := NewIndex(wire.TestNet)
+	index.MaxReorgDepth = 1
+	indexTestBlocks(t, index, 0, a.blocks)
+
+	_, err := index.Reorg(b.chain)
+	assert.ErrorIs(t, err, ErrReorgTooDeep)
+	assert.ErrorIs(t, index.Rollback(testIndexHeight), ErrReorgTooDeep)
+	want := NewIndex(wire.TestNet)
+	indexTestBlocks(t, want, 0, a.blocks)
+	assertSameIndex(t, want, index)
+
+	// a reorg within reach
+	fork := newTestFork(a.blocks[:2]...)
+	fork.next(3)
+	depth, err := index.Reorg(fork.chain)
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+
+	// the first block indexed has no block before it to agree on
+	index = NewIndex(wire.TestNet)
+	indexTestBlocks(t, index, 0, a.blocks[:1])
+	_, err = index.Reorg(testChain{testIndexHeight: {1}})
+	assert.ErrorIs(t, err, ErrReorgTooDeep)
+	require.NoError(t, index.Rollback(testIndexHeight-1))
+	assertSameIndex(t, NewIndex(wire.TestNet), index)
+}
+
+func TestIndexReorgWithStore(t *testing.T) {
+	a, b, _ := testForks(t)
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	index, err := OpenIndex(wire.TestNet, store)
+	require.NoError(t, err)
+	index.MaxReorgDepth = 2
+	indexTestBlocks(t, index, 0, a.blocks)
+	require.NoError(t, store.Close())
+
+	// the undo records outlive a restart
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	index, err = OpenIndex(wire.TestNet, store)
+	require.NoError(t, err)
+	index.MaxReorgDepth = 2
+	depth, err := index.Reorg(b.chain)
+	require.NoError(t, err)
+	assert.Equal(t, 2, depth)
+	indexTestBlocks(t, index, 1, b.blocks)
+	require.NoError(t, store.Close())
+
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	index, err = OpenIndex(wire.TestNet, store)
+	require.NoError(t, err)
+	want := NewIndex(wire.TestNet)
+	indexTestBlocks(t, want, 0, b.blocks)
+	assertSameIndex(t, want, index)
+	// only the last MaxReorgDepth undo records are kept
+	assert.Len(t, index.undos, 2)
+	var heights []uint64
+	require.NoError(t, store.Iterate(undoPrefix, func(key, value []byte) error {
+		undo, err := decodeBlockUndo(value)
+		heights = append(heights, undo.height)
+		return err
+	}))
+	assert.Equal(t, []uint64{testIndexHeight + 2, testIndexHeight + 3}, heights)
+	require.NoError(t, store.Close())
+}
+
+type failingFetcher struct{}
+
+func (failingFetcher) FetchTxOut(outpoint wire.OutPoint) (*wire.TxOut, uint64, error) {
+	return nil, 0, errors.New("backend down")
+}
+
+func TestIndexBlockErrorLeavesIndex(t *testing.T) {
+	a, _, id := testForks(t)
+	index := NewIndex(wire.TestNet)
+	indexTestBlocks(t, index, 0, a.blocks[:2])
+	want := NewIndex(wire.TestNet)
+	indexTestBlocks(t, want, 0, a.blocks[:2])
+
+	// the etching of the block looks its commitment up after the mint and
+	// the burn before it were applied
+	index.Fetcher = failingFetcher{}
+	err := index.IndexBlock(testIndexHeight+2, a.blocks[2])
+	assert.ErrorContains(t, err, "backend down")
+	assertSameIndex(t, want, index)
+	entry, _ := index.RuneEntry(id)
+	assert.EqualValues(t, 1, entry.Mints.Lo)
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"lukechampine.com/uint128"
+)
+
+// RuneEntry is the indexed state of an etched rune.
+type RuneEntry struct {
+	Block        uint64
+	Burned       uint128.Uint128
+	Divisibility uint8
+	Etching      chainhash.Hash
+	Mints        uint128.Uint128
+	Number       uint64
+	Premine      uint128.Uint128
+	SpacedRune   SpacedRune
+	Symbol       *rune
+	Terms        *Terms
+	Timestamp    uint64
+	Turbo        bool
+}
+
+type MintError struct {
+	Kind   MintErrorKind
+	Height uint64
+	Cap    uint128.Uint128
+}
+
+type MintErrorKind int
+
+const (
+	MintUnmintable MintErrorKind = iota
+	MintStart
+	MintEnd
+	MintCap
+)
+
+func (e *MintError) Error() string {
+	switch e.Kind {
+	case MintStart:
+		return fmt.Sprintf("rune not mintable until block %d", e.Height)
+	case MintEnd:
+		return fmt.Sprintf("rune mint ended on block %d", e.Height)
+	case MintCap:
+		return fmt.Sprintf("limited to %s mints", e.Cap)
+	default:
+		return "not mintable"
+	}
+}
+
+// Mintable returns the amount a mint included in a block at height receives,
+// or a *MintError explaining why the rune cannot be minted there.
+func (e *RuneEntry) Mintable(height uint64) (uint128.Uint128, error) {
+	if e.Terms == nil {
+		return uint128.Zero, &MintError{Kind: MintUnmintable}
+	}
+	if start := e.Start(); start != nil && height < *start {
+		return uint128.Zero, &MintError{Kind: MintStart, Height: *start}
+	}
+	if end := e.End(); end != nil && height >= *end {
+		return uint128.Zero, &MintError{Kind: MintEnd, Height: *end}
+	}
+	cap := uint128.Zero
+	if e.Terms.Cap != nil {
+		cap = *e.Terms.Cap
+	}
+	if e.Mints.Cmp(cap) >= 0 {
+		return uint128.Zero, &MintError{Kind: MintCap, Cap: cap}
+	}
+	if e.Terms.Amount == nil {
+		return uint128.Zero, nil
+	}
+	return *e.Terms.Amount, nil
+}
+
+// Start is the first height at which the rune can be minted, taking the later
+// of the absolute and the etching-relative start.
+func (e *RuneEntry) Start() *uint64 {
+	if e.Terms == nil {
+		return nil
+	}
+	var relative *uint64
+	if e.Terms.Offset[0] != nil {
+		h := saturatingAdd(e.Block, *e.Terms.Offset[0])
+		relative = &h
+	}
+	absolute := e.Terms.Height[0]
+	if relative != nil && absolute != nil {
+		h := max(*relative, *absolute)
+		return &h
+	}
+	if relative != nil {
+		return relative
+	}
+	return absolute
+}
+
+// End is the first height at which the rune can no longer be minted, taking
+// the earlier of the absolute and the etching-relative end.
+func (e *RuneEntry) End() *uint64 {
+	if e.Terms == nil {
+		return nil
+	}
+	var relative *uint64
+	if e.Terms.Offset[1] != nil {
+		h := saturatingAdd(e.Block, *e.Terms.Offset[1])
+		relative = &h
+	}
+	absolute := e.Terms.Height[1]
+	if relative != nil && absolute != nil {
+		h := min(*relative, *absolute)
+		return &h
+	}
+	if relative != nil {
+		return relative
+	}
+	return absolute
+}
+
+// Remaining returns the number of mints left before the cap is reached.
+func (e *RuneEntry) Remaining() uint128.Uint128 {
+	if e.Terms == nil || e.Terms.Cap == nil || e.Mints.Cmp(*e.Terms.Cap) >= 0 {
+		return uint128.Zero
+	}
+	return e.Terms.Cap.Sub(e.Mints)
+}
+
+// Supply is the premine plus everything minted so far.
+func (e *RuneEntry) Supply() uint128.Uint128 {
+	amount := uint128.Zero
+	if e.Terms != nil && e.Terms.Amount != nil {
+		amount = *e.Terms.Amount
+	}
+	return e.Premine.Add(amount.Mul(e.Mints))
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a+b < a {
+		return ^uint64(0)
+	}
+	return a + b
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"lukechampine.com/uint128"
+)
+
+func TestRuneEntryStartEnd(t *testing.T) {
+	entry := &RuneEntry{Block: 10}
+	assert.Nil(t, entry.Start())
+	assert.Nil(t, entry.End())
+
+	entry.Terms = &Terms{Height: [2]*uint64{Uint64P(15), Uint64P(30)}}
+	assert.Equal(t, uint64(15), *entry.Start())
+	assert.Equal(t, uint64(30), *entry.End())
+
+	entry.Terms.Offset = [2]*uint64{Uint64P(10), Uint64P(15)}
+	assert.Equal(t, uint64(20), *entry.Start())
+	assert.Equal(t, uint64(25), *entry.End())
+
+	entry.Terms.Height = [2]*uint64{nil, nil}
+	entry.Terms.Offset = [2]*uint64{Uint64P(2), Uint64P(^uint64(0))}
+	assert.Equal(t, uint64(12), *entry.Start())
+	assert.Equal(t, ^uint64(0), *entry.End())
+}
+
+func TestRuneEntryMintable(t *testing.T) {
+	entry := &RuneEntry{Block: 10}
+	_, err := entry.Mintable(10)
+	assert.Equal(t, &MintError{Kind: MintUnmintable}, err)
+
+	entry.Terms = &Terms{
+		Amount: Uint128PFrom64(1000),
+		Cap:    Uint128PFrom64(2),
+		Height: [2]*uint64{Uint64P(12), Uint64P(20)},
+	}
+	_, err = entry.Mintable(11)
+	assert.Equal(t, &MintError{Kind: MintStart, Height: 12}, err)
+	_, err = entry.Mintable(20)
+	assert.Equal(t, &MintError{Kind: MintEnd, Height: 20}, err)
+
+	amount, err := entry.Mintable(12)
+	assert.NoError(t, err)
+	assert.Equal(t, uint128.From64(1000), amount)
+	assert.Equal(t, uint128.From64(2), entry.Remaining())
+
+	entry.Mints = uint128.From64(2)
+	_, err = entry.Mintable(12)
+	assert.EqualError(t, err, "limited to 2 mints")
+	assert.True(t, entry.Remaining().IsZero())
+	assert.Equal(t, uint128.From64(2000), entry.Supply())
+}
@@ -282,10 +282,14 @@ func (r *Runestone) Encipher() ([]byte, error) {
 			payload = append(payload, EncodeUint128(*r.Etching.Premine)...)
 		}
 		if r.Etching.Terms != nil {
-			payload = append(payload, TagAmount.Byte())
-			payload = append(payload, EncodeUint128(*r.Etching.Terms.Amount)...)
-			payload = append(payload, TagCap.Byte())
-			payload = append(payload, EncodeUint128(*r.Etching.Terms.Cap)...)
+			if r.Etching.Terms.Amount != nil {
+				payload = append(payload, TagAmount.Byte())
+				payload = append(payload, EncodeUint128(*r.Etching.Terms.Amount)...)
+			}
+			if r.Etching.Terms.Cap != nil {
+				payload = append(payload, TagCap.Byte())
+				payload = append(payload, EncodeUint128(*r.Etching.Terms.Cap)...)
+			}
 			if r.Etching.Terms.Height[0] != nil {
 				payload = append(payload, TagHeightStart.Byte())
 				payload = append(payload, EncodeUint64(*r.Etching.Terms.Height[0])...)
@@ -405,6 +409,23 @@ func isPushBytes(opCode byte) bool {
 	return opCode >= txscript.OP_0 && opCode <= txscript.OP_PUSHDATA4
 }
 
+// RunestoneScript returns the script of the first OP_RETURN OP_13 output of
+// tx, the one Decipher reads, or nil if it has none.
+func RunestoneScript(tx *wire.MsgTx) []byte {
+	for _, out := range tx.TxOut {
+		if len(out.PkScript) > 1 && out.PkScript[0] == txscript.OP_RETURN && out.PkScript[1] == MAGIC_NUMBER {
+			return out.PkScript
+		}
+	}
+	return nil
+}
+
+// HasRunestoneOutput reports whether tx has an OP_RETURN OP_13 output, so that
+// a payload failing to decipher can be told from a missing one.
+func HasRunestoneOutput(tx *wire.MsgTx) bool {
+	return RunestoneScript(tx) != nil
+}
+
 func (r *Runestone) integers(payload []byte) ([]uint128.Uint128, error) {
 	integers := make([]uint128.Uint128, 0)
 	i := 0
@@ -175,6 +175,20 @@ func TestDecipheringTransactionWithNonMatchingOpReturnReturnsNone(t *testing.T)
 	assert.Nil(t, a)
 }
 
+func TestRunestoneScript(t *testing.T) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN, txscript.OP_DATA_4, 'F', 'O', 'O', 'O'}))
+	assert.Nil(t, RunestoneScript(tx))
+	assert.False(t, HasRunestoneOutput(tx))
+
+	script := []byte{txscript.OP_RETURN, MAGIC_NUMBER, txscript.OP_DATA_1, 0x80}
+	tx.AddTxOut(wire.NewTxOut(0, script))
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN, MAGIC_NUMBER}))
+	assert.Equal(t, script, RunestoneScript(tx))
+	assert.True(t, HasRunestoneOutput(tx))
+}
+
 func TestDecipheringValidRunestoneWithInvalidScriptPostfixReturnsInvalidPayload(t *testing.T) {
 	builder := txscript.NewScriptBuilder()
 	builder.AddOp(txscript.OP_RETURN)
@@ -1599,6 +1613,20 @@ func TestEncipher(t *testing.T) {
 			FlagEtching.Mask(),
 		},
 	)
+
+	caseFunc(
+		Runestone{
+			Etching: &Etching{
+				Terms: &Terms{Height: [2]*uint64{nil, Uint64P(4)}},
+			},
+		},
+		[]uint128.Uint128{
+			itag(TagFlags),
+			FlagEtching.Mask().Or(FlagTerms.Mask()),
+			itag(TagHeightEnd),
+			uint128.From64(4),
+		},
+	)
 }
 func scriptInstructionsCount(script []byte) int {
 	tokenizer := txscript.MakeScriptTokenizer(0, script)
@@ -0,0 +1,118 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store is a key-value store the state of an Index is kept in. The index
+// writes every block as one Batch; a store that applies a batch atomically
+// never holds a half-indexed block. Keys and values passed to a store must not
+// be modified afterwards, and the slices it returns must not be modified by
+// the caller.
+type Store interface {
+	// Get returns the value of key, and false if there is none.
+	Get(key []byte) ([]byte, bool, error)
+	// Iterate calls fn for every key starting with prefix, in key order, and
+	// stops at the first error fn returns.
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+	// Write applies the operations of batch in order.
+	Write(batch Batch) error
+	Close() error
+}
+
+// BatchOp sets Key to Value, or deletes Key.
+type BatchOp struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// Batch is a list of writes applied together.
+type Batch []BatchOp
+
+func (b *Batch) Put(key, value []byte) {
+	*b = append(*b, BatchOp{Key: key, Value: value})
+}
+
+func (b *Batch) Delete(key []byte) {
+	*b = append(*b, BatchOp{Key: key, Delete: true})
+}
+
+// MemoryStore is a Store in a map, lost when the process exits.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Get(key []byte) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[string(key)]
+	return value, ok, nil
+}
+
+// Iterate calls fn on a copy of the matching keys, so fn may write to the
+// store.
+func (s *MemoryStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	var keys []string
+	for key := range s.values {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	values := make([][]byte, len(keys))
+	sort.Strings(keys)
+	for n, key := range keys {
+		values[n] = s.values[key]
+	}
+	s.mu.RUnlock()
+	for n, key := range keys {
+		if err := fn([]byte(key), values[n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Write(batch Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apply(batch)
+	return nil
+}
+
+func (s *MemoryStore) apply(batch Batch) {
+	for _, op := range batch {
+		if op.Delete {
+			delete(s.values, string(op.Key))
+		} else {
+			s.values[string(op.Key)] = bytes.Clone(op.Value)
+		}
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
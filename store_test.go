@@ -0,0 +1,151 @@
+// Copyright 2024 The BxELab studyzy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runestone
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStoreContents returns every key of store with its value.
+func testStoreContents(t *testing.T, store Store) map[string]string {
+	contents := map[string]string{}
+	require.NoError(t, store.Iterate(nil, func(key, value []byte) error {
+		contents[string(key)] = string(value)
+		return nil
+	}))
+	return contents
+}
+
+func testStore(t *testing.T, store Store) {
+	var batch Batch
+	batch.Put([]byte("a1"), []byte("one"))
+	batch.Put([]byte("a2"), []byte("two"))
+	batch.Put([]byte("b1"), []byte("three"))
+	batch.Delete([]byte("a2"))
+	require.NoError(t, store.Write(batch))
+
+	value, ok, err := store.Get([]byte("a1"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("one"), value)
+	_, ok, err = store.Get([]byte("a2"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.Write(Batch{{Key: []byte("a3"), Value: []byte{}}, {Key: []byte("a0"), Value: []byte("zero")}}))
+	var keys []string
+	require.NoError(t, store.Iterate([]byte("a"), func(key, value []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	assert.Equal(t, []string{"a0", "a1", "a3"}, keys)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	testStore(t, store)
+	want := testStoreContents(t, store)
+	require.NoError(t, store.Close())
+
+	// from the log alone
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, want, testStoreContents(t, store))
+
+	// from the snapshot, with a batch logged since
+	require.NoError(t, store.Snapshot())
+	require.NoError(t, store.Write(Batch{{Key: []byte("a1"), Delete: true}}))
+	delete(want, "a1")
+	require.NoError(t, store.Close())
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, want, testStoreContents(t, store))
+	require.NoError(t, store.Close())
+}
+
+func TestFileStoreSnapshotInterval(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	store.SnapshotInterval = 3
+	for _, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, store.Write(Batch{{Key: []byte(key), Value: []byte(key)}}))
+	}
+	require.NoError(t, store.Close())
+
+	// three batches went into the snapshot, the fourth is the whole log
+	info, err := os.Stat(filepath.Join(dir, logFile))
+	require.NoError(t, err)
+	assert.EqualValues(t, len(encodeRecord(encodeBatch(Batch{{Key: []byte("d"), Value: []byte("d")}}))), info.Size())
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "a", "b": "b", "c": "c", "d": "d"}, testStoreContents(t, store))
+	require.NoError(t, store.Close())
+}
+
+func TestFileStoreDropsTornBatch(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Write(Batch{{Key: []byte("kept"), Value: []byte("1")}}))
+	require.NoError(t, store.Close())
+
+	// a crash in the middle of the second batch
+	torn := encodeRecord(encodeBatch(Batch{{Key: []byte("lost"), Value: []byte("2")}, {Key: []byte("kept"), Delete: true}}))
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = log.Write(torn[:len(torn)-3])
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"kept": "1"}, testStoreContents(t, store))
+	// the torn bytes are gone and the next batch follows the good ones
+	require.NoError(t, store.Write(Batch{{Key: []byte("next"), Value: []byte("3")}}))
+	require.NoError(t, store.Close())
+	store, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"kept": "1", "next": "3"}, testStoreContents(t, store))
+	require.NoError(t, store.Close())
+}
+
+func TestFileStoreCorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Write(Batch{{Key: []byte("a"), Value: []byte("a")}}))
+	require.NoError(t, store.Snapshot())
+	require.NoError(t, store.Close())
+
+	path := filepath.Join(dir, snapshotFile)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	_, err = OpenFileStore(dir)
+	assert.ErrorIs(t, err, errCorruptRecord)
+}